@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"net_disk/server/router"
+	"net_disk/server/service"
 	"os"
 	"path/filepath"
 	"suhc-gitlab-01.inovance.local/mnk/server/lcdp.git/server"
@@ -33,7 +35,15 @@ func main() {
 		tool.Logger.Fatal(err.Error())
 	}
 	server.LoadMessageFile([]string{"./i18n/lcdp.en.yaml", "./i18n/lcdp.zh.yaml"})
+	if err := service.Migrate(context.Background()); err != nil {
+		tool.Logger.Fatal(err.Error())
+	}
 	router.InitRouter()
+	service.StartGC(context.Background())
+	service.StartRecyclePurge(context.Background())
+	service.StartVersionPrune(context.Background())
+	service.StartIndexer(context.Background())
+	service.StartShareStatFlush(context.Background())
 	router.Echo.GET("/lcdp/about", about)
 	router.Echo.Logger.Fatal(router.Echo.Start(fmt.Sprintf(":%d", server.GetPort())))
 
@@ -6,7 +6,11 @@ require (
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/golang-jwt/jwt/v4 v4.5.0
 	github.com/hashicorp/go-uuid v1.0.3
+	github.com/klauspost/compress v1.16.7
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/zeromicro/go-zero v1.6.2
+	golang.org/x/crypto v0.18.0
+	golang.org/x/text v0.14.0
 	xorm.io/xorm v1.3.8
 )
 
@@ -51,7 +55,6 @@ require (
 	go.uber.org/automaxprocs v1.5.3 // indirect
 	golang.org/x/net v0.20.0 // indirect
 	golang.org/x/sys v0.16.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20231106174013-bbf56f31fb17 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20231106174013-bbf56f31fb17 // indirect
 	google.golang.org/grpc v1.61.0 // indirect
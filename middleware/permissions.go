@@ -48,7 +48,7 @@ type (
 		// Skipper defines a function to skip middleware.
 		//Skipper middleware.Skipper
 
-		// IgnoreURLs skip url list
+		// IgnoreURLs skip url list, an entry may be prefixed with a method ("OPTIONS /lcdp/tus") to skip only that method
 		IgnoreURLs []string
 
 		// PermissionList defines a function get permissions
@@ -104,8 +104,15 @@ func (p PermissionMiddlewareConfig) Skipper(c echo.Context) bool {
 	if len(p.IgnoreURLs) == 0 {
 		return false
 	}
-	url := c.Request().RequestURI
+	// match the path only, so public URLs called with a query string are skipped too
+	url := c.Request().URL.Path
 	for _, k := range p.IgnoreURLs {
+		if method, pattern, ok := strings.Cut(k, " "); ok {
+			if method != c.Request().Method {
+				continue
+			}
+			k = pattern
+		}
 		if ok, _ := regexp.MatchString("^"+k+"$", url); ok {
 			return true
 		}
@@ -118,13 +125,18 @@ func PermissionWithConfig(config PermissionMiddlewareConfig) echo.MiddlewareFunc
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) (err error) {
 			req := c.Request()
+			if config.Skipper(c) {
+				// 公开接口不需要 token, 不读取 body: 匿名上传不会在接口检查前被整个解析, 密码和提取码也不会写进日志
+				tool.Logger.Infof("url: %s, method: %s", req.URL.Path, req.Method)
+				return next(c)
+			}
 			token := ""
 			auth := make(map[string]interface{})
 			switch req.Method {
-			case http.MethodGet, http.MethodDelete:
+			case http.MethodGet, http.MethodDelete, http.MethodHead, http.MethodOptions:
 				token = req.URL.Query().Get(config.Key)
 				tool.Logger.Infof("url: %s, method: %s", req.RequestURI, req.Method)
-			case http.MethodPost, http.MethodPut:
+			case http.MethodPost, http.MethodPut, http.MethodPatch:
 				if strings.Contains(req.Header.Get("Content-Type"), "multipart/form-data") {
 					token = c.FormValue(config.Key)
 					query := ""
@@ -140,6 +152,10 @@ func PermissionWithConfig(config PermissionMiddlewareConfig) echo.MiddlewareFunc
 						query += a + "=" + strings.Join(b, ",")
 					}
 					tool.Logger.Infof("url: %s, method: %s, content: %s", req.URL.Path, req.Method, query)
+				} else if req.ContentLength == 0 || strings.Contains(req.Header.Get("Content-Type"), "octet-stream") {
+					// 空 body 或者文件流, 不读取 body, token 放在 query 或 header 中
+					token = req.URL.Query().Get(config.Key)
+					tool.Logger.Infof("url: %s, method: %s, content-length: %d", req.RequestURI, req.Method, req.ContentLength)
 				} else {
 					body, err := ioutil.ReadAll(req.Body)
 					_ = req.Body.Close()
@@ -181,8 +197,8 @@ func PermissionWithConfig(config PermissionMiddlewareConfig) echo.MiddlewareFunc
 				}
 			}
 
-			if config.Skipper(c) {
-				return next(c)
+			if token == "" {
+				token = req.Header.Get(config.Key)
 			}
 
 			if token == "" {
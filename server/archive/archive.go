@@ -0,0 +1,302 @@
+// Package archive 读取 zip/tar/tar.gz/tar.zst 压缩包的条目, 负责路径清理和解压限制 (防止 zip-slip 和压缩炸弹)
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// Format 压缩包格式
+type Format string
+
+const (
+	Zip      Format = "zip"
+	Tar      Format = "tar"
+	TarGzip  Format = "tar.gz"
+	TarZstd  Format = "tar.zst"
+	maxDepth        = 64
+)
+
+var (
+	ErrUnsupported = errors.New("archive: unsupported format")
+	ErrUnsafePath  = errors.New("archive: unsafe entry path")
+	ErrLimit       = errors.New("archive: limit exceeded")
+)
+
+// DetectFormat 按文件名判断格式
+func DetectFormat(name string) (Format, error) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return Zip, nil
+	case strings.HasSuffix(name, ".tar"):
+		return Tar, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return TarGzip, nil
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return TarZstd, nil
+	}
+	return "", ErrUnsupported
+}
+
+// Limits 解压限制, 0 表示不限制
+type Limits struct {
+	MaxEntries   int   // 最多条目数
+	MaxTotalSize int64 // 解压后的总长度
+	MaxRatio     int64 // 解压后与压缩后长度的最大比例
+}
+
+// Entry 压缩包中的一个文件或目录, Path 已经清理过, 使用 "/" 分隔, 不以 "/" 开头和结尾
+type Entry struct {
+	Path    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// Reader 依次返回压缩包中的条目, 结束时返回 io.EOF. 文件内容需要在下一次 Next 之前读取
+type Reader interface {
+	Next() (*Entry, io.Reader, error)
+	Close() error
+}
+
+// CleanPath 把条目名转成相对路径, "./" 这样的根目录返回空串. 绝对路径、包含 ".." 或层级过深的返回 ErrUnsafePath
+func CleanPath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", ErrUnsafePath
+	}
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	clean := parts[:0]
+	for _, p := range parts {
+		switch p {
+		case "", ".":
+			continue
+		case "..":
+			return "", ErrUnsafePath
+		}
+		if strings.ContainsRune(p, 0) {
+			return "", ErrUnsafePath
+		}
+		clean = append(clean, p)
+	}
+	if len(clean) > maxDepth {
+		return "", ErrUnsafePath
+	}
+	return path.Join(clean...), nil
+}
+
+// counter 统计条目数和解压后的总长度, 超过限制时返回 ErrLimit
+type counter struct {
+	limits      Limits
+	archiveSize int64
+	entries     int
+	total       int64 // 文件内容的长度
+	stream      int64 // tar 解压后整个流的长度, 包括头和填充
+}
+
+func (c *counter) entry() error {
+	c.entries++
+	if c.limits.MaxEntries > 0 && c.entries > c.limits.MaxEntries {
+		return ErrLimit
+	}
+	return nil
+}
+
+func (c *counter) overRatio(n int64) bool {
+	return c.limits.MaxRatio > 0 && c.archiveSize > 0 && n > c.archiveSize*c.limits.MaxRatio
+}
+
+// add 累加文件内容的长度
+func (c *counter) add(n int64) error {
+	c.total += n
+	if c.limits.MaxTotalSize > 0 && c.total > c.limits.MaxTotalSize {
+		return ErrLimit
+	}
+	if c.overRatio(c.total) {
+		return ErrLimit
+	}
+	return nil
+}
+
+// addStream 累加 tar 流的长度, 只用于压缩比. 大量空条目的头也会被解压, 所以按整个流计算
+func (c *counter) addStream(n int64) error {
+	c.stream += n
+	if c.overRatio(c.stream) {
+		return ErrLimit
+	}
+	return nil
+}
+
+// limitedReader 按实际解压出的长度计数, 不信任条目头中声明的长度
+type limitedReader struct {
+	r   io.Reader
+	add func(int64) error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if n > 0 {
+		if e := l.add(int64(n)); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
+
+type zipReader struct {
+	files   []*zip.File
+	index   int
+	counter *counter
+	body    io.ReadCloser
+}
+
+// OpenZip 读取 zip, 需要随机访问
+func OpenZip(r io.ReaderAt, size int64, limits Limits) (Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxEntries > 0 && len(zr.File) > limits.MaxEntries {
+		return nil, ErrLimit
+	}
+	return &zipReader{files: zr.File, counter: &counter{limits: limits, archiveSize: size}}, nil
+}
+
+func (z *zipReader) Next() (*Entry, io.Reader, error) {
+	z.closeBody()
+	for z.index < len(z.files) {
+		f := z.files[z.index]
+		z.index++
+		mode := f.Mode()
+		if !mode.IsDir() && !mode.IsRegular() {
+			// 符号链接等特殊文件忽略
+			continue
+		}
+		if err := z.counter.entry(); err != nil {
+			return nil, nil, err
+		}
+		name := f.Name
+		if f.NonUTF8 || !utf8.ValidString(name) {
+			// Windows 自带的压缩工具使用本地编码 (GBK)
+			if decoded, err := simplifiedchinese.GB18030.NewDecoder().String(name); err == nil {
+				name = decoded
+			}
+		}
+		p, err := CleanPath(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if p == "" {
+			continue
+		}
+		entry := &Entry{Path: p, IsDir: mode.IsDir(), Size: int64(f.UncompressedSize64), ModTime: f.Modified}
+		if entry.IsDir {
+			return entry, nil, nil
+		}
+		limits := z.counter.limits
+		if limits.MaxRatio > 0 && f.UncompressedSize64 > 0 && f.UncompressedSize64/(f.CompressedSize64+1) > uint64(limits.MaxRatio) {
+			return nil, nil, ErrLimit
+		}
+		if limits.MaxTotalSize > 0 && z.counter.total+entry.Size > limits.MaxTotalSize {
+			return nil, nil, ErrLimit
+		}
+		body, err := f.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		z.body = body
+		return entry, &limitedReader{r: io.LimitReader(body, entry.Size), add: z.counter.add}, nil
+	}
+	return nil, nil, io.EOF
+}
+
+// closeBody 关闭上一个条目的内容
+func (z *zipReader) closeBody() {
+	if z.body != nil {
+		z.body.Close()
+		z.body = nil
+	}
+}
+
+func (z *zipReader) Close() error {
+	z.closeBody()
+	return nil
+}
+
+type tarReader struct {
+	tr      *tar.Reader
+	counter *counter
+	closer  func()
+}
+
+// OpenTar 流式读取 tar/tar.gz/tar.zst, archiveSize 为压缩包长度, 用于计算压缩比
+func OpenTar(r io.Reader, format Format, archiveSize int64, limits Limits) (Reader, error) {
+	closer := func() {}
+	switch format {
+	case Tar:
+	case TarGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r, closer = gz, func() { gz.Close() }
+	case TarZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		r, closer = zr, zr.Close
+	default:
+		return nil, ErrUnsupported
+	}
+	c := &counter{limits: limits, archiveSize: archiveSize}
+	return &tarReader{tr: tar.NewReader(&limitedReader{r: r, add: c.addStream}), counter: c, closer: closer}, nil
+}
+
+func (t *tarReader) Next() (*Entry, io.Reader, error) {
+	for {
+		hdr, err := t.tr.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir {
+			// 链接、设备文件和 pax 全局头忽略
+			continue
+		}
+		if err := t.counter.entry(); err != nil {
+			return nil, nil, err
+		}
+		p, err := CleanPath(hdr.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if p == "" {
+			continue
+		}
+		entry := &Entry{Path: p, IsDir: hdr.Typeflag == tar.TypeDir, Size: hdr.Size, ModTime: hdr.ModTime}
+		if entry.IsDir {
+			return entry, nil, nil
+		}
+		limits := t.counter.limits
+		if limits.MaxTotalSize > 0 && entry.Size > limits.MaxTotalSize {
+			return nil, nil, ErrLimit
+		}
+		return entry, &limitedReader{r: t.tr, add: t.counter.add}, nil
+	}
+}
+
+func (t *tarReader) Close() error {
+	t.closer()
+	return nil
+}
@@ -0,0 +1,235 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"a/b.txt", "a/b.txt", nil},
+		{"./a/./b/", "a/b", nil},
+		{"a//b", "a/b", nil},
+		{"a\\b\\c.txt", "a/b/c.txt", nil},
+		{"./", "", nil},
+		{"../evil", "", ErrUnsafePath},
+		{"a/../../evil", "", ErrUnsafePath},
+		{"a/..", "", ErrUnsafePath},
+		{"..\\evil", "", ErrUnsafePath},
+		{"/etc/passwd", "", ErrUnsafePath},
+		{"\\windows\\system32", "", ErrUnsafePath},
+		{"C:\\evil", "", ErrUnsafePath},
+		{"c:evil", "", ErrUnsafePath},
+		{"a\x00b", "", ErrUnsafePath},
+		{strings.Repeat("d/", maxDepth) + "f", "", ErrUnsafePath},
+		{strings.Repeat("d/", maxDepth-1) + "f", strings.Repeat("d/", maxDepth-1) + "f", nil},
+	}
+	for _, tt := range tests {
+		got, err := CleanPath(tt.name)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("CleanPath(%q) = %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+type file struct {
+	name string
+	body string
+}
+
+func makeZip(t *testing.T, files ...file) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, f.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeTarGz(t *testing.T, files ...file) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(f.name, "/") {
+			hdr.Typeflag, hdr.Size, hdr.Mode = tar.TypeDir, 0, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, f.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func open(t *testing.T, format Format, data []byte, limits Limits) (Reader, error) {
+	t.Helper()
+	if format == Zip {
+		return OpenZip(bytes.NewReader(data), int64(len(data)), limits)
+	}
+	return OpenTar(bytes.NewReader(data), format, int64(len(data)), limits)
+}
+
+// readAll 读出全部条目, 返回 路径 -> 内容, 目录的内容为 "/"
+func readAll(r Reader) (map[string]string, error) {
+	defer r.Close()
+	result := make(map[string]string)
+	for {
+		entry, body, err := r.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+		if entry.IsDir {
+			result[entry.Path] = "/"
+			continue
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return result, err
+		}
+		result[entry.Path] = string(data)
+	}
+}
+
+func TestRead(t *testing.T) {
+	files := []file{{"./", ""}, {"docs/", ""}, {"docs/a.txt", "hello"}, {"b.txt", "world"}}
+	for _, format := range []Format{Zip, TarGzip} {
+		t.Run(string(format), func(t *testing.T) {
+			var data []byte
+			if format == Zip {
+				data = makeZip(t, files...)
+			} else {
+				data = makeTarGz(t, files...)
+			}
+			r, err := open(t, format, data, Limits{MaxEntries: 10, MaxTotalSize: 100, MaxRatio: 100})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := readAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{"docs": "/", "docs/a.txt": "hello", "b.txt": "world"}
+			if len(got) != len(want) {
+				t.Fatalf("entries = %v, want %v", got, want)
+			}
+			for k, v := range want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	big := strings.Repeat("0", 1<<20) // 1MB 的 0 压缩后只有 1KB 左右
+	many := []file{{"1", "a"}, {"2", "b"}, {"3", "c"}, {"4", "d"}}
+	tests := []struct {
+		name   string
+		files  []file
+		limits Limits
+		err    error
+	}{
+		{"within limits", many, Limits{MaxEntries: 4, MaxTotalSize: 4}, nil},
+		{"too many entries", many, Limits{MaxEntries: 3}, ErrLimit},
+		{"total size", many, Limits{MaxTotalSize: 3}, ErrLimit},
+		{"ratio", []file{{"bomb", big}}, Limits{MaxRatio: 10}, ErrLimit},
+		{"ratio disabled", []file{{"bomb", big}}, Limits{}, nil},
+		{"zip slip", []file{{"../evil", "x"}}, Limits{}, ErrUnsafePath},
+		{"absolute", []file{{"/etc/cron.d/evil", "x"}}, Limits{}, ErrUnsafePath},
+	}
+	for _, format := range []Format{Zip, TarGzip} {
+		for _, tt := range tests {
+			t.Run(string(format)+"/"+tt.name, func(t *testing.T) {
+				var data []byte
+				if format == Zip {
+					data = makeZip(t, tt.files...)
+				} else {
+					data = makeTarGz(t, tt.files...)
+				}
+				r, err := open(t, format, data, tt.limits)
+				if err == nil {
+					_, err = readAll(r)
+				}
+				if !errors.Is(err, tt.err) {
+					t.Errorf("error = %v, want %v", err, tt.err)
+				}
+			})
+		}
+	}
+}
+
+func TestTarSkipsLinks(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+	tw.WriteHeader(&tar.Header{Name: "f", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+	r, err := OpenTar(&buf, Tar, int64(buf.Len()), Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got["f"] != "x" {
+		t.Errorf("entries = %v, want only f", got)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		want Format
+	}{
+		{"a.zip", Zip},
+		{"A.ZIP", Zip},
+		{"a.tar", Tar},
+		{"a.tar.gz", TarGzip},
+		{"a.tgz", TarGzip},
+		{"a.tar.zst", TarZstd},
+		{"a.rar", ""},
+	}
+	for _, tt := range tests {
+		got, err := DetectFormat(tt.name)
+		if got != tt.want || (tt.want == "") != errors.Is(err, ErrUnsupported) {
+			t.Errorf("DetectFormat(%q) = %q, %v", tt.name, got, err)
+		}
+	}
+}
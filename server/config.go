@@ -6,17 +6,29 @@ import (
 	"os"
 
 	"gopkg.in/yaml.v3"
+	"net_disk/server/storage"
 )
 
 // Config server config
 type Config struct {
-	Mode      string
-	LogLevel  string      `yaml:"log_level"`
-	ExpiredIn int         `yaml:"expired_in"` // redis 过期时间
-	DB        *DBConfig   `yaml:"db"`
-	Port      int         `yaml:"port"`
-	Node      int64       `yaml:"node"`
-	Redis     RedisConfig `yaml:"redis"`
+	Mode       string
+	LogLevel   string           `yaml:"log_level"`
+	ExpiredIn  int              `yaml:"expired_in"` // redis 过期时间
+	DB         *DBConfig        `yaml:"db"`
+	Port       int              `yaml:"port"`
+	Node       int64            `yaml:"node"`
+	Redis      RedisConfig      `yaml:"redis"`
+	Storage    storage.Config   `yaml:"storage"`
+	Upload     UploadConfig     `yaml:"upload"`
+	GC         GCConfig         `yaml:"gc"`
+	Encryption EncryptionConfig `yaml:"encryption"`
+	Recycle    RecycleConfig    `yaml:"recycle"`
+	Version    VersionConfig    `yaml:"version"`
+	FullText   FullTextConfig   `yaml:"full_text"`
+	Archive    ArchiveConfig    `yaml:"archive"`
+	Share      ShareConfig      `yaml:"share"`
+	Quota      QuotaConfig      `yaml:"quota"`
+	HTTP       HTTPConfig       `yaml:"http"`
 }
 
 // DBConfig config of db
@@ -33,6 +45,68 @@ type RedisConfig struct {
 	Pwd  string `yaml:"pwd"`
 }
 
+// UploadConfig upload config
+type UploadConfig struct {
+	ProveOwnership bool `yaml:"prove_ownership"` // 秒传时要求客户端证明持有文件内容
+	SessionExpire  int  `yaml:"session_expire"`  // 分片上传会话过期时间(秒), 默认 24 小时
+}
+
+// GCConfig 文件回收配置
+type GCConfig struct {
+	Interval    int  `yaml:"interval"`     // 后台回收间隔(秒), 0 表示不启动
+	GracePeriod int  `yaml:"grace_period"` // 引用数为 0 后保留的时间(秒), 默认 24 小时
+	DryRun      bool `yaml:"dry_run"`      // 后台回收只统计不删除
+}
+
+// EncryptionConfig 存储加密配置
+type EncryptionConfig struct {
+	Enabled   bool   `yaml:"enabled"`    // 新写入的文件加密存储, 已有文件不受影响
+	MasterKey string `yaml:"master_key"` // base64 编码的 32 字节主密钥, 用于加密用户密钥
+}
+
+// RecycleConfig 回收站配置
+type RecycleConfig struct {
+	Retention int `yaml:"retention"` // 保留天数, 默认 30 天, 过期后彻底删除
+}
+
+// VersionConfig 历史版本保留策略, 满足任意一个条件的版本被删除, 0 表示不限制
+type VersionConfig struct {
+	KeepLast int `yaml:"keep_last"` // 每个文件最多保留的版本数
+	KeepDays int `yaml:"keep_days"` // 版本最多保留的天数
+}
+
+// FullTextConfig 全文检索配置
+type FullTextConfig struct {
+	Enabled     bool `yaml:"enabled"`       // 上传后在后台提取文本并建立索引
+	MaxFileSize int  `yaml:"max_file_size"` // 建索引的文件最大长度(MB), 默认 20
+	MaxText     int  `yaml:"max_text"`      // 每个文件最多索引的文本长度(KB), 默认 1024
+}
+
+// ArchiveConfig 在线解压的限制, 防止压缩炸弹
+type ArchiveConfig struct {
+	MaxEntries   int `yaml:"max_entries"`    // 最多条目数, 默认 10000
+	MaxTotalSize int `yaml:"max_total_size"` // 解压后的总长度(MB), 默认 10240
+	MaxRatio     int `yaml:"max_ratio"`      // 解压后与压缩包长度的最大比例, 默认 100
+}
+
+// ShareConfig 分享链接配置
+type ShareConfig struct {
+	BaseURL       string `yaml:"base_url"`       // 分享链接的前缀, 后面拼接分享的 identity, 默认 "/s/"
+	FlushInterval int    `yaml:"flush_interval"` // 访问统计写入数据库的间隔(秒), 默认 60
+	RequestURL    string `yaml:"request_url"`    // 文件收集链接的前缀, 默认 "/r/"
+}
+
+// QuotaConfig 用户空间配置
+type QuotaConfig struct {
+	Default int64 `yaml:"default"` // 每个用户的空间上限(MB), 包括回收站和历史版本, 0 表示不限制
+}
+
+// HTTPConfig 接入配置
+type HTTPConfig struct {
+	// 反向代理的地址(IP 或 CIDR), 只信任来自这些地址的 X-Forwarded-For. 为空时使用连接的对端地址
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
 func LoadLocalConfig(path, mode string) (*Config, error) {
 	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s/server.yaml", path, mode))
 
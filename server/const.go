@@ -30,5 +30,11 @@ var Pagesize int = 20
 
 var DateTime = "2006-01-02 15:04:5"
 
+// 认证中间件写入 echo.Context 的当前用户 identity
+var CtxUserIdentity = "user_identity"
+
+// 秒传校验的有效期
+var ChallengeExpire = 300
+
 var TokenExpire int64 = 3600 * 12
 var RefreshTokenExpire int64 = 3600 * 24
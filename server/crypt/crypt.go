@@ -0,0 +1,390 @@
+// Package crypt 存储加密: 数据按 ChunkSize 分块用 AES-256-GCM 加密, 读取任意区间时只需要下载并解密覆盖它的块.
+//
+// 一个加密对象由若干段依次拼接, 每段对应一次 Put 或一个分片:
+//
+//	段   = 8 字节随机 nonce 前缀 + 块 0 + 块 1 + ...
+//	块 i = AES-GCM(明文[i*ChunkSize:(i+1)*ChunkSize]), nonce = 前缀 + 大端 uint32(i)
+//
+// 附加数据包含段号和是否最后一块, 段或块被调换、截断时解密失败.
+// 每段的明文长度记录在 Layout 中, 用来把明文偏移换算成密文偏移
+package crypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// KeySize 数据密钥/用户密钥/主密钥的长度
+	KeySize = 32
+	// ChunkSize 明文分块长度
+	ChunkSize = 64 << 10
+
+	prefixSize = 8
+	tagSize    = 16
+)
+
+var (
+	ErrKeySize = errors.New("crypt: invalid key size")
+	ErrAuth    = errors.New("crypt: message authentication failed")
+	ErrLayout  = errors.New("crypt: invalid layout")
+)
+
+// NewKey 生成随机密钥
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Wrap 用 kek 加密 key, 返回 nonce + 密文
+func Wrap(kek, key []byte) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(key)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, nil), nil
+}
+
+// Unwrap 解密 Wrap 的结果
+func Unwrap(kek, wrapped []byte) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrAuth
+	}
+	key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrAuth
+	}
+	return key, nil
+}
+
+// SegmentSize 明文长度为 size 的段加密后的长度, 空段也有一个块
+func SegmentSize(size int64) int64 {
+	return prefixSize + size + chunkCount(size)*tagSize
+}
+
+func chunkCount(size int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + ChunkSize - 1) / ChunkSize
+}
+
+func nonce(prefix []byte, index int64) []byte {
+	n := make([]byte, prefixSize+4)
+	copy(n, prefix)
+	binary.BigEndian.PutUint32(n[prefixSize:], uint32(index))
+	return n
+}
+
+func additional(segment int, last bool) []byte {
+	ad := make([]byte, 5)
+	binary.BigEndian.PutUint32(ad, uint32(segment))
+	if last {
+		ad[4] = 1
+	}
+	return ad
+}
+
+type encrypter struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	segment int
+	prefix  []byte
+	index   int64
+	buf     []byte
+	out     []byte
+	done    bool
+}
+
+// NewEncrypter 返回 r 加密后的流, segment 为段号 (从 1 开始, 分片上传时等于分片号)
+func NewEncrypter(r io.Reader, key []byte, segment int) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, err
+	}
+	return &encrypter{
+		r:       bufio.NewReader(r),
+		aead:    aead,
+		segment: segment,
+		prefix:  prefix,
+		buf:     make([]byte, ChunkSize, ChunkSize+tagSize),
+		out:     prefix,
+	}, nil
+}
+
+func (e *encrypter) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+func (e *encrypter) seal() error {
+	n, err := io.ReadFull(e.r, e.buf[:ChunkSize])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := n < ChunkSize
+	if !last {
+		if _, err := e.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	e.out = e.aead.Seal(e.buf[:0], nonce(e.prefix, e.index), e.buf[:n], additional(e.segment, last))
+	e.index++
+	e.done = last
+	return nil
+}
+
+// Layout 加密对象每段的明文长度
+type Layout []int64
+
+// Size 明文总长度
+func (l Layout) Size() int64 {
+	var size int64
+	for _, s := range l {
+		size += s
+	}
+	return size
+}
+
+// String 编码成 "长度*重复次数,长度" 的形式, 分片上传时除最后一片外长度通常相同
+func (l Layout) String() string {
+	var b strings.Builder
+	for i := 0; i < len(l); {
+		j := i + 1
+		for j < len(l) && l[j] == l[i] {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatInt(l[i], 10))
+		if j-i > 1 {
+			b.WriteByte('*')
+			b.WriteString(strconv.Itoa(j - i))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// ParseLayout 解析 Layout.String 的结果
+func ParseLayout(s string) (Layout, error) {
+	var l Layout
+	if s == "" {
+		return l, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		size, count := item, "1"
+		if i := strings.IndexByte(item, '*'); i >= 0 {
+			size, count = item[:i], item[i+1:]
+		}
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || n < 0 {
+			return nil, ErrLayout
+		}
+		c, err := strconv.Atoi(count)
+		if err != nil || c < 1 {
+			return nil, ErrLayout
+		}
+		for ; c > 0; c-- {
+			l = append(l, n)
+		}
+	}
+	return l, nil
+}
+
+// Fetcher 读取密文的 [offset, offset+length) 区间
+type Fetcher func(offset, length int64) (io.ReadCloser, error)
+
+type rangeReader struct {
+	fetch  Fetcher
+	aead   cipher.AEAD
+	layout Layout
+	pos    int64 // 下一个要输出的明文偏移
+	end    int64
+
+	segment     int   // 当前段下标
+	plainStart  int64 // 当前段的明文起始偏移
+	cipherStart int64 // 当前段的密文起始偏移
+	body        io.ReadCloser
+	prefix      []byte
+	chunk       int64 // body 中下一块的块号
+	buf         []byte
+	out         []byte
+}
+
+// OpenRange 解密明文的 [offset, offset+length) 区间, 只下载覆盖该区间的块. 超出明文长度的部分被忽略
+func OpenRange(fetch Fetcher, key []byte, layout Layout, offset, length int64) (io.ReadCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	end := offset + length
+	if size := layout.Size(); end > size || length < 0 {
+		end = size
+	}
+	return &rangeReader{
+		fetch:  fetch,
+		aead:   aead,
+		layout: layout,
+		pos:    offset,
+		end:    end,
+		buf:    make([]byte, ChunkSize+tagSize),
+	}, nil
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.pos >= r.end {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// next 解密 pos 所在的块
+func (r *rangeReader) next() error {
+	for r.pos >= r.plainStart+r.layout[r.segment] {
+		r.closeBody()
+		r.plainStart += r.layout[r.segment]
+		r.cipherStart += SegmentSize(r.layout[r.segment])
+		r.segment++
+	}
+	size := r.layout[r.segment]
+	if r.body == nil {
+		if err := r.openSegment(); err != nil {
+			return err
+		}
+	}
+
+	chunkStart := r.chunk * ChunkSize
+	n := size - chunkStart
+	if n > ChunkSize {
+		n = ChunkSize
+	}
+	sealed := r.buf[:n+tagSize]
+	if _, err := io.ReadFull(r.body, sealed); err != nil {
+		return err
+	}
+	last := r.chunk == chunkCount(size)-1
+	plain, err := r.aead.Open(sealed[:0], nonce(r.prefix, r.chunk), sealed, additional(r.segment+1, last))
+	if err != nil {
+		return ErrAuth
+	}
+	r.chunk++
+
+	from := r.pos - r.plainStart - chunkStart
+	to := int64(len(plain))
+	if limit := r.end - r.plainStart - chunkStart; to > limit {
+		to = limit
+	}
+	r.out = plain[from:to]
+	r.pos += to - from
+	return nil
+}
+
+// openSegment 下载当前段中从 pos 到 end 需要的块
+func (r *rangeReader) openSegment() error {
+	size := r.layout[r.segment]
+	first := (r.pos - r.plainStart) / ChunkSize
+	last := chunkCount(size) - 1
+	if end := r.end - r.plainStart; end < size {
+		last = (end - 1) / ChunkSize
+	}
+	chunksStart := r.cipherStart + prefixSize + first*(ChunkSize+tagSize)
+	chunksEnd := r.cipherStart + prefixSize + last*(ChunkSize+tagSize) + (size - last*ChunkSize) + tagSize
+	if last < chunkCount(size)-1 {
+		chunksEnd = r.cipherStart + prefixSize + (last+1)*(ChunkSize+tagSize)
+	}
+
+	start := chunksStart
+	if first == 0 {
+		start = r.cipherStart
+	} else {
+		prefix, err := r.fetch(r.cipherStart, prefixSize)
+		if err != nil {
+			return err
+		}
+		r.prefix = make([]byte, prefixSize)
+		_, err = io.ReadFull(prefix, r.prefix)
+		prefix.Close()
+		if err != nil {
+			return err
+		}
+	}
+	body, err := r.fetch(start, chunksEnd-start)
+	if err != nil {
+		return err
+	}
+	if first == 0 {
+		r.prefix = make([]byte, prefixSize)
+		if _, err := io.ReadFull(body, r.prefix); err != nil {
+			body.Close()
+			return err
+		}
+	}
+	r.body = body
+	r.chunk = first
+	return nil
+}
+
+func (r *rangeReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
+
+func (r *rangeReader) Close() error {
+	r.closeBody()
+	return nil
+}
@@ -0,0 +1,219 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+// sealed 把每段明文分别加密后拼接, 返回密文和 Layout
+func sealed(t *testing.T, key []byte, segments ...[]byte) ([]byte, Layout) {
+	t.Helper()
+	var out bytes.Buffer
+	var layout Layout
+	for i, plain := range segments {
+		r, err := NewEncrypter(bytes.NewReader(plain), key, i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := io.Copy(&out, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != SegmentSize(int64(len(plain))) {
+			t.Fatalf("segment %d: %d bytes, SegmentSize = %d", i+1, n, SegmentSize(int64(len(plain))))
+		}
+		layout = append(layout, int64(len(plain)))
+	}
+	return out.Bytes(), layout
+}
+
+func fetcher(data []byte) Fetcher {
+	return func(offset, length int64) (io.ReadCloser, error) {
+		end := offset + length
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		return io.NopCloser(bytes.NewReader(data[offset:end])), nil
+	}
+}
+
+func random(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func readRange(key []byte, data []byte, layout Layout, offset, length int64) ([]byte, error) {
+	r, err := OpenRange(fetcher(data), key, layout, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		segments []int
+	}{
+		{"empty", []int{0}},
+		{"small", []int{100}},
+		{"one chunk", []int{ChunkSize}},
+		{"chunk plus one", []int{ChunkSize + 1}},
+		{"multi chunk", []int{3*ChunkSize + 17}},
+		{"multi segment", []int{2 * ChunkSize, 2 * ChunkSize, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var plains [][]byte
+			for _, n := range tt.segments {
+				plains = append(plains, random(t, n))
+			}
+			data, layout := sealed(t, key, plains...)
+			plain := bytes.Join(plains, nil)
+
+			ranges := [][2]int64{{0, -1}, {0, 1}, {1, 10}}
+			if size := int64(len(plain)); size > ChunkSize {
+				ranges = append(ranges,
+					[2]int64{ChunkSize - 5, 10},         // 跨块
+					[2]int64{ChunkSize, ChunkSize},      // 从块边界开始
+					[2]int64{size - 3, 100},             // 超出结尾
+					[2]int64{size/2 - 1, size/2 + 1000}, // 跨段
+				)
+			}
+			for _, ra := range ranges {
+				got, err := readRange(key, data, layout, ra[0], ra[1])
+				if err != nil {
+					t.Fatalf("OpenRange(%d, %d): %v", ra[0], ra[1], err)
+				}
+				end := int64(len(plain))
+				if ra[1] >= 0 && ra[0]+ra[1] < end {
+					end = ra[0] + ra[1]
+				}
+				start := ra[0]
+				if start > end {
+					start = end
+				}
+				if !bytes.Equal(got, plain[start:end]) {
+					t.Errorf("OpenRange(%d, %d) returned %d bytes, want %d", ra[0], ra[1], len(got), end-start)
+				}
+			}
+		})
+	}
+}
+
+func TestTamper(t *testing.T) {
+	key, _ := NewKey()
+	plain := random(t, 2*ChunkSize+100)
+	data, layout := sealed(t, key, plain)
+
+	chunk := int64(ChunkSize + tagSize)
+	tests := []struct {
+		name   string
+		offset int64 // 翻转的密文字节
+	}{
+		{"nonce prefix", 0},
+		{"first chunk", prefixSize},
+		{"first chunk tag", prefixSize + chunk - 1},
+		{"second chunk start", prefixSize + chunk},
+		{"last chunk", prefixSize + 2*chunk + 5},
+		{"last byte", int64(len(data)) - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bad := append([]byte(nil), data...)
+			bad[tt.offset] ^= 1
+			if _, err := readRange(key, bad, layout, 0, -1); !errors.Is(err, ErrAuth) {
+				t.Errorf("read tampered data error = %v, want ErrAuth", err)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	key, _ := NewKey()
+	plain := random(t, 2*ChunkSize)
+	data, _ := sealed(t, key, plain)
+
+	// 在块边界截断后把最后一个完整块当作结尾, "是否最后一块" 不匹配
+	truncated := data[:prefixSize+ChunkSize+tagSize]
+	if _, err := readRange(key, truncated, Layout{ChunkSize}, 0, -1); !errors.Is(err, ErrAuth) {
+		t.Errorf("read truncated data error = %v, want ErrAuth", err)
+	}
+	// Layout 与密文不符, 读到中途数据不足
+	if _, err := readRange(key, data[:len(data)-1], Layout{2 * ChunkSize}, 0, -1); err == nil {
+		t.Error("read short data succeeded")
+	}
+}
+
+func TestSwapSegments(t *testing.T) {
+	key, _ := NewKey()
+	a, b := random(t, 100), random(t, 100)
+	data, layout := sealed(t, key, a, b)
+	n := SegmentSize(100)
+	swapped := append(append([]byte(nil), data[n:]...), data[:n]...)
+	if _, err := readRange(key, swapped, layout, 0, -1); !errors.Is(err, ErrAuth) {
+		t.Errorf("read swapped segments error = %v, want ErrAuth", err)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	kek, _ := NewKey()
+	key, _ := NewKey()
+	wrapped, err := Wrap(kek, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unwrap(kek, wrapped)
+	if err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("Unwrap = %x, %v", got, err)
+	}
+	other, _ := NewKey()
+	if _, err := Unwrap(other, wrapped); !errors.Is(err, ErrAuth) {
+		t.Errorf("Unwrap with wrong kek error = %v, want ErrAuth", err)
+	}
+	if _, err := Unwrap(kek, wrapped[:4]); !errors.Is(err, ErrAuth) {
+		t.Errorf("Unwrap short input error = %v, want ErrAuth", err)
+	}
+	if _, err := Wrap(kek[:16], key); !errors.Is(err, ErrKeySize) {
+		t.Errorf("Wrap with short kek error = %v, want ErrKeySize", err)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		layout Layout
+		want   string
+	}{
+		{nil, ""},
+		{Layout{5}, "5"},
+		{Layout{8, 8, 8, 3}, "8*3,3"},
+		{Layout{1, 2, 2}, "1,2*2"},
+	}
+	for _, tt := range tests {
+		s := tt.layout.String()
+		if s != tt.want {
+			t.Errorf("%v.String() = %q, want %q", tt.layout, s, tt.want)
+		}
+		got, err := ParseLayout(s)
+		if err != nil || got.String() != s {
+			t.Errorf("ParseLayout(%q) = %v, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"x", "-1", "3*0", "3*", ","} {
+		if _, err := ParseLayout(s); !errors.Is(err, ErrLayout) {
+			t.Errorf("ParseLayout(%q) error = %v, want ErrLayout", s, err)
+		}
+	}
+}
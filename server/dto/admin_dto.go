@@ -0,0 +1,5 @@
+package dto
+
+type GCRequest struct {
+	DryRun bool `json:"dryRun"`
+}
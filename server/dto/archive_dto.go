@@ -0,0 +1,22 @@
+package dto
+
+type ArchiveEntryItem struct {
+	Path    string `json:"path"` // 压缩包中的相对路径, 使用 "/" 分隔
+	IsDir   bool   `json:"isDir"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime,omitempty"`
+}
+
+type ArchiveListResponse struct {
+	List []ArchiveEntryItem `json:"list"`
+}
+
+type ArchiveExtractRequest struct {
+	Identity       string `json:"identity"`
+	TargetIdentity string `json:"targetIdentity"` // 空为根目录
+	Conflict       string `json:"conflict"`       // 同名冲突: rename(默认)/overwrite/skip/fail
+}
+
+type ArchiveExtractResponse struct {
+	JobIdentity string `json:"jobIdentity"`
+}
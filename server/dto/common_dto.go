@@ -0,0 +1,5 @@
+package dto
+
+type MsgResponse struct {
+	Msg string `json:"msg"`
+}
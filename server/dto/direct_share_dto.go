@@ -0,0 +1,44 @@
+package dto
+
+type DirectShareRequest struct {
+	Identity   string   `json:"identity"`   // 分享的文件或目录
+	Users      []string `json:"users"`      // 用户 identity
+	Emails     []string `json:"emails"`     // 邮箱, 可以是还没有注册的用户
+	Permission string   `json:"permission"` // view/edit
+}
+
+type DirectShareItem struct {
+	Identity   string `json:"identity"`
+	UserName   string `json:"userName"` // 按邮箱分享且对方还没有注册时为空
+	Email      string `json:"email"`
+	Permission string `json:"permission"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+type DirectShareListResponse struct {
+	List []DirectShareItem `json:"list"`
+}
+
+type DirectShareUpdateRequest struct {
+	Identity   string `json:"identity"` // DirectShareItem.Identity
+	Permission string `json:"permission"`
+}
+
+type DirectShareRevokeRequest struct {
+	Identities []string `json:"identities"`
+}
+
+type SharedItem struct {
+	UserFileItem
+	ShareIdentity string `json:"shareIdentity"`
+	Permission    string `json:"permission"`
+	Owner         string `json:"owner"`
+	SharedAt      int64  `json:"sharedAt"`
+}
+
+type SharedListResponse struct {
+	List     []SharedItem `json:"list"`
+	Count    int64        `json:"count"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"pageSize"`
+}
@@ -0,0 +1,64 @@
+package dto
+
+type FileRequestCreateRequest struct {
+	FolderIdentity string   `json:"folderIdentity"` // 上传到的目录, 空为根目录
+	Title          string   `json:"title"`
+	ExpireDays     int      `json:"expireDays"`  // 1/7/30, 0 为永久有效
+	MaxFileSize    int64    `json:"maxFileSize"` // 单个文件的大小上限(字节), 0 为不限制
+	Exts           []string `json:"exts"`        // 允许的扩展名, 空为不限制
+	MaxFiles       int      `json:"maxFiles"`    // 最多上传的文件数, 0 为不限制
+	Password       string   `json:"password"`    // 空为不需要密码
+}
+
+type FileRequestItem struct {
+	Identity    string        `json:"identity"`
+	URL         string        `json:"url"`
+	Title       string        `json:"title"`
+	Folder      *UserFileItem `json:"folder"`    // 根目录或目录已被删除时为空
+	ExpiredAt   int64         `json:"expiredAt"` // 0 为永久有效
+	MaxFileSize int64         `json:"maxFileSize"`
+	Exts        []string      `json:"exts"`
+	MaxFiles    int           `json:"maxFiles"`
+	HasPassword bool          `json:"hasPassword"`
+	Uploaded    int           `json:"uploaded"`
+	CreatedAt   int64         `json:"createdAt"`
+}
+
+type FileRequestListResponse struct {
+	List     []FileRequestItem `json:"list"`
+	Count    int64             `json:"count"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"pageSize"`
+}
+
+type FileRequestCloseRequest struct {
+	Identities []string `json:"identities"`
+}
+
+type FileRequestUploadItem struct {
+	Name         string        `json:"name"` // 上传时的文件名
+	Size         int64         `json:"size"`
+	UploaderName string        `json:"uploaderName"`
+	Ip           string        `json:"ip"`
+	File         *UserFileItem `json:"file"` // 文件已被删除时为空
+	CreatedAt    int64         `json:"createdAt"`
+}
+
+type FileRequestUploadListResponse struct {
+	List     []FileRequestUploadItem `json:"list"`
+	Count    int64                   `json:"count"`
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"pageSize"`
+}
+
+type FileRequestInfoResponse struct {
+	Identity    string   `json:"identity"`
+	Owner       string   `json:"owner"`
+	Title       string   `json:"title"`
+	ExpiredAt   int64    `json:"expiredAt"`
+	MaxFileSize int64    `json:"maxFileSize"`
+	Exts        []string `json:"exts"`
+	MaxFiles    int      `json:"maxFiles"`
+	Remaining   int      `json:"remaining"` // 还可以上传的文件数, MaxFiles 为 0 时为 -1
+	HasPassword bool     `json:"hasPassword"`
+}
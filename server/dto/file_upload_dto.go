@@ -14,3 +14,64 @@ type FileUploadResponse struct {
 	Ext      string `json:"ext"`
 	Name     string `json:"name"`
 }
+
+type FileUploadCheckRequest struct {
+	Hash           string `json:"hash"`
+	Size           int64  `json:"size"`
+	Name           string `json:"name"`
+	ParentIdentity string `json:"parentIdentity"`
+	FileIdentity   string `json:"fileIdentity"` // 可选, 覆盖该文件, 原内容保存为历史版本
+	Conflict       string `json:"conflict"`     // 可选, 同名冲突: fail(默认)/rename/overwrite/skip
+}
+
+type FileUploadCheckResponse struct {
+	Hit       bool             `json:"hit"` // 命中时已经创建好文件, 或者需要回答 challenge
+	Identity  string           `json:"identity,omitempty"`
+	Challenge *UploadChallenge `json:"challenge,omitempty"`
+}
+
+// UploadChallenge 客户端需要计算文件 [offset, offset+length) 区间的 md5
+type UploadChallenge struct {
+	Token  string `json:"challengeToken"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+type FileUploadProveRequest struct {
+	Token string `json:"challengeToken"`
+	Proof string `json:"proof"`
+}
+
+type ChunkUploadInitRequest struct {
+	Hash           string `json:"hash"`
+	Size           int64  `json:"size"`
+	Name           string `json:"name"`
+	ParentIdentity string `json:"parentIdentity"`
+	PartSize       int64  `json:"partSize"`     // 可选, 默认 5MB
+	FileIdentity   string `json:"fileIdentity"` // 可选, 覆盖该文件, 原内容保存为历史版本
+	Conflict       string `json:"conflict"`     // 可选, 同名冲突: fail(默认)/rename/overwrite/skip
+}
+
+type ChunkUploadInitResponse struct {
+	UploadIdentity string `json:"uploadIdentity"`
+	PartSize       int64  `json:"partSize"`
+	PartCount      int    `json:"partCount"`
+	ExpiredAt      int64  `json:"expiredAt"`
+}
+
+type ChunkUploadPart struct {
+	PartNumber int    `json:"partNumber"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
+
+type ChunkUploadPartsResponse struct {
+	UploadIdentity string            `json:"uploadIdentity"`
+	PartSize       int64             `json:"partSize"`
+	PartCount      int               `json:"partCount"`
+	Parts          []ChunkUploadPart `json:"parts"`
+}
+
+type ChunkUploadCompleteRequest struct {
+	UploadIdentity string `json:"uploadIdentity"`
+}
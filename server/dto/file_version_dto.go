@@ -0,0 +1,27 @@
+package dto
+
+type FileVersionItem struct {
+	Identity   string `json:"identity"` // 当前版本为空
+	Size       int64  `json:"size"`
+	Hash       string `json:"hash"`
+	ModifiedBy string `json:"modifiedBy"`
+	ModifiedAt int64  `json:"modifiedAt"`
+	Current    bool   `json:"current"`
+}
+
+type FileVersionListResponse struct {
+	List []FileVersionItem `json:"list"`
+}
+
+type FileVersionRestoreRequest struct {
+	Identity        string `json:"identity"`
+	VersionIdentity string `json:"versionIdentity"`
+}
+
+type UsageResponse struct {
+	Used     int64 `json:"used"`
+	Files    int64 `json:"files"`
+	Recycle  int64 `json:"recycle"`
+	Versions int64 `json:"versions"`
+	Quota    int64 `json:"quota"` // 空间上限, 0 为不限制
+}
@@ -0,0 +1,13 @@
+package dto
+
+type JobResponse struct {
+	Identity  string   `json:"identity"`
+	Type      string   `json:"type"`
+	Status    string   `json:"status"`
+	Total     int64    `json:"total"`
+	Done      int64    `json:"done"`
+	Error     string   `json:"error,omitempty"`
+	Result    []string `json:"result,omitempty"`
+	CreatedAt int64    `json:"createdAt"`
+	UpdatedAt int64    `json:"updatedAt"`
+}
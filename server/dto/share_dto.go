@@ -0,0 +1,64 @@
+package dto
+
+type ShareCreateRequest struct {
+	Identity     string `json:"identity"`     // 分享的文件或目录
+	ExpireDays   int    `json:"expireDays"`   // 1/7/30, 0 为永久有效
+	Code         string `json:"code"`         // 4 位提取码, 空为不需要
+	RandomCode   bool   `json:"randomCode"`   // 随机生成提取码, 忽略 code
+	MaxDownloads int    `json:"maxDownloads"` // 下载次数达到后链接失效, 0 为不限制
+}
+
+type ShareItem struct {
+	Identity     string        `json:"identity"`
+	URL          string        `json:"url"`
+	Code         string        `json:"code,omitempty"`
+	File         *UserFileItem `json:"file"`      // 分享的文件已被删除时为空
+	ExpiredAt    int64         `json:"expiredAt"` // 0 为永久有效
+	MaxDownloads int64         `json:"maxDownloads"`
+	Views        int64         `json:"views"` // 统计定期更新, 可能落后
+	Downloads    int64         `json:"downloads"`
+	CreatedAt    int64         `json:"createdAt"`
+}
+
+type ShareListResponse struct {
+	List     []ShareItem `json:"list"`
+	Count    int64       `json:"count"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+}
+
+type ShareCancelRequest struct {
+	Identities []string `json:"identities"`
+}
+
+type ShareInfoResponse struct {
+	Identity  string       `json:"identity"`
+	Owner     string       `json:"owner"`
+	File      UserFileItem `json:"file"`
+	ExpiredAt int64        `json:"expiredAt"`
+	CreatedAt int64        `json:"createdAt"`
+}
+
+type ShareStatDay struct {
+	Day       string `json:"day"` // 2006-01-02
+	Views     int64  `json:"views"`
+	Downloads int64  `json:"downloads"`
+	Bytes     int64  `json:"bytes"`
+}
+
+type ShareStatsResponse struct {
+	Identity     string         `json:"identity"`
+	Views        int64          `json:"views"`
+	Downloads    int64          `json:"downloads"`
+	Bytes        int64          `json:"bytes"`
+	MaxDownloads int64          `json:"maxDownloads"` // 0 为不限制
+	Series       []ShareStatDay `json:"series"`
+}
+
+type ShareSaveRequest struct {
+	Identity       string   `json:"identity"` // 分享标识
+	Code           string   `json:"code"`
+	Identities     []string `json:"identities"`     // 分享中要保存的文件和目录, 空为整个分享
+	TargetIdentity string   `json:"targetIdentity"` // 空为根目录
+	Conflict       string   `json:"conflict"`       // 同名冲突: fail(默认)/rename/overwrite/skip
+}
@@ -0,0 +1,27 @@
+package dto
+
+type TagItem struct {
+	Identity string `json:"identity"`
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+}
+
+type TagRequest struct {
+	Identity string `json:"identity"` // 修改和删除时使用
+	Name     string `json:"name"`
+	Color    string `json:"color"` // #RRGGBB
+}
+
+type TagListResponse struct {
+	List []TagItem `json:"list"`
+}
+
+type TagFilesRequest struct {
+	TagIdentity string   `json:"tagIdentity"`
+	Identities  []string `json:"identities"`
+}
+
+type FavoriteRequest struct {
+	Identities []string `json:"identities"`
+	Favorite   bool     `json:"favorite"` // false 为取消收藏
+}
@@ -0,0 +1,96 @@
+package dto
+
+type FolderCreateRequest struct {
+	ParentIdentity string `json:"parentIdentity"`
+	Name           string `json:"name"`
+}
+
+type UserFileItem struct {
+	Identity  string    `json:"identity"`
+	Name      string    `json:"name"`
+	Ext       string    `json:"ext"`
+	IsFolder  bool      `json:"isFolder"`
+	Size      int64     `json:"size"`
+	UpdatedAt int64     `json:"updatedAt"`
+	Favorite  bool      `json:"favorite"`
+	Tags      []TagItem `json:"tags,omitempty"`
+}
+
+type FolderListResponse struct {
+	List     []UserFileItem `json:"list"`
+	Count    int64          `json:"count"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+}
+
+type PathItem struct {
+	Identity string `json:"identity"`
+	Name     string `json:"name"`
+}
+
+type FolderPathResponse struct {
+	Path []PathItem `json:"path"`
+}
+
+type UserFileRenameRequest struct {
+	Identity string `json:"identity"`
+	Name     string `json:"name"`
+}
+
+type UserFileMoveRequest struct {
+	Identities     []string `json:"identities"`
+	TargetIdentity string   `json:"targetIdentity"` // 空为根目录
+	Conflict       string   `json:"conflict"`       // 同名冲突: fail(默认)/rename/overwrite/skip
+}
+
+type UserFileCopyResponse struct {
+	Identities  []string `json:"identities"`
+	JobIdentity string   `json:"jobIdentity,omitempty"` // 文件较多时在后台复制, 通过任务查询进度
+}
+
+type UserFileBatchRequest struct {
+	Identities []string `json:"identities"`
+}
+
+type RecycleItem struct {
+	Identity  string `json:"identity"`
+	Name      string `json:"name"`
+	IsFolder  bool   `json:"isFolder"`
+	Size      int64  `json:"size"`
+	Path      string `json:"path"` // 删除前所在的目录
+	DeletedAt int64  `json:"deletedAt"`
+	ExpiredAt int64  `json:"expiredAt"` // 之后自动彻底删除
+}
+
+type RecycleListResponse struct {
+	List     []RecycleItem `json:"list"`
+	Count    int64         `json:"count"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"pageSize"`
+}
+
+type RecycleRestoreRequest struct {
+	Identities []string `json:"identities"`
+	Conflict   string   `json:"conflict"` // 同名冲突: rename(默认)/overwrite/skip/fail
+}
+
+type RecycleRestoreResponse struct {
+	Identities []string `json:"identities"`
+}
+
+type FileSearchResponse struct {
+	List       []UserFileItem `json:"list"`
+	NextCursor string         `json:"nextCursor"` // 为空表示没有更多结果
+}
+
+type FullTextSearchItem struct {
+	UserFileItem
+	Snippet string `json:"snippet"` // 命中的部分用 <em></em> 包围, 其余内容已做 HTML 转义
+}
+
+type FullTextSearchResponse struct {
+	List     []FullTextSearchItem `json:"list"`
+	Count    int64                `json:"count"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"pageSize"`
+}
@@ -0,0 +1,31 @@
+package server
+
+// 网盘业务错误码
+const (
+	ParamErrCode = 20001 + iota
+	NotFoundErrCode
+	ChallengeErrCode
+	InvalidPartErrCode
+	UploadIncompleteErrCode
+	UploadInProgressErrCode
+	ChecksumErrCode
+	HashMismatchErrCode
+	GCRunningErrCode
+	NameExistsErrCode
+	CycleErrCode
+	TagExistsErrCode
+	TooManyEntriesErrCode
+	UnsupportedArchiveErrCode
+	ArchiveLimitErrCode
+	UnsafePathErrCode
+	ShareExpiredErrCode
+	ShareCodeErrCode
+	TooManyAttemptsErrCode
+	ShareExhaustedErrCode
+	QuotaExceededErrCode
+	RequestClosedErrCode
+	RequestFullErrCode
+	RequestPasswordErrCode
+	FileTooLargeErrCode
+	FileTypeErrCode
+)
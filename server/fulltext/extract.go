@@ -0,0 +1,142 @@
+package fulltext
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// 单个 XML 部件解压后的最大长度, 防止压缩炸弹
+const maxPartSize = 64 << 20
+
+var ErrUnsupported = errors.New("fulltext: unsupported file type")
+
+var plainExts = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".csv": true, ".log": true, ".rst": true,
+	".go": true, ".java": true, ".py": true, ".js": true, ".ts": true, ".jsx": true, ".tsx": true,
+	".c": true, ".h": true, ".cpp": true, ".hpp": true, ".cs": true, ".php": true, ".rb": true, ".rs": true,
+	".kt": true, ".swift": true, ".sh": true, ".sql": true, ".html": true, ".css": true, ".json": true,
+	".xml": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".vue": true,
+}
+
+// ooxmlParts 各类 OOXML 文件中包含文本的部件
+var ooxmlParts = map[string][]string{
+	".docx": {"word/document.xml", "word/header*.xml", "word/footer*.xml", "word/footnotes.xml"},
+	".xlsx": {"xl/sharedStrings.xml", "xl/worksheets/sheet*.xml"},
+	".pptx": {"ppt/slides/slide*.xml", "ppt/notesSlides/notesSlide*.xml"},
+}
+
+// Supported 是否支持提取该扩展名的文件
+func Supported(ext string) bool {
+	ext = strings.ToLower(ext)
+	_, ok := ooxmlParts[ext]
+	return ok || plainExts[ext]
+}
+
+// IsPlain 纯文本文件, 只需要读取开头的 limit 字节, 不需要完整下载
+func IsPlain(ext string) bool {
+	return plainExts[strings.ToLower(ext)]
+}
+
+// ExtractPlain 读取纯文本, 最多 limit 字节, 非 UTF-8 的字节被丢弃
+func ExtractPlain(r io.Reader, limit int) (string, error) {
+	b, err := io.ReadAll(io.LimitReader(r, int64(limit)))
+	if err != nil {
+		return "", err
+	}
+	// 截断处的半个字符也一并丢弃
+	return strings.ToValidUTF8(string(b), ""), nil
+}
+
+// ExtractOOXML 提取 docx/xlsx/pptx 中的文本, 最多 limit 字节
+func ExtractOOXML(r io.ReaderAt, size int64, ext string, limit int) (string, error) {
+	patterns, ok := ooxmlParts[strings.ToLower(ext)]
+	if !ok {
+		return "", ErrUnsupported
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", err
+	}
+	var files []*zip.File
+	for _, pattern := range patterns {
+		var matched []*zip.File
+		for _, f := range zr.File {
+			if ok, _ := path.Match(pattern, f.Name); ok {
+				matched = append(matched, f)
+			}
+		}
+		// slide2.xml 排在 slide10.xml 之前
+		sort.Slice(matched, func(i, j int) bool {
+			if len(matched[i].Name) != len(matched[j].Name) {
+				return len(matched[i].Name) < len(matched[j].Name)
+			}
+			return matched[i].Name < matched[j].Name
+		})
+		files = append(files, matched...)
+	}
+
+	var b strings.Builder
+	for _, f := range files {
+		if b.Len() >= limit {
+			break
+		}
+		if err := extractPart(f, &b, limit); err != nil {
+			return "", err
+		}
+	}
+	text := b.String()
+	if len(text) > limit {
+		text = strings.ToValidUTF8(text[:limit], "")
+	}
+	return text, nil
+}
+
+// extractPart 收集 XML 中 <t> 元素 (w:t, a:t, 表格的 t) 的文本, 段落和行之间换行
+func extractPart(f *zip.File, b *strings.Builder, limit int) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	d := xml.NewDecoder(io.LimitReader(rc, maxPartSize))
+	inText := false
+	for b.Len() < limit {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteByte('\t')
+			case "br":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p", "si", "row":
+				b.WriteByte('\n')
+			case "c":
+				b.WriteByte('\t')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+	return nil
+}
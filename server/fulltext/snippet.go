@@ -0,0 +1,80 @@
+package fulltext
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	snippetBefore = 30  // 第一个命中位置之前保留的字符数
+	snippetLength = 120 // 摘要的字符数
+)
+
+// Snippet 从 content 中截取第一个命中 terms 的片段, 命中的部分用 <em></em> 包围, 其余内容做 HTML 转义.
+// 没有命中时返回开头的片段
+func Snippet(content string, terms []string) string {
+	runes := []rune(strings.Join(strings.Fields(content), " "))
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		t := []rune(term)
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if !hasPrefix(lower[i:], t) {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				marked[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start := 0
+	if first > snippetBefore {
+		start = first - snippetBefore
+	}
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	for i := start; i < end; {
+		j := i + 1
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		text := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			text = "<em>" + text + "</em>"
+		}
+		b.WriteString(text)
+		i = j
+	}
+	if end < len(runes) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
+
+func hasPrefix(s, prefix []rune) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+// Package fulltext 全文检索的分词、文本提取和摘要高亮.
+//
+// 分词规则: 字母和数字组成的连续串作为一个词 (转小写); 中日韩文字没有空格分隔, 按单字和相邻两字 (bigram) 建索引,
+// 查询时两个字以上的连续串拆成 bigram, 全部命中即可匹配, 单字查询使用单字
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxTermLength 词的最大字节数, 超出的部分被截断
+const MaxTermLength = 64
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// scan 把 text 拆成词和中日韩文字串, 分别回调 word 和 cjk
+func scan(text string, word func(string), cjk func([]rune)) {
+	var w strings.Builder
+	var run []rune
+	flushWord := func() {
+		if w.Len() > 0 {
+			word(truncate(w.String()))
+			w.Reset()
+		}
+	}
+	flushRun := func() {
+		if len(run) > 0 {
+			cjk(run)
+			run = run[:0]
+		}
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			run = append(run, r)
+		case isWord(r):
+			flushRun()
+			w.WriteRune(unicode.ToLower(r))
+		default:
+			flushWord()
+			flushRun()
+		}
+	}
+	flushWord()
+	flushRun()
+}
+
+func truncate(term string) string {
+	if len(term) <= MaxTermLength {
+		return term
+	}
+	term = term[:MaxTermLength]
+	for !utf8.ValidString(term) {
+		term = term[:len(term)-1]
+	}
+	return term
+}
+
+// IndexTerms 建索引用的词和出现次数
+func IndexTerms(text string) map[string]int {
+	terms := make(map[string]int)
+	scan(text, func(w string) {
+		terms[w]++
+	}, func(run []rune) {
+		for i := range run {
+			terms[string(run[i])]++
+			if i+1 < len(run) {
+				terms[string(run[i:i+2])]++
+			}
+		}
+	})
+	return terms
+}
+
+// QueryTerms 查询用的词, 去重并保持顺序
+func QueryTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	add := func(term string) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	scan(query, add, func(run []rune) {
+		if len(run) == 1 {
+			add(string(run))
+			return
+		}
+		for i := 0; i+1 < len(run); i++ {
+			add(string(run[i : i+2]))
+		}
+	})
+	return terms
+}
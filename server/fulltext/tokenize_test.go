@@ -0,0 +1,107 @@
+package fulltext
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndexTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want map[string]int
+	}{
+		{"Hello, hello World2", map[string]int{"hello": 2, "world2": 1}},
+		{"网盘", map[string]int{"网": 1, "盘": 1, "网盘": 1}},
+		{"上传文件", map[string]int{"上": 1, "传": 1, "文": 1, "件": 1, "上传": 1, "传文": 1, "文件": 1}},
+		{"Go语言", map[string]int{"go": 1, "语": 1, "言": 1, "语言": 1}},
+		// 标点分隔的两段不组成 bigram
+		{"文，件", map[string]int{"文": 1, "件": 1}},
+		{"", map[string]int{}},
+	}
+	for _, tt := range tests {
+		if got := IndexTerms(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("IndexTerms(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"Hello world hello", []string{"hello", "world"}},
+		{"网", []string{"网"}},
+		{"网盘", []string{"网盘"}},
+		{"上传文件", []string{"上传", "传文", "文件"}},
+		{"文件 文件", []string{"文件"}},
+		{"report 报告", []string{"report", "报告"}},
+		{"!!", nil},
+	}
+	for _, tt := range tests {
+		if got := QueryTerms(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("QueryTerms(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// 查询词都应该出现在包含该查询的文本的索引中
+func TestQueryMatchesIndex(t *testing.T) {
+	index := IndexTerms("分享给客户的季度报告 Q3 Report")
+	for _, query := range []string{"季度报告", "报告", "告", "report", "q3"} {
+		for _, term := range QueryTerms(query) {
+			if index[term] == 0 {
+				t.Errorf("query %q term %q not indexed", query, term)
+			}
+		}
+	}
+}
+
+func TestTruncateTerm(t *testing.T) {
+	long := strings.Repeat("a", MaxTermLength+10)
+	for term := range IndexTerms(long) {
+		if len(term) != MaxTermLength {
+			t.Errorf("term length = %d, want %d", len(term), MaxTermLength)
+		}
+	}
+	// 多字节字母截断时不能留下半个字符
+	for term := range IndexTerms(strings.Repeat("é", MaxTermLength)) {
+		if len(term) > MaxTermLength || !strings.HasSuffix(term, "é") {
+			t.Errorf("term %q truncated in the middle of a rune", term)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		terms   []string
+		want    string
+	}{
+		{"highlight", "hello world", []string{"world"}, "hello <em>world</em>"},
+		{"case insensitive", "Hello World", []string{"hello"}, "<em>Hello</em> World"},
+		{"cjk", "上传文件到网盘", []string{"文件"}, "上传<em>文件</em>到网盘"},
+		{"escape", "<b>a&b</b> key", []string{"key"}, "&lt;b&gt;a&amp;b&lt;/b&gt; <em>key</em>"},
+		{"escape match", "x <script> y", []string{"script"}, "x &lt;<em>script</em>&gt; y"},
+		{"no match", "nothing here", []string{"zzz"}, "nothing here"},
+		{"collapse spaces", "a \n\t b", nil, "a b"},
+	}
+	for _, tt := range tests {
+		if got := Snippet(tt.content, tt.terms); got != tt.want {
+			t.Errorf("%s: Snippet = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSnippetWindow(t *testing.T) {
+	content := strings.Repeat("x ", 100) + "target" + strings.Repeat(" y", 100)
+	got := Snippet(content, []string{"target"})
+	if !strings.HasPrefix(got, "...") || !strings.HasSuffix(got, "...") || !strings.Contains(got, "<em>target</em>") {
+		t.Errorf("Snippet = %q", got)
+	}
+	if n := len([]rune(strings.NewReplacer("<em>", "", "</em>", "", "...", "").Replace(got))); n != snippetLength {
+		t.Errorf("snippet length = %d, want %d", n, snippetLength)
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/service"
+)
+
+type AdminHandler struct {
+}
+
+// RunGC 立即运行一次文件回收, dryRun 时只返回统计结果
+func (h *AdminHandler) RunGC(c echo.Context) error {
+	var req dto.GCRequest
+	if err := c.Bind(&req); err != nil {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	report, err := service.RunGC(c.Request().Context(), req.DryRun)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// GCReport 最近一次回收的结果
+func (h *AdminHandler) GCReport(c echo.Context) error {
+	report, err := service.LastGCReport(c.Request().Context())
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
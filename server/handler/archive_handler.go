@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/service"
+)
+
+type ArchiveHandler struct {
+}
+
+// List 列出压缩包 (zip/tar/tar.gz/tar.zst) 中的文件和目录, 不解压
+func (h *ArchiveHandler) List(c echo.Context) error {
+	identity := c.QueryParam("identity")
+	if identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	uf, err := service.GetUserFile(getUserIdentity(c), identity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	entries, err := service.ListArchive(c.Request().Context(), uf)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	list := make([]dto.ArchiveEntryItem, 0, len(entries))
+	for _, e := range entries {
+		item := dto.ArchiveEntryItem{Path: e.Path, IsDir: e.IsDir, Size: e.Size}
+		if !e.ModTime.IsZero() {
+			item.ModTime = e.ModTime.Unix()
+		}
+		list = append(list, item)
+	}
+	return c.JSON(http.StatusOK, dto.ArchiveListResponse{List: list})
+}
+
+// Extract 在后台把压缩包解压到目标目录, 返回任务
+func (h *ArchiveHandler) Extract(c echo.Context) error {
+	var req dto.ArchiveExtractRequest
+	if err := c.Bind(&req); err != nil || req.Identity == "" || !service.ValidConflictPolicy(req.Conflict) {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	userIdentity := getUserIdentity(c)
+	uf, err := service.GetUserFile(userIdentity, req.Identity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	targetId, err := service.GetParentId(userIdentity, req.TargetIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	job, err := service.ExtractArchive(userIdentity, uf, targetId, req.Conflict)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.ArchiveExtractResponse{JobIdentity: job.Identity})
+}
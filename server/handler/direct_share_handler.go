@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/models"
+	"net_disk/server/service"
+)
+
+type DirectShareHandler struct {
+}
+
+// Share 把自己的文件或目录分享给用户和邮箱, 已经分享过的修改为新的权限
+func (h *DirectShareHandler) Share(c echo.Context) error {
+	var req dto.DirectShareRequest
+	if err := c.Bind(&req); err != nil || req.Identity == "" || len(req.Users)+len(req.Emails) == 0 ||
+		!service.ValidPermission(req.Permission) {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	shares, err := service.ShareWithUsers(getUserIdentity(c), req.Identity, req.Users, req.Emails, req.Permission)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.DirectShareListResponse{List: make([]dto.DirectShareItem, 0, len(shares))}
+	for i := range shares {
+		resp.List = append(resp.List, toDirectShareItem(&shares[i], ""))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Recipients 自己的文件或目录分享给了哪些用户, 参数: identity
+func (h *DirectShareHandler) Recipients(c echo.Context) error {
+	identity := c.QueryParam("identity")
+	if identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	items, err := service.ListRecipients(getUserIdentity(c), identity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.DirectShareListResponse{List: make([]dto.DirectShareItem, 0, len(items))}
+	for i := range items {
+		resp.List = append(resp.List, toDirectShareItem(&items[i].DirectShare, items[i].UserName))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Update 修改被分享者的权限
+func (h *DirectShareHandler) Update(c echo.Context) error {
+	var req dto.DirectShareUpdateRequest
+	if err := c.Bind(&req); err != nil || req.Identity == "" || !service.ValidPermission(req.Permission) {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	if err := service.UpdateDirectShare(getUserIdentity(c), req.Identity, req.Permission); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.MsgResponse{Msg: "ok"})
+}
+
+// Revoke 取消分享, 被分享者立即失去访问权限
+func (h *DirectShareHandler) Revoke(c echo.Context) error {
+	var req dto.DirectShareRevokeRequest
+	if err := c.Bind(&req); err != nil || len(req.Identities) == 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	if err := service.RevokeDirectShares(getUserIdentity(c), req.Identities); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.MsgResponse{Msg: "ok"})
+}
+
+// SharedWithMe 别人直接分享给当前用户的文件和目录, 最近分享的在前
+func (h *DirectShareHandler) SharedWithMe(c echo.Context) error {
+	page, pageSize := getPage(c)
+	items, count, err := service.ListSharedWithMe(getUserIdentity(c), page, pageSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.SharedListResponse{
+		List:     make([]dto.SharedItem, 0, len(items)),
+		Count:    count,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for _, item := range items {
+		resp.List = append(resp.List, dto.SharedItem{
+			UserFileItem:  toPublicFileItem(&item.UserFile, item.Size),
+			ShareIdentity: item.ShareIdentity,
+			Permission:    item.Permission,
+			Owner:         item.OwnerName,
+			SharedAt:      item.SharedAt.Unix(),
+		})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func toDirectShareItem(share *models.DirectShare, userName string) dto.DirectShareItem {
+	return dto.DirectShareItem{
+		Identity:   share.Identity,
+		UserName:   userName,
+		Email:      share.Email,
+		Permission: share.Permission,
+		CreatedAt:  share.CreatedAt.Unix(),
+	}
+}
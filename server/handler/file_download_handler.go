@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/server/service"
+	"net_disk/tool"
+)
+
+// 系统 mime 表里经常缺少的音视频类型, 播放器拖动进度依赖正确的 Content-Type
+var mediaTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+	".avi":  "video/x-msvideo",
+	".flv":  "video/x-flv",
+	".ts":   "video/mp2t",
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+	".txt":  "text/plain; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+}
+
+type FileDownloadHandler struct {
+}
+
+// Download 下载文件. Range/If-Range/多区间/If-None-Match/If-Modified-Since 由 http.ServeContent 处理,
+// inline=true 时浏览器直接打开 (在线播放), 只对图片、PDF、音视频和纯文本生效
+func (h *FileDownloadHandler) Download(c echo.Context) error {
+	identity := c.QueryParam("identity")
+	if identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	uf, err := service.GetUserFile(getUserIdentity(c), identity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if uf.RepositoryIdentity == "" {
+		return errorResponse(c, server.NotFoundErrCode)
+	}
+	fi, err := service.GetFileInfo(uf.RepositoryIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return serveBlob(c, fi, uf.UserIdentity, uf.Name, service.ModTime(uf))
+}
+
+// Zip 把文件和目录打包成 zip 下载, 参数: identities(逗号分隔). 压缩包边生成边返回, 不支持断点续传
+func (h *FileDownloadHandler) Zip(c echo.Context) error {
+	identities := splitParam(c.QueryParam("identities"))
+	if len(identities) == 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	userIdentity := getUserIdentity(c)
+	entries, err := service.CollectZipEntries(userIdentity, identities)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	name := "download.zip"
+	if len(identities) == 1 {
+		name = strings.TrimSuffix(entries[0].Path, "/") + ".zip"
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "application/zip")
+	header.Set(echo.HeaderContentDisposition, contentDisposition("attachment", name))
+	c.Response().WriteHeader(http.StatusOK)
+	if err := service.WriteZip(c.Request().Context(), c.Response(), entries); err != nil {
+		// 响应已经开始, 无法再返回错误码, 客户端得到的压缩包缺少目录区, 解压时会报错
+		tool.Logger.Errorf("write zip error: %v", err)
+	}
+	return nil
+}
+
+// serveBlob 以 keyOwner 的身份读取 fi 的内容作为 name 返回, ETag 为内容的 hash
+func serveBlob(c echo.Context, fi *models.FileInfo, keyOwner, name string, modTime time.Time) error {
+	reader, err := service.NewBlobReader(c.Request().Context(), fi, keyOwner)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	defer reader.Close()
+
+	header := c.Response().Header()
+	header.Set("ETag", `"`+fi.Hash+`"`)
+	// 文件内容由用户上传, 不让浏览器猜测类型; 只有不会执行脚本的类型才能在浏览器中直接打开
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	contentType := fileContentType(path.Ext(name))
+	disposition := "attachment"
+	if !inlineAllowed(contentType) {
+		contentType = echo.MIMEOctetStream
+	} else if c.QueryParam("inline") == "true" {
+		disposition = "inline"
+	}
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set(echo.HeaderContentDisposition, contentDisposition(disposition, name))
+	http.ServeContent(c.Response(), c.Request(), name, modTime, reader)
+	return nil
+}
+
+// fileContentType 按扩展名取 Content-Type, 未知类型返回空串
+func fileContentType(ext string) string {
+	ext = strings.ToLower(ext)
+	if contentType, ok := mediaTypes[ext]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// inlineAllowed 可以 inline 返回的类型: 图片(SVG 可以带脚本, 除外)、PDF、音视频和纯文本
+func inlineAllowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		return true
+	}
+	switch mediaType {
+	case "application/pdf", "text/plain", "application/vnd.apple.mpegurl":
+		return true
+	}
+	return false
+}
+
+// contentDisposition 按 RFC 6266 生成 Content-Disposition: filename 为 ASCII 兜底, filename* 为 RFC 5987 编码的原文件名
+func contentDisposition(disposition, name string) string {
+	var fallback, encoded strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' || r == '%' {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+	for _, b := range []byte(name) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback.String(), encoded.String())
+}
+
+// isAttrChar RFC 5987 中不需要编码的字符
+func isAttrChar(b byte) bool {
+	if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' {
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/models"
+	"net_disk/server/service"
+)
+
+type FileRequestHandler struct {
+}
+
+// Create 为自己的目录创建文件收集链接
+func (h *FileRequestHandler) Create(c echo.Context) error {
+	var req dto.FileRequestCreateRequest
+	if err := c.Bind(&req); err != nil || !service.ValidShareDays(req.ExpireDays) || req.MaxFileSize < 0 || req.MaxFiles < 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	userIdentity := getUserIdentity(c)
+	folderId, err := service.GetParentId(userIdentity, req.FolderIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	fr, err := service.CreateFileRequest(userIdentity, folderId, service.FileRequestOptions{
+		Title:       req.Title,
+		Days:        req.ExpireDays,
+		MaxFileSize: req.MaxFileSize,
+		Exts:        req.Exts,
+		MaxFiles:    req.MaxFiles,
+		Password:    req.Password,
+	})
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, toFileRequestItem(fr))
+}
+
+// List 当前用户的收集链接, 最近创建的在前
+func (h *FileRequestHandler) List(c echo.Context) error {
+	page, pageSize := getPage(c)
+	items, count, err := service.ListFileRequests(getUserIdentity(c), page, pageSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.FileRequestListResponse{
+		List:     make([]dto.FileRequestItem, 0, len(items)),
+		Count:    count,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for i := range items {
+		item := toFileRequestItem(&items[i].FileRequest)
+		if folder := items[i].Folder; folder != nil {
+			file := toUserFileItem(folder, 0)
+			item.Folder = &file
+		}
+		resp.List = append(resp.List, item)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Close 关闭收集链接, 已经上传的文件保留
+func (h *FileRequestHandler) Close(c echo.Context) error {
+	var req dto.FileRequestCloseRequest
+	if err := c.Bind(&req); err != nil || len(req.Identities) == 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	if err := service.CloseFileRequests(getUserIdentity(c), req.Identities); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.MsgResponse{Msg: "ok"})
+}
+
+// Uploads 收集链接收到的文件和上传者, 参数: identity, page, pageSize
+func (h *FileRequestHandler) Uploads(c echo.Context) error {
+	identity := c.QueryParam("identity")
+	if identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	page, pageSize := getPage(c)
+	items, count, err := service.ListFileRequestUploads(getUserIdentity(c), identity, page, pageSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.FileRequestUploadListResponse{
+		List:     make([]dto.FileRequestUploadItem, 0, len(items)),
+		Count:    count,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for i := range items {
+		upload := &items[i].FileRequestUpload
+		item := dto.FileRequestUploadItem{
+			Name:         upload.Name,
+			Size:         upload.Size,
+			UploaderName: upload.UploaderName,
+			Ip:           upload.Ip,
+			CreatedAt:    upload.CreatedAt.Unix(),
+		}
+		if uf := items[i].UserFile; uf != nil {
+			file := toUserFileItem(uf, upload.Size)
+			item.File = &file
+		}
+		resp.List = append(resp.List, item)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Info 公开接口, 返回收集链接的创建者和限制, 参数: identity
+func (h *FileRequestHandler) Info(c echo.Context) error {
+	identity := c.QueryParam("identity")
+	if identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	fr, err := service.GetFileRequest(identity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	owner, err := service.UserName(fr.UserIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	item := toFileRequestItem(fr)
+	remaining := -1
+	if fr.MaxFiles > 0 {
+		remaining = fr.MaxFiles - fr.Uploaded
+		if remaining < 0 {
+			remaining = 0
+		}
+	}
+	return c.JSON(http.StatusOK, dto.FileRequestInfoResponse{
+		Identity:    fr.Identity,
+		Owner:       owner,
+		Title:       fr.Title,
+		ExpiredAt:   item.ExpiredAt,
+		MaxFileSize: fr.MaxFileSize,
+		Exts:        item.Exts,
+		MaxFiles:    fr.MaxFiles,
+		Remaining:   remaining,
+		HasPassword: item.HasPassword,
+	})
+}
+
+// Upload 公开接口, 匿名上传一个文件. 参数: identity, 表单字段: password(可选), name(上传者的名字, 可选), file
+func (h *FileRequestHandler) Upload(c echo.Context) error {
+	identity := c.QueryParam("identity")
+	if identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	fr, err := service.GetFileRequest(identity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if fr.MaxFiles > 0 && fr.Uploaded >= fr.MaxFiles {
+		return serviceErrorResponse(c, service.ErrRequestFull)
+	}
+	// 确认链接有效后才读取 body, 并按链接的文件大小限制 body 的长度
+	req := c.Request()
+	if fr.MaxFileSize > 0 {
+		limit := fr.MaxFileSize + service.MaxRequestFormOverhead
+		if req.ContentLength > limit {
+			return serviceErrorResponse(c, service.ErrFileTooLarge)
+		}
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, limit)
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return serviceErrorResponse(c, service.ErrFileTooLarge)
+		}
+		return errorResponse(c, server.ParamErrCode)
+	}
+	uploaderName := strings.TrimSpace(c.FormValue("name"))
+	if utf8.RuneCountInString(uploaderName) > service.MaxUploaderName {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	ctx := req.Context()
+	if err := service.CheckRequestPassword(ctx, fr, c.FormValue("password"), c.RealIP()); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	defer file.Close()
+
+	uf, err := service.UploadToRequest(ctx, fr, file, fileHeader.Size, fileHeader.Filename, uploaderName, c.RealIP())
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.FileUploadResponse{
+		Identity: uf.Identity,
+		Ext:      uf.Ext,
+		Name:     uf.Name,
+	})
+}
+
+func toFileRequestItem(fr *models.FileRequest) dto.FileRequestItem {
+	item := dto.FileRequestItem{
+		Identity:    fr.Identity,
+		URL:         service.FileRequestURL(fr),
+		Title:       fr.Title,
+		MaxFileSize: fr.MaxFileSize,
+		Exts:        service.RequestExts(fr),
+		MaxFiles:    fr.MaxFiles,
+		HasPassword: fr.Password != "",
+		Uploaded:    fr.Uploaded,
+		CreatedAt:   fr.CreatedAt.Unix(),
+	}
+	if !fr.ExpiredAt.IsZero() {
+		item.ExpiredAt = fr.ExpiredAt.Unix()
+	}
+	return item
+}
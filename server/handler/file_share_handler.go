@@ -1 +1,307 @@
 package handler
+
+import (
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/models"
+	"net_disk/server/service"
+)
+
+type FileShareHandler struct {
+}
+
+// Create 分享自己的文件或目录, 返回分享链接
+func (h *FileShareHandler) Create(c echo.Context) error {
+	var req dto.ShareCreateRequest
+	if err := c.Bind(&req); err != nil || req.Identity == "" || !service.ValidShareDays(req.ExpireDays) ||
+		!service.ValidShareCode(req.Code) || req.MaxDownloads < 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	share, err := service.CreateShare(getUserIdentity(c), req.Identity, req.ExpireDays, req.Code, req.RandomCode, req.MaxDownloads)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, toShareItem(share))
+}
+
+// List 当前用户的分享, 最近创建的在前
+func (h *FileShareHandler) List(c echo.Context) error {
+	page, pageSize := getPage(c)
+	items, count, err := service.ListShares(getUserIdentity(c), page, pageSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.ShareListResponse{
+		List:     make([]dto.ShareItem, 0, len(items)),
+		Count:    count,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for i := range items {
+		item := toShareItem(&items[i].FileShare)
+		if uf := items[i].UserFile; uf != nil {
+			file := toUserFileItem(uf, 0)
+			item.File = &file
+		}
+		resp.List = append(resp.List, item)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Cancel 取消分享
+func (h *FileShareHandler) Cancel(c echo.Context) error {
+	var req dto.ShareCancelRequest
+	if err := c.Bind(&req); err != nil || len(req.Identities) == 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	if err := service.CancelShares(getUserIdentity(c), req.Identities); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.MsgResponse{Msg: "ok"})
+}
+
+// resolveShare 公开接口的公共参数: identity(分享标识), code(提取码)
+func resolveShare(c echo.Context) (*models.FileShare, error) {
+	identity := c.QueryParam("identity")
+	if identity == "" {
+		return nil, service.ErrNotFound
+	}
+	return service.ResolveShare(c.Request().Context(), identity, c.QueryParam("code"), c.RealIP())
+}
+
+// Info 公开接口, 校验提取码后返回分享者和分享的文件或目录
+func (h *FileShareHandler) Info(c echo.Context) error {
+	share, err := resolveShare(c)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	uf, err := service.ShareFile(share, "")
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	var size int64
+	if !service.IsFolder(uf) {
+		fi, err := service.GetFileInfo(uf.RepositoryIdentity)
+		if err != nil {
+			return serviceErrorResponse(c, err)
+		}
+		size = fi.Size
+	}
+	owner, err := service.ShareOwnerName(share)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	service.RecordShareView(c.Request().Context(), share)
+	item := toShareItem(share)
+	return c.JSON(http.StatusOK, dto.ShareInfoResponse{
+		Identity:  share.Identity,
+		Owner:     owner,
+		File:      toPublicFileItem(uf, size),
+		ExpiredAt: item.ExpiredAt,
+		CreatedAt: item.CreatedAt,
+	})
+}
+
+// Files 公开接口, 列出分享的目录或其子目录, 参数: identity, code, folder(空为分享的根目录), page, pageSize, sort, order
+func (h *FileShareHandler) Files(c echo.Context) error {
+	page, pageSize := getPage(c)
+	sort := c.QueryParam("sort")
+	if sort != "" && sort != service.SortByName && sort != service.SortBySize && sort != service.SortByTime {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	share, err := resolveShare(c)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	items, count, err := service.ListShareFolder(share, c.QueryParam("folder"), sort, c.QueryParam("order") == "desc", page, pageSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	list := make([]dto.UserFileItem, 0, len(items))
+	for i := range items {
+		list = append(list, toPublicFileItem(&items[i].UserFile, items[i].Size))
+	}
+	return c.JSON(http.StatusOK, dto.FolderListResponse{List: list, Count: count, Page: page, PageSize: pageSize})
+}
+
+// Download 公开接口, 下载分享中的文件, 参数: identity, code, file(空为分享的根), inline.
+// 返回整个文件的请求计一次下载; 分段请求按客户端累计下载的字节数, 累计到文件大小时计一次, 见 downloadRange.
+// 每个请求 (包括续传) 都在 resolveShare 中检查下载次数, 达到限制后续传也不再允许
+func (h *FileShareHandler) Download(c echo.Context) error {
+	share, err := resolveShare(c)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	uf, err := service.ShareFile(share, c.QueryParam("file"))
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if service.IsFolder(uf) {
+		return errorResponse(c, server.NotFoundErrCode)
+	}
+	fi, err := service.GetFileInfo(uf.RepositoryIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	ctx := c.Request().Context()
+	full, covered := downloadRange(c.Request().Header, fi.Size)
+	if full {
+		err = service.AcquireShareDownload(ctx, share)
+	} else if covered > 0 {
+		err = service.AcquireShareRange(ctx, share, fi.Identity, c.RealIP(), covered, fi.Size)
+	}
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	err = serveBlob(c, fi, share.UserIdentity, uf.Name, service.ModTime(uf))
+	service.RecordShareBytes(ctx, share, c.Response().Size)
+	return err
+}
+
+// Stats 自己分享的访问统计, 参数: identity, days(最近的天数, 默认 30, 最多 service.MaxStatDays)
+func (h *FileShareHandler) Stats(c echo.Context) error {
+	identity := c.QueryParam("identity")
+	if identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	days := 30
+	if v := c.QueryParam("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > service.MaxStatDays {
+			return errorResponse(c, server.ParamErrCode)
+		}
+		days = n
+	}
+	stats, err := service.GetShareStats(c.Request().Context(), getUserIdentity(c), identity, days)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.ShareStatsResponse{
+		Identity:     stats.Share.Identity,
+		Views:        stats.Views,
+		Downloads:    stats.Downloads,
+		Bytes:        stats.Bytes,
+		MaxDownloads: int64(stats.Share.MaxDownloads),
+		Series:       make([]dto.ShareStatDay, 0, len(stats.Series)),
+	}
+	for _, s := range stats.Series {
+		resp.Series = append(resp.Series, dto.ShareStatDay{Day: s.Day, Views: s.Views, Downloads: s.Downloads, Bytes: s.Bytes})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Save 把别人分享的文件和目录保存到自己的目录, 文件较多时返回后台任务
+func (h *FileShareHandler) Save(c echo.Context) error {
+	var req dto.ShareSaveRequest
+	if err := c.Bind(&req); err != nil || req.Identity == "" || !service.ValidConflictPolicy(req.Conflict) {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	share, err := service.ResolveShare(c.Request().Context(), req.Identity, req.Code, c.RealIP())
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	userIdentity := getUserIdentity(c)
+	targetId, err := service.GetParentId(userIdentity, req.TargetIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	identities, job, err := service.SaveShare(userIdentity, share, req.Identities, targetId, req.Conflict)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.UserFileCopyResponse{Identities: identities}
+	if job != nil {
+		resp.Identities = []string{}
+		resp.JobIdentity = job.Identity
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// downloadRange 按 http.ServeContent 的规则解析 Range: 没有 Range、带 If-Range (可能返回整个文件)、
+// 区间总长度超过文件大小 (ServeContent 会返回整个文件) 时 full 为 true, 否则 covered 为区间覆盖的字节数.
+// Range 格式错误时 ServeContent 返回 416, covered 为 0
+func downloadRange(header http.Header, size int64) (full bool, covered int64) {
+	r := header.Get("Range")
+	if r == "" || header.Get("If-Range") != "" {
+		return true, 0
+	}
+	const prefix = "bytes="
+	if !strings.HasPrefix(r, prefix) {
+		return false, 0
+	}
+	var total int64
+	for _, ra := range strings.Split(r[len(prefix):], ",") {
+		ra = textproto.TrimString(ra)
+		if ra == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(ra, "-")
+		if !ok {
+			return false, 0
+		}
+		start, end = textproto.TrimString(start), textproto.TrimString(end)
+		if start == "" {
+			// bytes=-N 为文件最后 N 个字节
+			n, err := strconv.ParseInt(end, 10, 64)
+			if err != nil || n < 0 {
+				return false, 0
+			}
+			if n > size {
+				n = size
+			}
+			total += n
+			continue
+		}
+		i, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || i < 0 {
+			return false, 0
+		}
+		j := size - 1
+		if end != "" {
+			if j, err = strconv.ParseInt(end, 10, 64); err != nil || i > j {
+				return false, 0
+			}
+			if j >= size {
+				j = size - 1
+			}
+		}
+		if i >= size {
+			continue
+		}
+		total += j - i + 1
+	}
+	if total > size {
+		return true, 0
+	}
+	return false, total
+}
+
+// toPublicFileItem 给访问者看的文件信息, 不包含分享者的收藏和标签
+func toPublicFileItem(uf *models.UserFile, size int64) dto.UserFileItem {
+	item := toUserFileItem(uf, size)
+	item.Favorite = false
+	return item
+}
+
+func toShareItem(share *models.FileShare) dto.ShareItem {
+	item := dto.ShareItem{
+		Identity:     share.Identity,
+		URL:          service.ShareURL(share),
+		Code:         share.Code,
+		MaxDownloads: int64(share.MaxDownloads),
+		Views:        share.Views,
+		Downloads:    share.Downloads,
+		CreatedAt:    share.CreatedAt.Unix(),
+	}
+	if !share.ExpiredAt.IsZero() {
+		item.ExpiredAt = share.ExpiredAt.Unix()
+	}
+	return item
+}
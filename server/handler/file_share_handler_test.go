@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDownloadRange(t *testing.T) {
+	const size = 1000
+	tests := []struct {
+		rangeHeader string
+		ifRange     string
+		full        bool
+		covered     int64
+	}{
+		{"", "", true, 0},
+		{"bytes=0-", "\"etag\"", true, 0},
+		{"bytes=0-", "", false, 1000},
+		{"bytes=1-", "", false, 999},
+		{"bytes=0-99", "", false, 100},
+		{"bytes=900-2000", "", false, 100},
+		{"bytes=-100", "", false, 100},
+		{"bytes=-2000", "", false, 1000},
+		{"bytes=0-99, 200-299", "", false, 200},
+		{"bytes=0-, 1-", "", true, 0},
+		{"bytes=1000-", "", false, 0},
+		{"bytes=5-1", "", false, 0},
+		{"bytes=a-", "", false, 0},
+		{"items=0-", "", false, 0},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.rangeHeader != "" {
+			header.Set("Range", tt.rangeHeader)
+		}
+		if tt.ifRange != "" {
+			header.Set("If-Range", tt.ifRange)
+		}
+		full, covered := downloadRange(header, size)
+		if full != tt.full || covered != tt.covered {
+			t.Errorf("downloadRange(%q, %q) = %v, %d, want %v, %d", tt.rangeHeader, tt.ifRange, full, covered, tt.full, tt.covered)
+		}
+	}
+}
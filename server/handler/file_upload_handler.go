@@ -1 +1,241 @@
 package handler
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/service"
+)
+
+type FileUploadHandler struct {
+}
+
+// Upload 普通上传, 表单字段: file, parentIdentity, hash(可选), fileIdentity(可选, 覆盖该文件),
+// conflict(可选, 同名冲突的处理方式)
+func (h *FileUploadHandler) Upload(c echo.Context) error {
+	userIdentity := getUserIdentity(c)
+	fileHeader, err := c.FormFile("file")
+	conflict := c.FormValue("conflict")
+	if err != nil || !service.ValidConflictPolicy(conflict) {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	target, err := service.ResolveFileTarget(userIdentity, c.FormValue("parentIdentity"), fileHeader.Filename, c.FormValue("fileIdentity"), conflict)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if err := service.CheckUploadQuota(userIdentity, target, fileHeader.Size); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	defer file.Close()
+
+	ctx := c.Request().Context()
+	fi, err := service.SaveBlob(ctx, userIdentity, file, fileHeader.Size, fileHeader.Filename, c.FormValue("hash"))
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	unlock, err := service.LockQuota(ctx, target.Owner)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	defer unlock()
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	uf, err := service.SaveUserFile(session, userIdentity, target, fi)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if err := session.Commit(); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, dto.FileUploadResponse{
+		Identity: uf.Identity,
+		Ext:      uf.Ext,
+		Name:     uf.Name,
+	})
+}
+
+// Check 秒传检查, 文件内容已存在时直接创建文件, 不需要上传
+func (h *FileUploadHandler) Check(c echo.Context) error {
+	var req dto.FileUploadCheckRequest
+	if err := c.Bind(&req); err != nil || req.Hash == "" || (req.Name == "" && req.FileIdentity == "") || req.Size < 0 ||
+		!service.ValidConflictPolicy(req.Conflict) {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	userIdentity := getUserIdentity(c)
+	target, err := service.ResolveFileTarget(userIdentity, req.ParentIdentity, req.Name, req.FileIdentity, req.Conflict)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	uf, challenge, err := service.InstantUpload(userIdentity, target, req.Hash, req.Size)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	resp := dto.FileUploadCheckResponse{}
+	if uf != nil {
+		resp.Hit = true
+		resp.Identity = uf.Identity
+	}
+	if challenge != nil {
+		resp.Hit = true
+		resp.Challenge = &dto.UploadChallenge{
+			Token:  challenge.Token,
+			Offset: challenge.Offset,
+			Length: challenge.Length,
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Prove 回答秒传的 challenge
+func (h *FileUploadHandler) Prove(c echo.Context) error {
+	var req dto.FileUploadProveRequest
+	if err := c.Bind(&req); err != nil || req.Token == "" || req.Proof == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+
+	uf, err := service.ProveInstantUpload(c.Request().Context(), getUserIdentity(c), req.Token, req.Proof)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.FileUploadCheckResponse{Hit: true, Identity: uf.Identity})
+}
+
+// ChunkInit 创建分片上传会话
+func (h *FileUploadHandler) ChunkInit(c echo.Context) error {
+	var req dto.ChunkUploadInitRequest
+	if err := c.Bind(&req); err != nil || (req.Name == "" && req.FileIdentity == "") || req.Size < 0 ||
+		!service.ValidConflictPolicy(req.Conflict) {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	userIdentity := getUserIdentity(c)
+	target, err := service.ResolveFileTarget(userIdentity, req.ParentIdentity, req.Name, req.FileIdentity, req.Conflict)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	session, err := service.InitUploadSession(c.Request().Context(), userIdentity, target, req.Hash, req.Size, req.PartSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.ChunkUploadInitResponse{
+		UploadIdentity: session.Identity,
+		PartSize:       session.PartSize,
+		PartCount:      session.PartCount(),
+		ExpiredAt:      session.ExpiredAt.Unix(),
+	})
+}
+
+// ChunkPart 上传一个分片, body 为分片内容 (application/octet-stream), 必须带 Content-Length.
+// query 参数: uploadIdentity, partNumber; 可选的 Content-MD5 (base64) 和 X-Content-Sha256 (hex) 头用于校验分片
+func (h *FileUploadHandler) ChunkPart(c echo.Context) error {
+	req := c.Request()
+	partNumber, err := strconv.Atoi(c.QueryParam("partNumber"))
+	if err != nil || req.ContentLength < 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	var digest service.PartDigest
+	if v := req.Header.Get("Content-MD5"); v != "" {
+		if digest.MD5, err = base64.StdEncoding.DecodeString(v); err != nil {
+			return errorResponse(c, server.ParamErrCode)
+		}
+	}
+	if v := req.Header.Get("X-Content-Sha256"); v != "" {
+		if digest.SHA256, err = hex.DecodeString(v); err != nil {
+			return errorResponse(c, server.ParamErrCode)
+		}
+	}
+
+	ctx := req.Context()
+	session, err := service.GetUploadSession(ctx, getUserIdentity(c), c.QueryParam("uploadIdentity"))
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	part, err := service.UploadSessionPart(ctx, session, partNumber, req.Body, req.ContentLength, digest)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.ChunkUploadPart{
+		PartNumber: part.PartNumber,
+		ETag:       part.ETag,
+		Size:       part.Size,
+	})
+}
+
+// ChunkParts 已上传的分片, 客户端中断后据此继续上传
+func (h *FileUploadHandler) ChunkParts(c echo.Context) error {
+	ctx := c.Request().Context()
+	session, err := service.GetUploadSession(ctx, getUserIdentity(c), c.QueryParam("uploadIdentity"))
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	parts, err := service.ListUploadedParts(ctx, session)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	resp := dto.ChunkUploadPartsResponse{
+		UploadIdentity: session.Identity,
+		PartSize:       session.PartSize,
+		PartCount:      session.PartCount(),
+		Parts:          make([]dto.ChunkUploadPart, 0, len(parts)),
+	}
+	for _, p := range parts {
+		resp.Parts = append(resp.Parts, dto.ChunkUploadPart{PartNumber: p.PartNumber, ETag: p.ETag, Size: p.Size})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// ChunkComplete 合并分片, 分片列表以服务端记录为准
+func (h *FileUploadHandler) ChunkComplete(c echo.Context) error {
+	var req dto.ChunkUploadCompleteRequest
+	if err := c.Bind(&req); err != nil || req.UploadIdentity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	ctx := c.Request().Context()
+	session, err := service.GetUploadSession(ctx, getUserIdentity(c), req.UploadIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	uf, err := service.CompleteUploadSession(ctx, session)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.FileUploadResponse{
+		Identity: uf.Identity,
+		Ext:      uf.Ext,
+		Name:     uf.Name,
+	})
+}
+
+// ChunkAbort 取消分片上传
+func (h *FileUploadHandler) ChunkAbort(c echo.Context) error {
+	ctx := c.Request().Context()
+	session, err := service.GetUploadSession(ctx, getUserIdentity(c), c.QueryParam("uploadIdentity"))
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if err := service.AbortUploadSession(ctx, session); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.FileUploadResponse{Msg: "ok"})
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/models"
+	"net_disk/server/service"
+)
+
+type FileVersionHandler struct {
+}
+
+// getFile 当前用户的, 或者别人分享给当前用户并且有 permission 权限的文件, 目录返回 NotFound
+func getFile(c echo.Context, identity, permission string) (*models.UserFile, error) {
+	if identity == "" {
+		return nil, service.ErrNotFound
+	}
+	uf, err := service.GetAccessibleFile(getUserIdentity(c), identity, permission)
+	if err != nil {
+		return nil, err
+	}
+	if service.IsFolder(uf) {
+		return nil, service.ErrNotFound
+	}
+	return uf, nil
+}
+
+// List 文件的版本列表, 第一项为当前版本
+func (h *FileVersionHandler) List(c echo.Context) error {
+	uf, err := getFile(c, c.QueryParam("identity"), service.PermissionView)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	fi, err := service.GetFileInfo(uf.RepositoryIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	versions, err := service.ListFileVersions(uf)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	resp := dto.FileVersionListResponse{List: make([]dto.FileVersionItem, 0, len(versions)+1)}
+	resp.List = append(resp.List, dto.FileVersionItem{
+		Size:       fi.Size,
+		Hash:       fi.Hash,
+		ModifiedBy: uf.ModifiedBy,
+		ModifiedAt: service.ModTime(uf).Unix(),
+		Current:    true,
+	})
+	for _, v := range versions {
+		resp.List = append(resp.List, dto.FileVersionItem{
+			Identity:   v.Identity,
+			Size:       v.Size,
+			Hash:       v.Hash,
+			ModifiedBy: v.ModifiedBy,
+			ModifiedAt: v.ModifiedAt.Unix(),
+		})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Download 下载历史版本, 参数: identity, versionIdentity, inline
+func (h *FileVersionHandler) Download(c echo.Context) error {
+	versionIdentity := c.QueryParam("versionIdentity")
+	if versionIdentity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	uf, err := getFile(c, c.QueryParam("identity"), service.PermissionView)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	version, err := service.GetFileVersion(uf, versionIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	fi, err := service.GetFileInfo(version.RepositoryIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return serveBlob(c, fi, uf.UserIdentity, uf.Name, version.ModifiedAt)
+}
+
+// Restore 把历史版本恢复为当前版本
+func (h *FileVersionHandler) Restore(c echo.Context) error {
+	var req dto.FileVersionRestoreRequest
+	if err := c.Bind(&req); err != nil || req.VersionIdentity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	uf, err := getFile(c, req.Identity, service.PermissionEdit)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	uf, err = service.RestoreFileVersion(getUserIdentity(c), uf, req.VersionIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.FileUploadResponse{Identity: uf.Identity, Ext: uf.Ext, Name: uf.Name})
+}
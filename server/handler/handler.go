@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/service"
+	"net_disk/tool"
+)
+
+// getUserIdentity 认证中间件写入的当前用户
+func getUserIdentity(c echo.Context) string {
+	identity, _ := c.Get(server.CtxUserIdentity).(string)
+	return identity
+}
+
+func errorResponse(c echo.Context, code int) error {
+	return c.JSON(http.StatusOK, server.NewError(tool.GetHeaderLanguage(c.Request().Header), code))
+}
+
+// serviceErrorResponse 把 service 返回的错误转换成错误码
+func serviceErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return errorResponse(c, server.NotFoundErrCode)
+	case errors.Is(err, service.ErrChallengeFailed):
+		return errorResponse(c, server.ChallengeErrCode)
+	case errors.Is(err, service.ErrInvalidPart):
+		return errorResponse(c, server.InvalidPartErrCode)
+	case errors.Is(err, service.ErrUploadIncomplete):
+		return errorResponse(c, server.UploadIncompleteErrCode)
+	case errors.Is(err, service.ErrUploadInProgress):
+		return errorResponse(c, server.UploadInProgressErrCode)
+	case errors.Is(err, service.ErrChecksumMismatch):
+		return errorResponse(c, server.ChecksumErrCode)
+	case errors.Is(err, service.ErrHashMismatch):
+		return errorResponse(c, server.HashMismatchErrCode)
+	case errors.Is(err, service.ErrGCRunning):
+		return errorResponse(c, server.GCRunningErrCode)
+	case errors.Is(err, service.ErrInvalidName), errors.Is(err, service.ErrInvalidCursor), errors.Is(err, service.ErrInvalidTag),
+		errors.Is(err, service.ErrInvalidEmail):
+		return errorResponse(c, server.ParamErrCode)
+	case errors.Is(err, service.ErrNameExists):
+		return errorResponse(c, server.NameExistsErrCode)
+	case errors.Is(err, service.ErrCycle):
+		return errorResponse(c, server.CycleErrCode)
+	case errors.Is(err, service.ErrTagExists):
+		return errorResponse(c, server.TagExistsErrCode)
+	case errors.Is(err, service.ErrTooManyEntries):
+		return errorResponse(c, server.TooManyEntriesErrCode)
+	case errors.Is(err, service.ErrUnsupportedArchive):
+		return errorResponse(c, server.UnsupportedArchiveErrCode)
+	case errors.Is(err, service.ErrArchiveLimit):
+		return errorResponse(c, server.ArchiveLimitErrCode)
+	case errors.Is(err, service.ErrUnsafePath):
+		return errorResponse(c, server.UnsafePathErrCode)
+	case errors.Is(err, service.ErrShareExpired):
+		return errorResponse(c, server.ShareExpiredErrCode)
+	case errors.Is(err, service.ErrShareCode):
+		return errorResponse(c, server.ShareCodeErrCode)
+	case errors.Is(err, service.ErrTooManyAttempts):
+		return errorResponse(c, server.TooManyAttemptsErrCode)
+	case errors.Is(err, service.ErrShareExhausted):
+		return errorResponse(c, server.ShareExhaustedErrCode)
+	case errors.Is(err, service.ErrQuotaExceeded):
+		return errorResponse(c, server.QuotaExceededErrCode)
+	case errors.Is(err, service.ErrNoPermission):
+		return errorResponse(c, server.PermissionErrCode)
+	case errors.Is(err, service.ErrRequestClosed):
+		return errorResponse(c, server.RequestClosedErrCode)
+	case errors.Is(err, service.ErrRequestFull):
+		return errorResponse(c, server.RequestFullErrCode)
+	case errors.Is(err, service.ErrRequestPassword):
+		return errorResponse(c, server.RequestPasswordErrCode)
+	case errors.Is(err, service.ErrFileTooLarge):
+		return errorResponse(c, server.FileTooLargeErrCode)
+	case errors.Is(err, service.ErrFileType):
+		return errorResponse(c, server.FileTypeErrCode)
+	}
+	tool.Logger.Errorf("url: %s, error: %v", c.Request().RequestURI, err)
+	return errorResponse(c, server.InternalErrCode)
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/service"
+)
+
+type JobHandler struct {
+}
+
+// Get 查询后台任务进度
+func (h *JobHandler) Get(c echo.Context) error {
+	identity := c.QueryParam("identity")
+	if identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	job, err := service.GetJob(c.Request().Context(), getUserIdentity(c), identity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, toJobResponse(job))
+}
+
+func toJobResponse(job *service.Job) dto.JobResponse {
+	return dto.JobResponse{
+		Identity:  job.Identity,
+		Type:      job.Type,
+		Status:    job.Status,
+		Total:     job.Total,
+		Done:      job.Done,
+		Error:     job.Error,
+		Result:    job.Result,
+		CreatedAt: job.CreatedAt.Unix(),
+		UpdatedAt: job.UpdatedAt.Unix(),
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/service"
+)
+
+type RecycleHandler struct {
+}
+
+// Delete 把文件和目录移入回收站
+func (h *RecycleHandler) Delete(c echo.Context) error {
+	var req dto.UserFileBatchRequest
+	if err := c.Bind(&req); err != nil || len(req.Identities) == 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	if err := service.DeleteUserFiles(getUserIdentity(c), req.Identities); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.MsgResponse{Msg: "ok"})
+}
+
+// List 回收站列表, 最近删除的在前
+func (h *RecycleHandler) List(c echo.Context) error {
+	page, pageSize := getPage(c)
+	items, count, err := service.ListRecycleItems(getUserIdentity(c), page, pageSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.RecycleListResponse{
+		List:     make([]dto.RecycleItem, 0, len(items)),
+		Count:    count,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	retention := service.RecycleRetention()
+	for _, item := range items {
+		resp.List = append(resp.List, dto.RecycleItem{
+			Identity:  item.Identity,
+			Name:      item.Name,
+			IsFolder:  item.IsFolder,
+			Size:      item.Size,
+			Path:      "/" + item.Path,
+			DeletedAt: item.CreatedAt.Unix(),
+			ExpiredAt: item.CreatedAt.Add(retention).Unix(),
+		})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Restore 从回收站恢复到原来的目录
+func (h *RecycleHandler) Restore(c echo.Context) error {
+	var req dto.RecycleRestoreRequest
+	if err := c.Bind(&req); err != nil || len(req.Identities) == 0 || !service.ValidConflictPolicy(req.Conflict) {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	identities, err := service.RestoreRecycleItems(getUserIdentity(c), req.Identities, req.Conflict)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.RecycleRestoreResponse{Identities: identities})
+}
+
+// Purge 彻底删除回收站中的项目
+func (h *RecycleHandler) Purge(c echo.Context) error {
+	var req dto.UserFileBatchRequest
+	if err := c.Bind(&req); err != nil || len(req.Identities) == 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	if err := service.PurgeRecycleItems(getUserIdentity(c), req.Identities); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.MsgResponse{Msg: "ok"})
+}
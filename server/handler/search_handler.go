@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/service"
+)
+
+type SearchHandler struct {
+}
+
+// Search 搜索当前用户的文件和目录. 参数:
+// name, match(contains/prefix), category(逗号分隔, image/video/audio/document/archive/code/folder), ext(逗号分隔),
+// minSize, maxSize, createdFrom, createdTo, updatedFrom, updatedTo(unix 秒), within(目录 identity), tag(标签 identity),
+// sort(name/size/time/created), order(asc/desc), cursor, pageSize
+func (h *SearchHandler) Search(c echo.Context) error {
+	_, pageSize := getPage(c)
+	q := service.SearchQuery{
+		Name:   c.QueryParam("name"),
+		Prefix: c.QueryParam("match") == "prefix",
+		Sort:   c.QueryParam("sort"),
+		Desc:   c.QueryParam("order") == "desc",
+		Cursor: c.QueryParam("cursor"),
+		Limit:  pageSize,
+	}
+	switch q.Sort {
+	case "", service.SortByName, service.SortBySize, service.SortByTime, service.SortByCreated:
+	default:
+		return errorResponse(c, server.ParamErrCode)
+	}
+	q.Categories = splitParam(c.QueryParam("category"))
+	for _, category := range q.Categories {
+		if !service.ValidCategory(category) {
+			return errorResponse(c, server.ParamErrCode)
+		}
+	}
+	q.Exts = splitParam(c.QueryParam("ext"))
+
+	var err error
+	if q.MinSize, err = int64Param(c, "minSize"); err != nil {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	if q.MaxSize, err = int64Param(c, "maxSize"); err != nil {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	for name, t := range map[string]*time.Time{
+		"createdFrom": &q.CreatedFrom,
+		"createdTo":   &q.CreatedTo,
+		"updatedFrom": &q.UpdatedFrom,
+		"updatedTo":   &q.UpdatedTo,
+	} {
+		sec, err := int64Param(c, name)
+		if err != nil {
+			return errorResponse(c, server.ParamErrCode)
+		}
+		if sec > 0 {
+			*t = time.Unix(sec, 0)
+		}
+	}
+
+	userIdentity := getUserIdentity(c)
+	if within := c.QueryParam("within"); within != "" {
+		folder, err := service.GetUserFile(userIdentity, within)
+		if err != nil {
+			return serviceErrorResponse(c, err)
+		}
+		// 只能在自己的目录中搜索
+		if !service.IsFolder(folder) || folder.UserIdentity != userIdentity {
+			return errorResponse(c, server.ParamErrCode)
+		}
+		q.Within = folder
+	}
+	if q.TagId, err = tagParam(c); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+
+	items, next, err := service.SearchUserFiles(userIdentity, q)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	list, err := toUserFileItems(items)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.FileSearchResponse{List: list, NextCursor: next})
+}
+
+// Content 全文检索, 参数: q, page, pageSize. 返回内容包含 q 中所有词的文件和命中的摘要
+func (h *SearchHandler) Content(c echo.Context) error {
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	page, pageSize := getPage(c)
+	hits, count, err := service.SearchFullText(getUserIdentity(c), query, page, pageSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.FullTextSearchResponse{
+		List:     make([]dto.FullTextSearchItem, 0, len(hits)),
+		Count:    count,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for i := range hits {
+		resp.List = append(resp.List, dto.FullTextSearchItem{
+			UserFileItem: toUserFileItem(&hits[i].UserFile, hits[i].Size),
+			Snippet:      hits[i].Snippet,
+		})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// splitParam 逗号分隔的参数, 忽略空项
+func splitParam(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// int64Param 可选的非负整数参数, 没有时为 0
+func int64Param(c echo.Context, name string) (int64, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err == nil && n < 0 {
+		err = strconv.ErrRange
+	}
+	return n, err
+}
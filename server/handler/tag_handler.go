@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"net/http"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/models"
+	"net_disk/server/service"
+)
+
+type TagHandler struct {
+}
+
+// List 当前用户的所有标签
+func (h *TagHandler) List(c echo.Context) error {
+	tags, err := service.ListTags(getUserIdentity(c))
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.TagListResponse{List: make([]dto.TagItem, 0, len(tags))}
+	for i := range tags {
+		resp.List = append(resp.List, toTagItem(&tags[i]))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Create 新建标签
+func (h *TagHandler) Create(c echo.Context) error {
+	var req dto.TagRequest
+	if err := c.Bind(&req); err != nil {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	tag, err := service.CreateTag(getUserIdentity(c), req.Name, req.Color)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, toTagItem(tag))
+}
+
+// Update 修改标签名和颜色
+func (h *TagHandler) Update(c echo.Context) error {
+	var req dto.TagRequest
+	if err := c.Bind(&req); err != nil || req.Identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	tag, err := service.GetTag(getUserIdentity(c), req.Identity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if err := service.UpdateTag(tag, req.Name, req.Color); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, toTagItem(tag))
+}
+
+// Delete 删除标签, 文件本身不受影响
+func (h *TagHandler) Delete(c echo.Context) error {
+	var req dto.TagRequest
+	if err := c.Bind(&req); err != nil || req.Identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	tag, err := service.GetTag(getUserIdentity(c), req.Identity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if err := service.DeleteTag(tag); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.MsgResponse{Msg: "ok"})
+}
+
+// Attach 批量给文件和目录打标签
+func (h *TagHandler) Attach(c echo.Context) error {
+	return h.update(c, service.TagUserFiles)
+}
+
+// Detach 批量移除文件和目录上的标签
+func (h *TagHandler) Detach(c echo.Context) error {
+	return h.update(c, service.UntagUserFiles)
+}
+
+func (h *TagHandler) update(c echo.Context, fn func(*models.Tag, []string) error) error {
+	var req dto.TagFilesRequest
+	if err := c.Bind(&req); err != nil || req.TagIdentity == "" || len(req.Identities) == 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	tag, err := service.GetTag(getUserIdentity(c), req.TagIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if err := fn(tag, req.Identities); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.MsgResponse{Msg: "ok"})
+}
+
+// Files 带有标签的文件和目录, 参数: identity(标签), page, pageSize
+func (h *TagHandler) Files(c echo.Context) error {
+	tag, err := service.GetTag(getUserIdentity(c), c.QueryParam("identity"))
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	page, pageSize := getPage(c)
+	items, count, err := service.ListTaggedFiles(tag, page, pageSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	list, err := toUserFileItems(items)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.FolderListResponse{List: list, Count: count, Page: page, PageSize: pageSize})
+}
+
+// Favorite 批量收藏或取消收藏
+func (h *TagHandler) Favorite(c echo.Context) error {
+	var req dto.FavoriteRequest
+	if err := c.Bind(&req); err != nil || len(req.Identities) == 0 {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	if err := service.SetFavorite(getUserIdentity(c), req.Identities, req.Favorite); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.MsgResponse{Msg: "ok"})
+}
+
+// Favorites 收藏的文件和目录, 最近收藏的在前
+func (h *TagHandler) Favorites(c echo.Context) error {
+	page, pageSize := getPage(c)
+	items, count, err := service.ListFavorites(getUserIdentity(c), page, pageSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	list, err := toUserFileItems(items)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.FolderListResponse{List: list, Count: count, Page: page, PageSize: pageSize})
+}
+
+// tagParam 参数中的标签 identity 转成 Tag.Id, 没有时为 0
+func tagParam(c echo.Context) (int, error) {
+	identity := c.QueryParam("tag")
+	if identity == "" {
+		return 0, nil
+	}
+	tag, err := service.GetTag(getUserIdentity(c), identity)
+	if err != nil {
+		return 0, err
+	}
+	return tag.Id, nil
+}
+
+func toTagItem(tag *models.Tag) dto.TagItem {
+	return dto.TagItem{Identity: tag.Identity, Name: tag.Name, Color: tag.Color}
+}
+
+// toUserFileItems 转换列表并带上每一项的标签
+func toUserFileItems(items []service.UserFileItem) ([]dto.UserFileItem, error) {
+	ids := make([]int, 0, len(items))
+	for i := range items {
+		ids = append(ids, items[i].Id)
+	}
+	tags, err := service.GetUserFileTags(ids)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]dto.UserFileItem, 0, len(items))
+	for i := range items {
+		item := toUserFileItem(&items[i].UserFile, items[i].Size)
+		for j := range tags[items[i].Id] {
+			item.Tags = append(item.Tags, toTagItem(&tags[items[i].Id][j]))
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server/service"
+	"net_disk/tool"
+)
+
+// tus 1.0 协议, 见 https://tus.io/protocols/resumable-upload
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum,expiration"
+	tusChecksums  = "md5,sha1,sha256"
+
+	// statusChecksumMismatch tus checksum 扩展定义的状态码
+	statusChecksumMismatch = 460
+)
+
+type TusHandler struct {
+}
+
+func tusResponse(c echo.Context, status int) error {
+	c.Response().Header().Set("Tus-Resumable", tusVersion)
+	return c.NoContent(status)
+}
+
+// tusErrorResponse service 错误转换成 tus 的 http 状态码
+func tusErrorResponse(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrOffsetMismatch), errors.Is(err, service.ErrUploadInProgress):
+		status = http.StatusConflict
+	case errors.Is(err, service.ErrChecksumMismatch):
+		status = statusChecksumMismatch
+	case errors.Is(err, service.ErrInvalidPart):
+		status = http.StatusBadRequest
+	default:
+		tool.Logger.Errorf("url: %s, error: %v", c.Request().RequestURI, err)
+	}
+	c.Response().Header().Set("Tus-Resumable", tusVersion)
+	return c.String(status, err.Error())
+}
+
+// checkTusResumable 除 OPTIONS 外的请求都必须带 Tus-Resumable 头
+func checkTusResumable(c echo.Context) bool {
+	if c.Request().Header.Get("Tus-Resumable") == tusVersion {
+		return true
+	}
+	c.Response().Header().Set("Tus-Version", tusVersion)
+	return false
+}
+
+// parseTusMetadata 解析 Upload-Metadata: key base64(value),key base64(value)
+func parseTusMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		meta[key] = string(data)
+	}
+	return meta
+}
+
+// parseTusChecksum 解析 Upload-Checksum: 算法 base64(校验值)
+func parseTusChecksum(header string) (*service.Checksum, bool) {
+	if header == "" {
+		return nil, true
+	}
+	alg, value, _ := strings.Cut(header, " ")
+	expect, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, false
+	}
+	var h hash.Hash
+	switch alg {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, false
+	}
+	return &service.Checksum{Hash: h, Expect: expect}, true
+}
+
+func getTusSession(c echo.Context) (*service.UploadSession, error) {
+	session, err := service.GetUploadSession(c.Request().Context(), getUserIdentity(c), c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if !session.Tus {
+		return nil, service.ErrNotFound
+	}
+	return session, nil
+}
+
+func setUploadExpires(c echo.Context, session *service.UploadSession) {
+	c.Response().Header().Set("Upload-Expires", session.ExpiredAt.UTC().Format(http.TimeFormat))
+}
+
+// Options 返回服务端支持的协议版本和扩展
+func (h *TusHandler) Options(c echo.Context) error {
+	header := c.Response().Header()
+	header.Set("Tus-Version", tusVersion)
+	header.Set("Tus-Extension", tusExtensions)
+	header.Set("Tus-Max-Size", strconv.FormatInt(service.MaxUploadSize, 10))
+	header.Set("Tus-Checksum-Algorithm", tusChecksums)
+	return tusResponse(c, http.StatusNoContent)
+}
+
+// Create creation 扩展, Upload-Metadata 支持 filename, parentIdentity, hash, fileIdentity (覆盖已有文件)
+func (h *TusHandler) Create(c echo.Context) error {
+	if !checkTusResumable(c) {
+		return tusResponse(c, http.StatusPreconditionFailed)
+	}
+	req := c.Request()
+	length, err := strconv.ParseInt(req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return tusResponse(c, http.StatusBadRequest)
+	}
+	if length > service.MaxUploadSize {
+		return tusResponse(c, http.StatusRequestEntityTooLarge)
+	}
+	meta := parseTusMetadata(req.Header.Get("Upload-Metadata"))
+	name := meta["filename"]
+	if name == "" {
+		name = meta["name"]
+	}
+	if (name == "" && meta["fileIdentity"] == "") || !service.ValidConflictPolicy(meta["conflict"]) {
+		return tusResponse(c, http.StatusBadRequest)
+	}
+
+	userIdentity := getUserIdentity(c)
+	target, err := service.ResolveFileTarget(userIdentity, meta["parentIdentity"], name, meta["fileIdentity"], meta["conflict"])
+	if err != nil {
+		return tusErrorResponse(c, err)
+	}
+	ctx := req.Context()
+	session, err := service.InitTusUpload(ctx, userIdentity, target, meta["hash"], length)
+	if err != nil {
+		return tusErrorResponse(c, err)
+	}
+
+	c.Response().Header().Set("Location", strings.TrimSuffix(req.URL.Path, "/")+"/"+session.Identity)
+	setUploadExpires(c, session)
+	if length == 0 {
+		// 空文件不会有 PATCH 请求, 直接完成
+		_, uf, err := service.AppendTusUpload(ctx, session, 0, http.NoBody, 0, nil)
+		if err != nil {
+			return tusErrorResponse(c, err)
+		}
+		c.Response().Header().Set("Upload-File-Identity", uf.Identity)
+	}
+	return tusResponse(c, http.StatusCreated)
+}
+
+// Head 查询已上传的偏移
+func (h *TusHandler) Head(c echo.Context) error {
+	if !checkTusResumable(c) {
+		return tusResponse(c, http.StatusPreconditionFailed)
+	}
+	session, err := getTusSession(c)
+	if err != nil {
+		return tusErrorResponse(c, err)
+	}
+	offset, err := service.UploadOffset(c.Request().Context(), session)
+	if err != nil {
+		return tusErrorResponse(c, err)
+	}
+
+	header := c.Response().Header()
+	header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(session.Size, 10))
+	header.Set("Cache-Control", "no-store")
+	setUploadExpires(c, session)
+	return tusResponse(c, http.StatusOK)
+}
+
+// Patch 从 Upload-Offset 处追加数据, 写满后创建文件, 文件 identity 在 Upload-File-Identity 头中返回
+func (h *TusHandler) Patch(c echo.Context) error {
+	if !checkTusResumable(c) {
+		return tusResponse(c, http.StatusPreconditionFailed)
+	}
+	req := c.Request()
+	if req.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		return tusResponse(c, http.StatusUnsupportedMediaType)
+	}
+	offset, err := strconv.ParseInt(req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return tusResponse(c, http.StatusBadRequest)
+	}
+	checksum, ok := parseTusChecksum(req.Header.Get("Upload-Checksum"))
+	if !ok {
+		return tusResponse(c, http.StatusBadRequest)
+	}
+	session, err := getTusSession(c)
+	if err != nil {
+		return tusErrorResponse(c, err)
+	}
+
+	offset, uf, err := service.AppendTusUpload(req.Context(), session, offset, req.Body, req.ContentLength, checksum)
+	c.Response().Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if err != nil {
+		return tusErrorResponse(c, err)
+	}
+	setUploadExpires(c, session)
+	if uf != nil {
+		c.Response().Header().Set("Upload-File-Identity", uf.Identity)
+	}
+	return tusResponse(c, http.StatusNoContent)
+}
+
+// Delete termination 扩展, 取消上传
+func (h *TusHandler) Delete(c echo.Context) error {
+	if !checkTusResumable(c) {
+		return tusResponse(c, http.StatusPreconditionFailed)
+	}
+	session, err := getTusSession(c)
+	if err != nil {
+		return tusErrorResponse(c, err)
+	}
+	if err := service.AbortUploadSession(c.Request().Context(), session); err != nil {
+		return tusErrorResponse(c, err)
+	}
+	return tusResponse(c, http.StatusNoContent)
+}
@@ -1 +1,194 @@
 package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	echo "github.com/labstack/echo/v4"
+
+	"net_disk/server"
+	"net_disk/server/dto"
+	"net_disk/server/models"
+	"net_disk/server/service"
+)
+
+type UserFileHandler struct {
+}
+
+// CreateFolder 新建目录, 在别人分享的目录中新建需要编辑权限
+func (h *UserFileHandler) CreateFolder(c echo.Context) error {
+	var req dto.FolderCreateRequest
+	if err := c.Bind(&req); err != nil {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	owner, parentId, err := service.ResolveFolder(getUserIdentity(c), req.ParentIdentity, service.PermissionEdit)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	folder, err := service.CreateFolder(owner, parentId, req.Name)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, toUserFileItem(folder, 0))
+}
+
+// ListFolder 列出目录内容, 参数: identity(空为根目录), page, pageSize, sort(name/size/time), order(asc/desc), tag(可选, 标签 identity).
+// 也可以列出别人直接分享的目录, 这时不返回所有者的收藏和标签
+func (h *UserFileHandler) ListFolder(c echo.Context) error {
+	page, pageSize := getPage(c)
+	sort := c.QueryParam("sort")
+	if sort != "" && sort != service.SortByName && sort != service.SortBySize && sort != service.SortByTime {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	userIdentity := getUserIdentity(c)
+	owner, parentId, err := service.ResolveFolder(userIdentity, c.QueryParam("identity"), service.PermissionView)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	tagId, err := tagParam(c)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	items, count, err := service.ListFolder(owner, parentId, tagId, sort, c.QueryParam("order") == "desc", page, pageSize)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	var list []dto.UserFileItem
+	if owner == userIdentity {
+		if list, err = toUserFileItems(items); err != nil {
+			return serviceErrorResponse(c, err)
+		}
+	} else {
+		list = make([]dto.UserFileItem, 0, len(items))
+		for i := range items {
+			list = append(list, toPublicFileItem(&items[i].UserFile, items[i].Size))
+		}
+	}
+	return c.JSON(http.StatusOK, dto.FolderListResponse{List: list, Count: count, Page: page, PageSize: pageSize})
+}
+
+// FolderPath 面包屑, 从根目录到 identity 的路径. 别人分享的目录从分享的目录开始
+func (h *UserFileHandler) FolderPath(c echo.Context) error {
+	resp := dto.FolderPathResponse{Path: []dto.PathItem{}}
+	identity := c.QueryParam("identity")
+	if identity == "" {
+		return c.JSON(http.StatusOK, resp)
+	}
+	userIdentity := getUserIdentity(c)
+	uf, err := service.GetUserFile(userIdentity, identity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	path, err := service.VisiblePath(userIdentity, uf)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	for _, p := range path {
+		resp.Path = append(resp.Path, dto.PathItem{Identity: p.Identity, Name: p.Name})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Rename 重命名文件或目录, 别人分享的需要编辑权限
+func (h *UserFileHandler) Rename(c echo.Context) error {
+	var req dto.UserFileRenameRequest
+	if err := c.Bind(&req); err != nil || req.Identity == "" {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	uf, err := service.GetAccessibleFile(getUserIdentity(c), req.Identity, service.PermissionEdit)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if err := service.RenameUserFile(uf, req.Name); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	var size int64
+	if !service.IsFolder(uf) {
+		fi, err := service.GetFileInfo(uf.RepositoryIdentity)
+		if err != nil {
+			return serviceErrorResponse(c, err)
+		}
+		size = fi.Size
+	}
+	return c.JSON(http.StatusOK, toUserFileItem(uf, size))
+}
+
+// Move 批量移动文件和目录, 全部成功或全部失败
+func (h *UserFileHandler) Move(c echo.Context) error {
+	var req dto.UserFileMoveRequest
+	if err := c.Bind(&req); err != nil || len(req.Identities) == 0 || !service.ValidConflictPolicy(req.Conflict) {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	userIdentity := getUserIdentity(c)
+	targetId, err := service.GetParentId(userIdentity, req.TargetIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	if err := service.MoveUserFiles(userIdentity, req.Identities, targetId, req.Conflict); err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.MsgResponse{Msg: "ok"})
+}
+
+// Copy 批量复制文件和目录, 文件较多时返回后台任务
+func (h *UserFileHandler) Copy(c echo.Context) error {
+	var req dto.UserFileMoveRequest
+	if err := c.Bind(&req); err != nil || len(req.Identities) == 0 || !service.ValidConflictPolicy(req.Conflict) {
+		return errorResponse(c, server.ParamErrCode)
+	}
+	userIdentity := getUserIdentity(c)
+	targetId, err := service.GetParentId(userIdentity, req.TargetIdentity)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	identities, job, err := service.CopyUserFiles(userIdentity, req.Identities, targetId, req.Conflict)
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	resp := dto.UserFileCopyResponse{Identities: identities}
+	if job != nil {
+		resp.Identities = []string{}
+		resp.JobIdentity = job.Identity
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Usage 当前用户占用的空间, 包括回收站和历史版本
+func (h *UserFileHandler) Usage(c echo.Context) error {
+	usage, err := service.GetUsage(getUserIdentity(c))
+	if err != nil {
+		return serviceErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, dto.UsageResponse{
+		Used:     usage.Total(),
+		Files:    usage.Files,
+		Recycle:  usage.Recycle,
+		Versions: usage.Versions,
+		Quota:    service.UserQuota(),
+	})
+}
+
+// getPage 分页参数, pageSize 默认 server.Pagesize
+func getPage(c echo.Context) (int, int) {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.QueryParam("pageSize"))
+	if pageSize < 1 || pageSize > 100*server.Pagesize {
+		pageSize = server.Pagesize
+	}
+	return page, pageSize
+}
+
+func toUserFileItem(uf *models.UserFile, size int64) dto.UserFileItem {
+	return dto.UserFileItem{
+		Identity:  uf.Identity,
+		Name:      uf.Name,
+		Ext:       uf.Ext,
+		IsFolder:  service.IsFolder(uf),
+		Size:      size,
+		UpdatedAt: uf.UpdatedAt.Unix(),
+		Favorite:  uf.Favorite,
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// DirectShare 把文件或目录直接分享给注册用户或邮箱, 分享目录时包括其中的内容
+type DirectShare struct {
+	Id            int       `xorm:"pk autoincr"`
+	Identity      string    `xorm:"unique"`
+	OwnerIdentity string    `xorm:"index"` // 分享者
+	UserFileId    int       `xorm:"index"`
+	UserIdentity  string    `xorm:"index"` // 被分享的用户, 按邮箱分享且对方还没有注册时为空, 注册后按 Email 匹配
+	Email         string    `xorm:"index"`
+	Permission    string    // view: 查看和下载; edit: 还可以上传、覆盖、新建目录和重命名
+	CreatedAt     time.Time `xorm:"created"`
+	UpdatedAt     time.Time `xorm:"updated"`
+}
+
+func (r *DirectShare) TableName() string {
+	return "direct_share"
+}
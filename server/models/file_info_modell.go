@@ -3,18 +3,35 @@ package models
 import "time"
 
 type FileInfo struct {
-	Id        int
-	Identity  string
-	Hash      string
-	Name      string
-	Ext       string
-	Size      int64
-	Path      string
-	CreatedAt time.Time `xorm:"created"`
-	UpdatedAt time.Time `xorm:"updated_at"`
-	DeletedAt time.Time `xorm:"deleted_at"`
+	Id         int    `xorm:"pk autoincr"`
+	Identity   string `xorm:"unique"`
+	Hash       string `xorm:"index(file_info_hash)"`
+	Name       string
+	Ext        string
+	Size       int64     `xorm:"index(file_info_hash)"`
+	Path       string    // 存储后端中的对象 key, 早期数据为 COS 对象的完整 URL
+	RefCount   int       // 引用该文件的 UserFile 数量
+	ReleasedAt time.Time // 引用数降为 0 的时间, 超过宽限期后由 GC 回收
+	Encrypted  bool      // 内容已加密, 数据密钥见 FileKey
+	Layout     string    `xorm:"text"` // 加密对象每段的明文长度, 见 crypt.Layout
+	CreatedAt  time.Time `xorm:"created"`
+	UpdatedAt  time.Time `xorm:"updated_at"`
+	DeletedAt  time.Time `xorm:"deleted_at"`
 }
 
 func (r *FileInfo) TableName() string {
 	return "file_info"
 }
+
+// FileKey 文件的数据密钥, 每个引用该文件的用户各保存一份用自己的用户密钥加密的副本
+type FileKey struct {
+	Id           int    `xorm:"pk autoincr"`
+	FileIdentity string `xorm:"unique(file_key_user)"`
+	UserIdentity string `xorm:"unique(file_key_user)"`
+	WrappedKey   []byte
+	CreatedAt    time.Time `xorm:"created"`
+}
+
+func (r *FileKey) TableName() string {
+	return "file_key"
+}
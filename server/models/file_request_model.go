@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// FileRequest 文件收集链接, 没有账号的人可以通过链接上传文件到创建者的目录
+type FileRequest struct {
+	Id           int    `xorm:"pk autoincr"`
+	Identity     string `xorm:"unique"` // 链接中的短标识
+	UserIdentity string `xorm:"index"`  // 创建者, 上传的文件属于创建者并占用创建者的空间
+	FolderId     int    // 上传到的目录, 0 为根目录
+	Title        string
+	ExpiredAt    time.Time // 零值表示永久有效
+	MaxFileSize  int64     // 单个文件的大小上限(字节), 0 表示不限制
+	Exts         string    // 允许的扩展名, 小写, 逗号分隔, 如 ".pdf,.docx". 空表示不限制
+	MaxFiles     int       // 最多上传的文件数, 0 表示不限制
+	Password     string    // bcrypt 哈希, 空表示不需要密码
+	Uploaded     int       // 已上传的文件数
+	CreatedAt    time.Time `xorm:"created"`
+	UpdatedAt    time.Time `xorm:"updated"`
+	DeletedAt    time.Time `xorm:"deleted"` // 关闭链接
+}
+
+func (r *FileRequest) TableName() string {
+	return "file_request"
+}
+
+// FileRequestUpload 通过收集链接上传的一个文件
+type FileRequestUpload struct {
+	Id           int `xorm:"pk autoincr"`
+	RequestId    int `xorm:"index"`
+	UserFileId   int
+	Name         string // 上传时的文件名, 重名时 UserFile 会自动改名
+	Size         int64
+	UploaderName string // 上传者自己填写的名字
+	Ip           string
+	CreatedAt    time.Time `xorm:"created"`
+}
+
+func (r *FileRequestUpload) TableName() string {
+	return "file_request_upload"
+}
@@ -2,19 +2,37 @@ package models
 
 import "time"
 
+// FileShare 分享链接, 指向分享者的一个文件或目录. 按 UserFile.Id 关联, 移动和重命名后链接仍然有效
 type FileShare struct {
-	Id        int
-	Identity  string
-	Hash      string
-	Name      string
-	Ext       string
-	Size      int64
-	Path      string
-	CreatedAt time.Time `xorm:"created"`
-	UpdatedAt time.Time `xorm:"updated_at"`
-	DeletedAt time.Time `xorm:"deleted_at"`
+	Id           int       `xorm:"pk autoincr"`
+	Identity     string    `xorm:"unique"` // 链接中的短标识
+	UserIdentity string    `xorm:"index"`  // 分享者
+	UserFileId   int       `xorm:"index"`
+	Code         string    // 提取码, 空表示不需要
+	ExpiredAt    time.Time // 零值表示永久有效
+	MaxDownloads int       // 下载次数达到后链接失效, 0 表示不限制
+	Views        int64     // 以下统计由 redis 定期写入, 可能落后
+	Downloads    int64
+	Bytes        int64
+	CreatedAt    time.Time `xorm:"created"`
+	UpdatedAt    time.Time `xorm:"updated_at"`
+	DeletedAt    time.Time `xorm:"deleted"` // 取消分享
 }
 
 func (r *FileShare) TableName() string {
 	return "file_share"
 }
+
+// ShareDailyStat 分享每天的访问统计
+type ShareDailyStat struct {
+	Id        int    `xorm:"pk autoincr"`
+	ShareId   int    `xorm:"index(share_daily_stat_day)"`
+	Day       string `xorm:"index(share_daily_stat_day)"` // 2006-01-02
+	Views     int64
+	Downloads int64
+	Bytes     int64
+}
+
+func (r *ShareDailyStat) TableName() string {
+	return "share_daily_stat"
+}
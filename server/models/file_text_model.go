@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// FileText FileInfo 提取出的文本, 用于生成搜索结果的摘要. 相同内容只建一次索引
+type FileText struct {
+	Id           int       `xorm:"pk autoincr"`
+	FileIdentity string    `xorm:"index"`
+	Content      string    `xorm:"mediumtext"`
+	CreatedAt    time.Time `xorm:"created"`
+}
+
+func (r *FileText) TableName() string {
+	return "file_text"
+}
+
+// FileTerm 倒排索引, 词在 FileInfo 文本中出现的次数
+type FileTerm struct {
+	Id           int    `xorm:"pk autoincr"`
+	Term         string `xorm:"index(file_term_term)"`
+	FileIdentity string `xorm:"index(file_term_term) index"`
+	Freq         int
+}
+
+func (r *FileTerm) TableName() string {
+	return "file_term"
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// FileVersion UserFile 被覆盖前的内容
+type FileVersion struct {
+	Id                 int    `xorm:"pk autoincr"`
+	Identity           string `xorm:"unique"`
+	UserFileId         int    `xorm:"index"`
+	UserIdentity       string // 文件所有者
+	RepositoryIdentity string `xorm:"index"`
+	Size               int64
+	Hash               string
+	ModifiedBy         string    // 写入该版本的用户
+	ModifiedAt         time.Time // 写入该版本的时间
+	CreatedAt          time.Time `xorm:"created"` // 被覆盖的时间
+}
+
+func (r *FileVersion) TableName() string {
+	return "file_version"
+}
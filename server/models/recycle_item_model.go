@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// RecycleItem 回收站中的一项, 对应一次删除的根文件或目录, 同时删除的子目录和文件通过 UserFile.RecycleIdentity 关联
+type RecycleItem struct {
+	Id           int    `xorm:"pk autoincr"`
+	Identity     string `xorm:"unique"`
+	UserIdentity string `xorm:"index"`
+	UserFileId   int    // 被删除的根
+	ParentId     int    // 删除前的父目录
+	Path         string // 删除前父目录的路径, 父目录不存在时按它重建
+	Name         string
+	IsFolder     bool
+	Size         int64     // 包含的文件总大小
+	CreatedAt    time.Time `xorm:"created index"` // 删除时间
+}
+
+func (r *RecycleItem) TableName() string {
+	return "recycle_item"
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// SchemaMigration 已执行的一次性数据迁移
+type SchemaMigration struct {
+	Id        int       `xorm:"pk autoincr"`
+	Name      string    `xorm:"unique"`
+	CreatedAt time.Time `xorm:"created"`
+}
+
+func (r *SchemaMigration) TableName() string {
+	return "schema_migration"
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Tag 用户自定义的标签
+type Tag struct {
+	Id           int    `xorm:"pk autoincr"`
+	Identity     string `xorm:"unique"`
+	UserIdentity string `xorm:"index"`
+	Name         string
+	Color        string    // #RRGGBB
+	CreatedAt    time.Time `xorm:"created"`
+	UpdatedAt    time.Time `xorm:"updated"`
+}
+
+func (r *Tag) TableName() string {
+	return "tag"
+}
+
+// UserFileTag 文件或目录上的标签, 按 UserFile.Id 关联, 移动和重命名不受影响
+type UserFileTag struct {
+	Id         int       `xorm:"pk autoincr"`
+	TagId      int       `xorm:"index"`
+	UserFileId int       `xorm:"index"`
+	CreatedAt  time.Time `xorm:"created"`
+}
+
+func (r *UserFileTag) TableName() string {
+	return "user_file_tag"
+}
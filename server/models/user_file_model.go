@@ -2,17 +2,23 @@ package models
 
 import "time"
 
+// UserFile 用户的文件和目录. user_file_name 唯一索引保证同一目录下不在回收站中的文件和目录不重名
 type UserFile struct {
-	Id                 int
-	Identity           string
-	UserIdentity       string
-	ParentId           int
-	RepositoryIdentity string
+	Id                 int    `xorm:"pk autoincr"`
+	Identity           string `xorm:"unique"`
+	UserIdentity       string `xorm:"unique(user_file_name) index(user_file_recycle)"`
+	ParentId           int    `xorm:"unique(user_file_name)"`
+	RepositoryIdentity string `xorm:"index"`
 	Ext                string
-	Name               string
+	Name               string    `xorm:"unique(user_file_name)"`
+	RecycleIdentity    string    `xorm:"unique(user_file_name) index(user_file_recycle)"` // 在回收站中时, 所属的 RecycleItem
+	ModifiedBy         string    // 最后写入内容的用户
+	ModifiedAt         time.Time // 最后写入内容的时间, 重命名和移动不影响
+	Favorite           bool
+	FavoritedAt        time.Time
 	CreatedAt          time.Time `xorm:"created"`
 	UpdatedAt          time.Time `xorm:"updated_at"`
-	DeletedAt          time.Time `xorm:"deleted_at"`
+	DeletedAt          time.Time `xorm:"deleted"`
 }
 
 func (r *UserFile) TableName() string {
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UserKey 用户密钥, 用主密钥加密保存
+type UserKey struct {
+	Id           int    `xorm:"pk autoincr"`
+	UserIdentity string `xorm:"unique"`
+	WrappedKey   []byte
+	CreatedAt    time.Time `xorm:"created"`
+}
+
+func (r *UserKey) TableName() string {
+	return "user_key"
+}
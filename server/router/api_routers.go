@@ -24,3 +24,435 @@ func initApplicationRouter() {
 
 	middleware.GenerateHandler(Echo, list)
 }
+
+func initFileUploadRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodPost,
+			Handler: fileUploadHandler.Upload,
+			URL:     "/lcdp/file/upload",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: fileUploadHandler.Check,
+			URL:     "/lcdp/file/upload/check",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: fileUploadHandler.Prove,
+			URL:     "/lcdp/file/upload/prove",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: fileUploadHandler.ChunkInit,
+			URL:     "/lcdp/file/chunk/init",
+		},
+		{
+			Method:  http.MethodPut,
+			Handler: fileUploadHandler.ChunkPart,
+			URL:     "/lcdp/file/chunk/part",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: fileUploadHandler.ChunkParts,
+			URL:     "/lcdp/file/chunk/parts",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: fileUploadHandler.ChunkComplete,
+			URL:     "/lcdp/file/chunk/complete",
+		},
+		{
+			Method:  http.MethodDelete,
+			Handler: fileUploadHandler.ChunkAbort,
+			URL:     "/lcdp/file/chunk",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initTusRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodOptions,
+			Handler: tusHandler.Options,
+			URL:     "/lcdp/tus",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: tusHandler.Create,
+			URL:     "/lcdp/tus",
+		},
+		{
+			Method:  http.MethodHead,
+			Handler: tusHandler.Head,
+			URL:     "/lcdp/tus/:id",
+		},
+		{
+			Method:  http.MethodPatch,
+			Handler: tusHandler.Patch,
+			URL:     "/lcdp/tus/:id",
+		},
+		{
+			Method:  http.MethodDelete,
+			Handler: tusHandler.Delete,
+			URL:     "/lcdp/tus/:id",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initAdminRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:      http.MethodPost,
+			Handler:     adminHandler.RunGC,
+			URL:         "/lcdp/admin/gc",
+			Permissions: []string{"A"},
+		},
+		{
+			Method:      http.MethodGet,
+			Handler:     adminHandler.GCReport,
+			URL:         "/lcdp/admin/gc",
+			Permissions: []string{"A"},
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initFileDownloadRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodGet,
+			Handler: fileDownloadHandler.Download,
+			URL:     "/lcdp/file/download",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: fileDownloadHandler.Zip,
+			URL:     "/lcdp/file/zip",
+		},
+		{
+			Method:  http.MethodHead,
+			Handler: fileDownloadHandler.Download,
+			URL:     "/lcdp/file/download",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initUserFileRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodPost,
+			Handler: userFileHandler.CreateFolder,
+			URL:     "/lcdp/folder",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: userFileHandler.ListFolder,
+			URL:     "/lcdp/folder/list",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: userFileHandler.FolderPath,
+			URL:     "/lcdp/folder/path",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: userFileHandler.Rename,
+			URL:     "/lcdp/file/rename",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: userFileHandler.Move,
+			URL:     "/lcdp/file/move",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: userFileHandler.Copy,
+			URL:     "/lcdp/file/copy",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: userFileHandler.Usage,
+			URL:     "/lcdp/user/usage",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initJobRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodGet,
+			Handler: jobHandler.Get,
+			URL:     "/lcdp/job",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initRecycleRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodPost,
+			Handler: recycleHandler.Delete,
+			URL:     "/lcdp/file/delete",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: recycleHandler.List,
+			URL:     "/lcdp/recycle/list",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: recycleHandler.Restore,
+			URL:     "/lcdp/recycle/restore",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: recycleHandler.Purge,
+			URL:     "/lcdp/recycle/purge",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initFileVersionRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodGet,
+			Handler: fileVersionHandler.List,
+			URL:     "/lcdp/file/version/list",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: fileVersionHandler.Download,
+			URL:     "/lcdp/file/version/download",
+		},
+		{
+			Method:  http.MethodHead,
+			Handler: fileVersionHandler.Download,
+			URL:     "/lcdp/file/version/download",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: fileVersionHandler.Restore,
+			URL:     "/lcdp/file/version/restore",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initSearchRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodGet,
+			Handler: searchHandler.Search,
+			URL:     "/lcdp/file/search",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: searchHandler.Content,
+			URL:     "/lcdp/file/search/content",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initTagRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodGet,
+			Handler: tagHandler.List,
+			URL:     "/lcdp/tag/list",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: tagHandler.Create,
+			URL:     "/lcdp/tag",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: tagHandler.Update,
+			URL:     "/lcdp/tag/update",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: tagHandler.Delete,
+			URL:     "/lcdp/tag/delete",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: tagHandler.Attach,
+			URL:     "/lcdp/tag/attach",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: tagHandler.Detach,
+			URL:     "/lcdp/tag/detach",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: tagHandler.Files,
+			URL:     "/lcdp/tag/files",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: tagHandler.Favorite,
+			URL:     "/lcdp/file/favorite",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: tagHandler.Favorites,
+			URL:     "/lcdp/file/favorite/list",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initArchiveRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodGet,
+			Handler: archiveHandler.List,
+			URL:     "/lcdp/file/archive/list",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: archiveHandler.Extract,
+			URL:     "/lcdp/file/archive/extract",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initFileShareRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodPost,
+			Handler: fileShareHandler.Create,
+			URL:     "/lcdp/share",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: fileShareHandler.List,
+			URL:     "/lcdp/share/list",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: fileShareHandler.Cancel,
+			URL:     "/lcdp/share/cancel",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: fileShareHandler.Stats,
+			URL:     "/lcdp/share/stats",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: fileShareHandler.Save,
+			URL:     "/lcdp/share/save",
+		},
+		// 以下为公开接口, 不需要登录
+		{
+			Method:  http.MethodGet,
+			Handler: fileShareHandler.Info,
+			URL:     "/lcdp/share/info",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: fileShareHandler.Files,
+			URL:     "/lcdp/share/files",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: fileShareHandler.Download,
+			URL:     "/lcdp/share/download",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initDirectShareRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodPost,
+			Handler: directShareHandler.Share,
+			URL:     "/lcdp/file/direct-share",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: directShareHandler.Recipients,
+			URL:     "/lcdp/file/direct-share/list",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: directShareHandler.Update,
+			URL:     "/lcdp/file/direct-share/update",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: directShareHandler.Revoke,
+			URL:     "/lcdp/file/direct-share/revoke",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: directShareHandler.SharedWithMe,
+			URL:     "/lcdp/file/shared-with-me",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
+
+func initFileRequestRouter() {
+	list := []middleware.PermissionItem{
+		{
+			Method:  http.MethodPost,
+			Handler: fileRequestHandler.Create,
+			URL:     "/lcdp/request",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: fileRequestHandler.List,
+			URL:     "/lcdp/request/list",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: fileRequestHandler.Close,
+			URL:     "/lcdp/request/close",
+		},
+		{
+			Method:  http.MethodGet,
+			Handler: fileRequestHandler.Uploads,
+			URL:     "/lcdp/request/uploads",
+		},
+		// 以下为公开接口, 不需要登录
+		{
+			Method:  http.MethodGet,
+			Handler: fileRequestHandler.Info,
+			URL:     "/lcdp/request/info",
+		},
+		{
+			Method:  http.MethodPost,
+			Handler: fileRequestHandler.Upload,
+			URL:     "/lcdp/request/upload",
+		},
+	}
+
+	middleware.GenerateHandler(Echo, list)
+}
@@ -3,7 +3,9 @@ package router
 import (
 	"context"
 	"encoding/json"
+	"net"
 	"os"
+	"strings"
 
 	echoMiddleware "github.com/labstack/echo/v4/middleware"
 	"suhc-gitlab-01.inovance.local/mnk/server/lcdp.git/middleware"
@@ -13,8 +15,22 @@ import (
 )
 
 var (
-	Echo               = echo.New()
-	applicationHandler = handler.ApplicationHandler{}
+	Echo                = echo.New()
+	applicationHandler  = handler.ApplicationHandler{}
+	fileUploadHandler   = handler.FileUploadHandler{}
+	tusHandler          = handler.TusHandler{}
+	adminHandler        = handler.AdminHandler{}
+	fileDownloadHandler = handler.FileDownloadHandler{}
+	userFileHandler     = handler.UserFileHandler{}
+	jobHandler          = handler.JobHandler{}
+	recycleHandler      = handler.RecycleHandler{}
+	fileVersionHandler  = handler.FileVersionHandler{}
+	searchHandler       = handler.SearchHandler{}
+	tagHandler          = handler.TagHandler{}
+	archiveHandler      = handler.ArchiveHandler{}
+	fileShareHandler    = handler.FileShareHandler{}
+	directShareHandler  = handler.DirectShareHandler{}
+	fileRequestHandler  = handler.FileRequestHandler{}
 )
 
 type CustomValidator struct {
@@ -29,8 +45,38 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 	return nil
 }
 
+// ipExtractor 没有配置反向代理时直接使用连接的对端地址, 否则只信任来自这些代理的 X-Forwarded-For,
+// 防止客户端伪造来源 IP 绕过按 IP 的限制
+func ipExtractor(proxies []string) echo.IPExtractor {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			tool.Logger.Errorf("invalid trusted proxy %s: %v", proxy, err)
+			continue
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
 func InitRouter() {
 	Echo.Validator = &CustomValidator{validator: validator.New()}
+	Echo.IPExtractor = ipExtractor(server.GetConfig().HTTP.TrustedProxies)
 	Echo.Use(middleware.Record())
 	Echo.Use(middleware.RecoverWithReturnMsg(server.NewError(tool.GetHeaderLanguage(nil), server.InternalErrCode)))
 	cors := os.Getenv("CORS")
@@ -42,6 +88,13 @@ func InitRouter() {
 		Key: "token",
 		IgnoreURLs: []string{
 			"/lcdp/about",
+			// tus 客户端和浏览器发送的 OPTIONS 不带 token
+			"OPTIONS /lcdp/tus",
+			"/lcdp/share/info",
+			"/lcdp/share/files",
+			"/lcdp/share/download",
+			"/lcdp/request/info",
+			"/lcdp/request/upload",
 		},
 		GetPermissionList: func(k string) []string {
 			client := server.GetRedisClient()
@@ -76,6 +129,7 @@ func InitRouter() {
 			}
 			return map[string]interface{}{
 				// handler 需要用的值
+				server.CtxUserIdentity: info.Identity,
 			}
 		},
 		InternalErrFunc: func(lang string) interface{} {
@@ -93,4 +147,18 @@ func InitRouter() {
 	}))
 
 	initApplicationRouter()
+	initFileUploadRouter()
+	initTusRouter()
+	initAdminRouter()
+	initFileDownloadRouter()
+	initUserFileRouter()
+	initJobRouter()
+	initRecycleRouter()
+	initFileVersionRouter()
+	initSearchRouter()
+	initTagRouter()
+	initArchiveRouter()
+	initFileShareRouter()
+	initDirectShareRouter()
+	initFileRequestRouter()
 }
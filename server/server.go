@@ -9,6 +9,8 @@ import (
 	"strings"
 	"suhc-gitlab-01.inovance.local/mnk/server/lcdp.git/tool"
 
+	"net_disk/server/storage"
+
 	"github.com/bwmarrin/snowflake"
 	"github.com/go-xorm/xorm"
 	"golang.org/x/text/language"
@@ -28,6 +30,7 @@ type Server struct {
 	Node        *snowflake.Node
 	redisClient *redis.Client
 	bundle      *tool.Bundle
+	storage     storage.Backend
 }
 
 func NewServer(configPath, mode string) error {
@@ -65,6 +68,13 @@ func NewServer(configPath, mode string) error {
 	}
 	server.redisClient = redisClient
 
+	backend, err := initStorage(config.Storage)
+	if err != nil {
+		tool.Logger.Error(err.Error())
+		return err
+	}
+	server.storage = backend
+
 	server.bundle = tool.NewBundle(language.Chinese)
 
 	return nil
@@ -118,6 +128,30 @@ func initEngine(config *DBConfig) (*xorm.EngineGroup, error) {
 	return engineGroup, nil
 }
 
+// initStorage 创建存储后端, cos 未配置时沿用默认的 bucket 和环境变量中的密钥
+func initStorage(config storage.Config) (storage.Backend, error) {
+	if config.Type == "" || config.Type == storage.TypeCos {
+		if config.Cos.BucketURL == "" {
+			config.Cos.BucketURL = COSADDR
+		}
+		if config.Cos.SecretID == "" {
+			config.Cos.SecretID = os.Getenv(CloudId)
+		}
+		if config.Cos.SecretKey == "" {
+			config.Cos.SecretKey = os.Getenv(CloudKey)
+		}
+	}
+
+	backend, err := storage.New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tool.Logger.Debugf("storage backend: %s", config.Type)
+
+	return backend, nil
+}
+
 // GetID id generage
 func GetID() int64 {
 	return int64(server.Node.Generate())
@@ -139,10 +173,19 @@ func formatDataSources(sources []string) string {
 	return fmt.Sprintf("%v", formatSources)
 }
 
+// GetStorage storage backend
+func GetStorage() storage.Backend {
+	return server.storage
+}
+
 func GetEngine() *xorm.EngineGroup {
 	return server.Engine
 }
 
+func GetConfig() *Config {
+	return server.Config
+}
+
 func GetPort() int {
 	return server.Config.Port
 }
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/archive"
+	"net_disk/server/models"
+)
+
+// JobTypeExtract 解压任务
+const JobTypeExtract = "extract"
+
+// skippedFolder 按 skip 处理而没有解压的目录, 其中的内容也跳过
+const skippedFolder = -1
+
+func archiveLimits() archive.Limits {
+	config := server.GetConfig().Archive
+	limits := archive.Limits{MaxEntries: 10000, MaxTotalSize: 10240 << 20, MaxRatio: 100}
+	if config.MaxEntries > 0 {
+		limits.MaxEntries = config.MaxEntries
+	}
+	if config.MaxTotalSize > 0 {
+		limits.MaxTotalSize = int64(config.MaxTotalSize) << 20
+	}
+	if config.MaxRatio > 0 {
+		limits.MaxRatio = int64(config.MaxRatio)
+	}
+	return limits
+}
+
+// archiveError 把 archive 包和解码的错误转换成 service 的错误
+func archiveError(err error) error {
+	switch {
+	case errors.Is(err, archive.ErrLimit):
+		return ErrArchiveLimit
+	case errors.Is(err, archive.ErrUnsafePath):
+		return ErrUnsafePath
+	case errors.Is(err, archive.ErrUnsupported), errors.Is(err, zip.ErrFormat), errors.Is(err, zip.ErrAlgorithm),
+		errors.Is(err, gzip.ErrHeader), errors.Is(err, tar.ErrHeader), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrUnsupportedArchive
+	}
+	return err
+}
+
+// openArchive 打开用户的压缩包, zip 需要先下载到临时文件, tar 边下载边读取. 调用方用返回的 func 释放资源
+func openArchive(ctx context.Context, uf *models.UserFile) (archive.Reader, func(), error) {
+	if IsFolder(uf) {
+		return nil, nil, ErrUnsupportedArchive
+	}
+	format, err := archive.DetectFormat(uf.Name)
+	if err != nil {
+		return nil, nil, ErrUnsupportedArchive
+	}
+	fi, err := GetFileInfo(uf.RepositoryIdentity)
+	if err != nil {
+		return nil, nil, err
+	}
+	limits := archiveLimits()
+
+	if format == archive.Zip {
+		f, err := TempBlob(ctx, fi, uf.UserIdentity)
+		if err != nil {
+			return nil, nil, err
+		}
+		ar, err := archive.OpenZip(f, fi.Size, limits)
+		if err != nil {
+			RemoveTemp(f)
+			return nil, nil, archiveError(err)
+		}
+		return ar, func() { ar.Close(); RemoveTemp(f) }, nil
+	}
+
+	r, err := OpenBlob(ctx, fi, uf.UserIdentity, 0, -1)
+	if err != nil {
+		return nil, nil, err
+	}
+	ar, err := archive.OpenTar(r, format, fi.Size, limits)
+	if err != nil {
+		r.Close()
+		return nil, nil, archiveError(err)
+	}
+	return ar, func() { ar.Close(); r.Close() }, nil
+}
+
+// ListArchive 列出压缩包中的文件和目录, 不解压内容
+func ListArchive(ctx context.Context, uf *models.UserFile) ([]archive.Entry, error) {
+	ar, release, err := openArchive(ctx, uf)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	entries := make([]archive.Entry, 0)
+	for {
+		entry, _, err := ar.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, archiveError(err)
+		}
+		entries = append(entries, *entry)
+	}
+}
+
+// ExtractArchive 在后台把压缩包解压到 targetId 目录, 同名冲突按 policy 处理, 默认 rename.
+// 不使用事务, 失败时已经解压的部分保留; 超过限制或包含不安全的路径时任务失败
+func ExtractArchive(userIdentity string, uf *models.UserFile, targetId int, policy string) (*Job, error) {
+	if IsFolder(uf) {
+		return nil, ErrUnsupportedArchive
+	}
+	if _, err := archive.DetectFormat(uf.Name); err != nil {
+		return nil, ErrUnsupportedArchive
+	}
+	if policy == "" {
+		policy = ConflictRename
+	}
+	job := StartJob(userIdentity, JobTypeExtract, 0, func(job *Job) error {
+		ctx := context.Background()
+		ar, release, err := openArchive(ctx, uf)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		session := server.GetEngine().NewSession()
+		defer session.Close()
+		x := &extractor{session: session, userIdentity: userIdentity, targetId: targetId, policy: policy, job: job,
+			folders: map[string]int{".": targetId}}
+		for {
+			entry, r, err := ar.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return archiveError(err)
+			}
+			if entry.IsDir {
+				_, err = x.folder(entry.Path)
+			} else {
+				err = x.file(ctx, entry, r)
+			}
+			if err != nil {
+				return archiveError(err)
+			}
+			job.Progress(1)
+		}
+	})
+	return job, nil
+}
+
+type extractor struct {
+	session      *xorm.Session
+	userIdentity string
+	targetId     int
+	policy       string
+	job          *Job
+	folders      map[string]int // 压缩包中的目录路径 -> UserFile.Id
+}
+
+// folder 返回压缩包中目录对应的 UserFile.Id, 不存在时逐级创建
+func (x *extractor) folder(p string) (int, error) {
+	if id, ok := x.folders[p]; ok {
+		return id, nil
+	}
+	parentId, err := x.folder(path.Dir(p))
+	if err != nil || parentId == skippedFolder {
+		return parentId, err
+	}
+	name, exist, err := resolveConflict(x.session, x.userIdentity, parentId, path.Base(p), true, x.policy)
+	if err != nil {
+		return 0, err
+	}
+	id := skippedFolder
+	switch {
+	case exist != nil && x.policy == ConflictOverwrite:
+		// 合并到已有目录
+		id = exist.Id
+	case exist == nil:
+		folder, err := insertFolder(x.session, x.userIdentity, parentId, name)
+		if err != nil {
+			return 0, err
+		}
+		id = folder.Id
+		if parentId == x.targetId {
+			x.job.Result = append(x.job.Result, folder.Identity)
+		}
+	}
+	x.folders[p] = id
+	return id, nil
+}
+
+// file 保存压缩包中的一个文件, 跳过时不读取内容
+func (x *extractor) file(ctx context.Context, entry *archive.Entry, r io.Reader) error {
+	parentId, err := x.folder(path.Dir(entry.Path))
+	if err != nil || parentId == skippedFolder {
+		return err
+	}
+	name, exist, err := resolveConflict(x.session, x.userIdentity, parentId, path.Base(entry.Path), false, x.policy)
+	if err != nil {
+		return err
+	}
+	if exist != nil && x.policy == ConflictSkip {
+		return nil
+	}
+	fi, err := SaveBlob(ctx, x.userIdentity, r, entry.Size, name, "")
+	if err != nil {
+		return err
+	}
+	target := FileTarget{ParentId: parentId, Name: name, Conflict: x.policy}
+	if exist != nil {
+		target = FileTarget{Identity: exist.Identity}
+	}
+	// 每个文件单独一个事务, 引用计数、密钥和文件记录一起提交, 空间在事务中按实际大小检查
+	unlock, err := LockQuota(ctx, x.userIdentity)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := x.session.Begin(); err != nil {
+		return err
+	}
+	uf, err := x.saveFile(target, fi, entry.ModTime)
+	if err != nil {
+		_ = x.session.Rollback()
+		return err
+	}
+	if err := x.session.Commit(); err != nil {
+		return err
+	}
+	if exist == nil && parentId == x.targetId {
+		x.job.Result = append(x.job.Result, uf.Identity)
+	}
+	return nil
+}
+
+// saveFile 保存文件记录, 使用压缩包中记录的修改时间
+func (x *extractor) saveFile(target FileTarget, fi *models.FileInfo, modTime time.Time) (*models.UserFile, error) {
+	uf, err := SaveUserFile(x.session, x.userIdentity, target, fi)
+	if err != nil || modTime.IsZero() {
+		return uf, err
+	}
+	uf.ModifiedAt = modTime
+	_, err = x.session.ID(uf.Id).Cols("modified_at").Update(uf)
+	return uf, err
+}
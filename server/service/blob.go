@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"net_disk/server"
+	"net_disk/server/crypt"
+	"net_disk/server/models"
+	"net_disk/server/storage"
+	"net_disk/tool"
+)
+
+// objectKey FileInfo.Path 对应的对象 key. 接入存储后端之前 Path 保存的是 COS 对象的完整 URL, 去掉 bucket 地址
+func objectKey(fi *models.FileInfo) string {
+	if !strings.Contains(fi.Path, "://") {
+		return fi.Path
+	}
+	u, err := url.Parse(fi.Path)
+	if err != nil {
+		return fi.Path
+	}
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+// GetFileInfo 按 identity 查找 FileInfo
+func GetFileInfo(identity string) (*models.FileInfo, error) {
+	fi := new(models.FileInfo)
+	has, err := server.GetEngine().Where("identity = ?", identity).Get(fi)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	return fi, nil
+}
+
+// GetFileInfoByHash 按内容 hash 和大小查找已存储的文件, 不存在时返回 nil
+func GetFileInfoByHash(hash string, size int64) (*models.FileInfo, error) {
+	fi := new(models.FileInfo)
+	has, err := server.GetEngine().Where("hash = ? AND size = ?", hash, size).Get(fi)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return fi, nil
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// SaveBlob 把 r 的内容写入存储并创建 FileInfo, hash 为客户端声明的 md5, 不为空时校验实际内容.
+// 相同内容已经存在时删除刚写入的对象, 复用已有的 FileInfo
+func SaveBlob(ctx context.Context, userIdentity string, r io.Reader, size int64, name, hash string) (*models.FileInfo, error) {
+	bc, err := newBlobCipher()
+	if err != nil {
+		return nil, err
+	}
+	hash = strings.ToLower(hash)
+	h := md5.New()
+	counter := &countWriter{}
+	key := storage.NewKey(hash, path.Ext(name))
+	sealed, sealedSize, err := sealObject(io.TeeReader(r, io.MultiWriter(h, counter)), size, bc, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.GetStorage().Put(ctx, key, sealed, sealedSize); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if hash != "" && sum != hash {
+		if err := server.GetStorage().Delete(ctx, key); err != nil {
+			tool.Logger.Errorf("delete object %s error: %v", key, err)
+		}
+		return nil, ErrHashMismatch
+	}
+	if bc != nil {
+		bc.Layout = crypt.Layout{counter.n}
+	}
+
+	return commitBlob(ctx, userIdentity, key, name, sum, counter.n, bc)
+}
+
+// commitBlob 为已写入存储的对象创建 FileInfo, 相同内容已存在时删除该对象并复用已有记录.
+// bc 不为 nil 时对象已加密, 同时为上传者保存数据密钥
+func commitBlob(ctx context.Context, userIdentity, key, name, hash string, size int64, bc *blobCipher) (*models.FileInfo, error) {
+	exist, err := GetFileInfoByHash(hash, size)
+	if err != nil {
+		return nil, err
+	}
+	if exist != nil {
+		if err := server.GetStorage().Delete(ctx, key); err != nil {
+			tool.Logger.Errorf("delete duplicate object %s error: %v", key, err)
+		}
+		return exist, nil
+	}
+
+	// 新文件还没有 UserFile 引用, 如果后续创建 UserFile 失败由 GC 回收
+	fi := &models.FileInfo{
+		Identity:   tool.GenerateUUID(),
+		Hash:       hash,
+		Name:       name,
+		Ext:        path.Ext(name),
+		Size:       size,
+		Path:       key,
+		ReleasedAt: time.Now(),
+	}
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+	if bc != nil {
+		fi.Encrypted = true
+		fi.Layout = bc.Layout.String()
+		wrapped, err := wrapDataKey(userIdentity, bc.Key)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := session.Insert(&models.FileKey{FileIdentity: fi.Identity, UserIdentity: userIdentity, WrappedKey: wrapped}); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := session.Insert(fi); err != nil {
+		return nil, err
+	}
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+// hashObject 读取存储中的对象, 返回明文的 md5 和长度
+func hashObject(ctx context.Context, key string, bc *blobCipher) (string, int64, error) {
+	r, err := openObject(ctx, key, bc, 0, -1)
+	if err != nil {
+		return "", 0, err
+	}
+	defer r.Close()
+	h := md5.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// OpenBlob 以 userIdentity 的身份读取文件内容的 [offset, offset+length) 区间, length < 0 表示读到结尾.
+// 加密文件需要该用户持有 FileKey, userIdentity 为空时见 loadBlobCipher
+func OpenBlob(ctx context.Context, fi *models.FileInfo, userIdentity string, offset, length int64) (io.ReadCloser, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	bc, err := loadBlobCipher(session, fi, userIdentity)
+	if err != nil {
+		return nil, err
+	}
+	return openObject(ctx, objectKey(fi), bc, offset, length)
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/crypt"
+	"net_disk/server/models"
+)
+
+// 存储加密 (信封加密):
+//   - 每个新写入的对象使用随机的数据密钥加密, 见 crypt 包
+//   - 数据密钥用用户密钥加密后保存在 FileKey 中, 每个引用该文件的用户各一份
+//   - 用户密钥用配置中的主密钥加密后保存在 UserKey 中
+//
+// 去重规则:
+//   - 仍然按明文的 md5 + 大小去重, FileInfo.Hash 始终是明文的 hash
+//   - 命中已有文件时丢弃新对象和它的数据密钥, 服务端用已有持有者的密钥解出数据密钥, 再用当前用户的密钥加密一份.
+//     因此去重 (包括秒传) 是跨用户的, 服务端始终能解密所有文件, 加密只防护存储后端的数据泄露
+//   - 文件是否加密由第一次写入时的配置决定, 开启加密前写入的明文文件被命中时继续以明文复用
+//   - 某个用户的 UserKey 丢失只影响他自己的 FileKey, 其它用户的引用不受影响
+
+// blobCipher 加密对象的数据密钥和分段信息
+type blobCipher struct {
+	Key    []byte
+	Layout crypt.Layout
+}
+
+func encryptionEnabled() bool {
+	return server.GetConfig().Encryption.Enabled
+}
+
+func masterKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(server.GetConfig().Encryption.MasterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != crypt.KeySize {
+		return nil, crypt.ErrKeySize
+	}
+	return key, nil
+}
+
+// userKey 用户密钥, 不存在时创建. 密钥创建后不再变化, 因此不使用调用者的事务:
+// 在独立的语句中插入, 并发创建时唯一索引保证只有一条成功, 失败的一方重新读取已有的密钥
+func userKey(userIdentity string) ([]byte, error) {
+	master, err := masterKey()
+	if err != nil {
+		return nil, err
+	}
+	engine := server.GetEngine()
+	uk := new(models.UserKey)
+	has, err := engine.Where("user_identity = ?", userIdentity).Get(uk)
+	if err != nil {
+		return nil, err
+	}
+	if has {
+		return crypt.Unwrap(master, uk.WrappedKey)
+	}
+
+	key, err := crypt.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := crypt.Wrap(master, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := engine.Insert(&models.UserKey{UserIdentity: userIdentity, WrappedKey: wrapped}); err == nil {
+		return key, nil
+	} else if !isDuplicateKey(err) {
+		return nil, err
+	}
+	uk = new(models.UserKey)
+	has, err = engine.Where("user_identity = ?", userIdentity).Get(uk)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	return crypt.Unwrap(master, uk.WrappedKey)
+}
+
+// wrapDataKey 用用户密钥加密数据密钥
+func wrapDataKey(userIdentity string, key []byte) ([]byte, error) {
+	uk, err := userKey(userIdentity)
+	if err != nil {
+		return nil, err
+	}
+	return crypt.Wrap(uk, key)
+}
+
+// newBlobCipher 开启加密时为新对象生成数据密钥, 否则返回 nil
+func newBlobCipher() (*blobCipher, error) {
+	if !encryptionEnabled() {
+		return nil, nil
+	}
+	key, err := crypt.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	return &blobCipher{Key: key}, nil
+}
+
+// loadBlobCipher 用用户自己的 FileKey 解出数据密钥, 文件未加密时返回 nil.
+// userIdentity 为空时使用任意持有者的 FileKey, 用于秒传校验这类还没有建立引用的场景
+func loadBlobCipher(session *xorm.Session, fi *models.FileInfo, userIdentity string) (*blobCipher, error) {
+	if !fi.Encrypted {
+		return nil, nil
+	}
+	fk := new(models.FileKey)
+	query := session.Where("file_identity = ?", fi.Identity)
+	if userIdentity != "" {
+		query = query.And("user_identity = ?", userIdentity)
+	}
+	has, err := query.Asc("id").Get(fk)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	uk, err := userKey(fk.UserIdentity)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypt.Unwrap(uk, fk.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := crypt.ParseLayout(fi.Layout)
+	if err != nil {
+		return nil, err
+	}
+	return &blobCipher{Key: key, Layout: layout}, nil
+}
+
+// grantFileKey 让用户可以解密 fi: 用已有持有者的密钥解出数据密钥, 再用该用户的密钥加密保存一份
+func grantFileKey(session *xorm.Session, userIdentity string, fi *models.FileInfo) error {
+	if !fi.Encrypted {
+		return nil
+	}
+	has, err := session.Where("file_identity = ? AND user_identity = ?", fi.Identity, userIdentity).Exist(new(models.FileKey))
+	if err != nil || has {
+		return err
+	}
+	bc, err := loadBlobCipher(session, fi, "")
+	if err != nil {
+		return err
+	}
+	wrapped, err := wrapDataKey(userIdentity, bc.Key)
+	if err != nil {
+		return err
+	}
+	_, err = session.Insert(&models.FileKey{FileIdentity: fi.Identity, UserIdentity: userIdentity, WrappedKey: wrapped})
+	return err
+}
+
+// sealObject 返回写入存储的流和长度, bc 为 nil 时原样返回
+func sealObject(r io.Reader, size int64, bc *blobCipher, segment int) (io.Reader, int64, error) {
+	if bc == nil {
+		return r, size, nil
+	}
+	sealed, err := crypt.NewEncrypter(r, bc.Key, segment)
+	if err != nil {
+		return nil, 0, err
+	}
+	if size >= 0 {
+		size = crypt.SegmentSize(size)
+	}
+	return sealed, size, nil
+}
+
+// openObject 读取对象明文的 [offset, offset+length) 区间, length < 0 表示读到结尾
+func openObject(ctx context.Context, key string, bc *blobCipher, offset, length int64) (io.ReadCloser, error) {
+	if bc == nil {
+		return server.GetStorage().Get(ctx, key, offset, length)
+	}
+	fetch := func(offset, length int64) (io.ReadCloser, error) {
+		return server.GetStorage().Get(ctx, key, offset, length)
+	}
+	return crypt.OpenRange(fetch, bc.Key, bc.Layout, offset, length)
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"net_disk/server"
+	"net_disk/server/models"
+)
+
+var errInvalidSeek = errors.New("seek: invalid offset")
+
+// BlobReader 文件内容的 io.ReadSeeker, 供 http.ServeContent 使用.
+// Seek 只记录位置, 下一次 Read 时才从该位置打开存储对象, 因此多区间请求只下载需要的部分
+type BlobReader struct {
+	ctx    context.Context
+	fi     *models.FileInfo
+	bc     *blobCipher
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewBlobReader 以 userIdentity 的身份读取 fi, 加密文件需要该用户持有 FileKey
+func NewBlobReader(ctx context.Context, fi *models.FileInfo, userIdentity string) (*BlobReader, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	bc, err := loadBlobCipher(session, fi, userIdentity)
+	if err != nil {
+		return nil, err
+	}
+	return &BlobReader{ctx: ctx, fi: fi, bc: bc}, nil
+}
+
+func (r *BlobReader) Read(p []byte) (int, error) {
+	if r.offset >= r.fi.Size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := openObject(r.ctx, objectKey(r.fi), r.bc, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *BlobReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.fi.Size
+	}
+	if offset < 0 {
+		return 0, errInvalidSeek
+	}
+	if offset != r.offset {
+		r.closeBody()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *BlobReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
+
+func (r *BlobReader) Close() error {
+	r.closeBody()
+	return nil
+}
+
+// TempBlob 把文件内容下载到临时文件, 用于 zip 这类需要随机读取的格式. 调用方用 RemoveTemp 关闭并删除
+func TempBlob(ctx context.Context, fi *models.FileInfo, userIdentity string) (*os.File, error) {
+	r, err := OpenBlob(ctx, fi, userIdentity, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := os.CreateTemp("", "blob-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		RemoveTemp(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+// RemoveTemp 关闭并删除临时文件
+func RemoveTemp(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server/models"
+)
+
+// acquireBlob FileInfo 引用计数 +1, 文件已被 GC 回收时返回 ErrNotFound
+func acquireBlob(session *xorm.Session, repositoryIdentity string) error {
+	affected, err := session.Where("identity = ?", repositoryIdentity).
+		Incr("ref_count").
+		Update(new(models.FileInfo))
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// releaseBlob FileInfo 引用计数 -1, 降为 0 时记录释放时间并删除全文索引
+func releaseBlob(session *xorm.Session, repositoryIdentity string) error {
+	_, err := session.Where("identity = ? AND ref_count > 0", repositoryIdentity).
+		Decr("ref_count").
+		Update(new(models.FileInfo))
+	if err != nil {
+		return err
+	}
+	released, err := session.Where("identity = ? AND ref_count = 0", repositoryIdentity).
+		Cols("released_at").
+		Update(&models.FileInfo{ReleasedAt: time.Now()})
+	if err != nil || released == 0 {
+		return err
+	}
+	return removeFileIndex(session, repositoryIdentity)
+}
+
+// countBlobReferences 实际引用 FileInfo 的记录数, GC 删除前以它为准. 回收站中的文件和历史版本还可以恢复, 也算作引用
+func countBlobReferences(session *xorm.Session, repositoryIdentity string) (int64, error) {
+	files, err := session.Unscoped().Where("repository_identity = ?", repositoryIdentity).Count(new(models.UserFile))
+	if err != nil {
+		return 0, err
+	}
+	versions, err := session.Where("repository_identity = ?", repositoryIdentity).Count(new(models.FileVersion))
+	if err != nil {
+		return 0, err
+	}
+	return files + versions, nil
+}
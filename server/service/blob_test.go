@@ -0,0 +1,21 @@
+package service
+
+import (
+	"testing"
+
+	"net_disk/server/models"
+)
+
+func TestObjectKey(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"ab/cd/abcdef-01020304.txt", "ab/cd/abcdef-01020304.txt"},
+		{"https://disk-1250000000.cos.ap-guangzhou.myqcloud.com/mystorage/0123456789abcde.pdf", "mystorage/0123456789abcde.pdf"},
+	}
+	for _, tt := range tests {
+		if got := objectKey(&models.FileInfo{Path: tt.path}); got != tt.want {
+			t.Errorf("objectKey(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
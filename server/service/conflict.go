@@ -0,0 +1,99 @@
+package service
+
+import (
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server/models"
+)
+
+// 目标目录中已有同名文件或目录时的处理方式
+const (
+	ConflictFail      = "fail"      // 返回 ErrNameExists
+	ConflictRename    = "rename"    // 自动改名为 "name (1).ext"
+	ConflictOverwrite = "overwrite" // 文件覆盖已有文件, 原内容保存为历史版本; 目录和已有目录合并
+	ConflictSkip      = "skip"      // 跳过
+)
+
+// ValidConflictPolicy 空串表示使用接口的默认处理方式
+func ValidConflictPolicy(policy string) bool {
+	switch policy {
+	case "", ConflictFail, ConflictRename, ConflictOverwrite, ConflictSkip:
+		return true
+	}
+	return false
+}
+
+// nameError 并发创建或移动同名文件时, 先提交的一方成功, 另一方违反唯一索引, 同样返回 ErrNameExists
+func nameError(err error) error {
+	if isDuplicateKey(err) {
+		return ErrNameExists
+	}
+	return err
+}
+
+// resolveConflict 按 policy 处理 parentId 目录下的同名冲突, 返回最终使用的名字.
+// exist 不为 nil 时 policy 为 overwrite 或 skip, 由调用方覆盖或跳过
+func resolveConflict(session *xorm.Session, userIdentity string, parentId int, name string, isFolder bool, policy string) (string, *models.UserFile, error) {
+	err := checkName(session, userIdentity, parentId, name, 0)
+	if err != ErrNameExists {
+		return name, nil, err
+	}
+	switch policy {
+	case ConflictRename:
+		name, err = uniqueName(session, userIdentity, parentId, name, isFolder)
+		return name, nil, err
+	case ConflictOverwrite, ConflictSkip:
+		exist := new(models.UserFile)
+		_, err := session.Where("user_identity = ? AND parent_id = ? AND name = ?", userIdentity, parentId, name).Get(exist)
+		if err != nil {
+			return "", nil, err
+		}
+		if policy == ConflictOverwrite && IsFolder(exist) != isFolder {
+			return "", nil, ErrNameExists
+		}
+		return name, exist, nil
+	}
+	return "", nil, ErrNameExists
+}
+
+// mergeInto 用 src 覆盖同名的 dst: 文件覆盖内容, src 的历史版本转给 dst; 目录把 src 的内容合并进 dst.
+// src 的标签转给 dst, 完成后删除 src
+func mergeInto(session *xorm.Session, userIdentity string, src, dst *models.UserFile) error {
+	if err := mergeFileTags(session, src.Id, dst.Id); err != nil {
+		return err
+	}
+	if IsFolder(src) {
+		children, err := listChildren(session, src)
+		if err != nil {
+			return err
+		}
+		for i := range children {
+			if err := moveUserFile(session, userIdentity, &children[i], dst.Id, ConflictOverwrite); err != nil {
+				return err
+			}
+		}
+		_, err = session.Unscoped().ID(src.Id).Delete(new(models.UserFile))
+		return err
+	}
+
+	fi := new(models.FileInfo)
+	has, err := session.Where("identity = ?", src.RepositoryIdentity).Get(fi)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return ErrNotFound
+	}
+	if _, err := overwriteUserFile(session, userIdentity, dst, fi); err != nil {
+		return err
+	}
+	_, err = session.Where("user_file_id = ?", src.Id).Cols("user_file_id").Update(&models.FileVersion{UserFileId: dst.Id})
+	if err != nil {
+		return err
+	}
+	if err := releaseBlob(session, src.RepositoryIdentity); err != nil {
+		return err
+	}
+	_, err = session.Unscoped().ID(src.Id).Delete(new(models.UserFile))
+	return err
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+
+	"net_disk/server/models"
+)
+
+func TestNumberedName(t *testing.T) {
+	tests := []struct {
+		name     string
+		i        int
+		isFolder bool
+		want     string
+	}{
+		{"a.txt", 1, false, "a (1).txt"},
+		{"a.tar.gz", 2, false, "a.tar (2).gz"},
+		{"README", 3, false, "README (3)"},
+		{"v1.0", 1, true, "v1.0 (1)"},
+	}
+	for _, tt := range tests {
+		if got := numberedName(tt.name, tt.i, tt.isFolder); got != tt.want {
+			t.Errorf("numberedName(%q, %d, %v) = %q, want %q", tt.name, tt.i, tt.isFolder, got, tt.want)
+		}
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	session := newTestSession(t, new(models.UserFile))
+	docs := insertTestFile(t, session, "u1", 0, "docs", "")
+	file := insertTestFile(t, session, "u1", 0, "a.txt", "blob-a")
+	insertTestFile(t, session, "u1", 0, "a (1).txt", "blob-a1")
+	// 其他目录和其他用户的同名文件不冲突
+	insertTestFile(t, session, "u1", docs.Id, "b.txt", "blob-b")
+	insertTestFile(t, session, "u2", 0, "b.txt", "blob-b")
+
+	tests := []struct {
+		name     string
+		isFolder bool
+		policy   string
+		want     string
+		exist    *models.UserFile
+		err      error
+	}{
+		{"b.txt", false, "", "b.txt", nil, nil},
+		{"b.txt", false, ConflictRename, "b.txt", nil, nil},
+		{"a.txt", false, "", "", nil, ErrNameExists},
+		{"a.txt", false, ConflictFail, "", nil, ErrNameExists},
+		{"a.txt", false, ConflictRename, "a (2).txt", nil, nil},
+		{"a.txt", false, ConflictOverwrite, "a.txt", file, nil},
+		{"a.txt", false, ConflictSkip, "a.txt", file, nil},
+		{"a.txt", true, ConflictOverwrite, "", nil, ErrNameExists},
+		{"docs", true, ConflictRename, "docs (1)", nil, nil},
+		{"docs", true, ConflictOverwrite, "docs", docs, nil},
+		{"docs", false, ConflictSkip, "docs", docs, nil},
+		{"a/b", false, ConflictRename, "", nil, ErrInvalidName},
+	}
+	for _, tt := range tests {
+		got, exist, err := resolveConflict(session, "u1", 0, tt.name, tt.isFolder, tt.policy)
+		if err != tt.err || (err == nil && got != tt.want) {
+			t.Errorf("resolveConflict(%q, %v, %q) = %q, %v, want %q, %v", tt.name, tt.isFolder, tt.policy, got, err, tt.want, tt.err)
+		}
+		if (exist == nil) != (tt.exist == nil) || (exist != nil && exist.Id != tt.exist.Id) {
+			t.Errorf("resolveConflict(%q, %v, %q) exist = %+v, want %+v", tt.name, tt.isFolder, tt.policy, exist, tt.exist)
+		}
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	session := newTestSession(t, new(models.UserFile))
+	insertTestFile(t, session, "u1", 0, "a.txt", "blob")
+	insertTestFile(t, session, "u1", 0, "a (1).txt", "blob")
+	insertTestFile(t, session, "u1", 0, "a (2).txt", "blob")
+	insertTestFile(t, session, "u1", 0, "dir.v2", "")
+
+	tests := []struct {
+		name     string
+		isFolder bool
+		want     string
+	}{
+		{"new.txt", false, "new.txt"},
+		{"a.txt", false, "a (3).txt"},
+		{"dir.v2", true, "dir.v2 (1)"},
+	}
+	for _, tt := range tests {
+		got, err := uniqueName(session, "u1", 0, tt.name, tt.isFolder)
+		if err != nil || got != tt.want {
+			t.Errorf("uniqueName(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+// 直接分享:
+//   - 分享给注册用户或邮箱, 邮箱对应的用户还没有注册时按 Email 保存, 注册后按邮箱匹配
+//   - 分享目录时, 目录中的内容继承同样的权限, 多个分享取最高的权限
+//   - 导出的 GetUserFile/GetAccessibleFile 按分享检查权限, 内部的 getUserFile 只返回用户自己的文件,
+//     所以移动、删除、标签、公开分享等操作仍然只有所有者可以进行
+//   - 被分享者上传和新建的文件属于所有者, 占用所有者的空间, ModifiedBy 为被分享者
+
+// 直接分享的权限
+const (
+	PermissionView = "view" // 查看和下载
+	PermissionEdit = "edit" // 还可以上传、覆盖、新建目录、重命名和恢复历史版本
+)
+
+// ValidPermission 直接分享的权限
+func ValidPermission(permission string) bool {
+	return permission == PermissionView || permission == PermissionEdit
+}
+
+// userEmail 用户的邮箱, 小写
+func userEmail(session *xorm.Session, userIdentity string) (string, error) {
+	user := new(models.UserInfo)
+	if _, err := session.Where("identity = ?", userIdentity).Cols("email").Get(user); err != nil {
+		return "", err
+	}
+	return strings.ToLower(user.Email), nil
+}
+
+// recipientCondition 匹配 userIdentity 作为被分享者的条件
+func recipientCondition(session *xorm.Session, userIdentity string) (string, []interface{}, error) {
+	email, err := userEmail(session, userIdentity)
+	if err != nil {
+		return "", nil, err
+	}
+	if email == "" {
+		return "direct_share.user_identity = ?", []interface{}{userIdentity}, nil
+	}
+	return "(direct_share.user_identity = ? OR (direct_share.user_identity = '' AND direct_share.email = ?))",
+		[]interface{}{userIdentity, email}, nil
+}
+
+// accessPermission userIdentity 对别人的 uf 的权限, 来自 uf 本身或上级目录上的直接分享, 没有权限时返回空串
+func accessPermission(session *xorm.Session, userIdentity string, uf *models.UserFile) (string, error) {
+	path, err := FolderPath(uf)
+	if err != nil {
+		return "", err
+	}
+	ids := make([]int, 0, len(path))
+	for _, p := range path {
+		ids = append(ids, p.Id)
+	}
+	cond, args, err := recipientCondition(session, userIdentity)
+	if err != nil {
+		return "", err
+	}
+	var shares []models.DirectShare
+	err = session.Table("direct_share").
+		Where("direct_share.owner_identity = ?", uf.UserIdentity).
+		And(cond, args...).
+		In("direct_share.user_file_id", ids).
+		Find(&shares)
+	if err != nil {
+		return "", err
+	}
+	permission := ""
+	for _, share := range shares {
+		if share.Permission == PermissionEdit {
+			return PermissionEdit, nil
+		}
+		permission = share.Permission
+	}
+	return permission, nil
+}
+
+// GetAccessibleFile 用户自己的文件或目录, 或者别人直接分享给用户的文件或目录 (包括分享目录中的内容).
+// 没有分享时返回 ErrNotFound, 权限不够时返回 ErrNoPermission
+func GetAccessibleFile(userIdentity, identity, permission string) (*models.UserFile, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	return getAccessibleFile(session, userIdentity, identity, permission)
+}
+
+func getAccessibleFile(session *xorm.Session, userIdentity, identity, permission string) (*models.UserFile, error) {
+	uf := new(models.UserFile)
+	has, err := session.Where("identity = ?", identity).Get(uf)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	if uf.UserIdentity == userIdentity {
+		return uf, nil
+	}
+	granted, err := accessPermission(session, userIdentity, uf)
+	if err != nil {
+		return nil, err
+	}
+	if granted == "" {
+		return nil, ErrNotFound
+	}
+	if permission == PermissionEdit && granted != PermissionEdit {
+		return nil, ErrNoPermission
+	}
+	return uf, nil
+}
+
+// ResolveFolder 把目录 identity 转成目录所属的用户和 UserFile.Id, 空串表示用户自己的根目录.
+// 别人分享的目录需要 permission 权限
+func ResolveFolder(userIdentity, identity, permission string) (string, int, error) {
+	if identity == "" {
+		return userIdentity, 0, nil
+	}
+	folder, err := GetAccessibleFile(userIdentity, identity, permission)
+	if err != nil {
+		return "", 0, err
+	}
+	if !IsFolder(folder) {
+		return "", 0, ErrNotFound
+	}
+	return folder.UserIdentity, folder.Id, nil
+}
+
+// VisiblePath 用户能看到的从根到 uf 的路径: 自己的文件从根目录开始, 别人分享的从分享的目录开始
+func VisiblePath(userIdentity string, uf *models.UserFile) ([]models.UserFile, error) {
+	path, err := FolderPath(uf)
+	if err != nil || uf.UserIdentity == userIdentity {
+		return path, err
+	}
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	cond, args, err := recipientCondition(session, userIdentity)
+	if err != nil {
+		return nil, err
+	}
+	for i := range path {
+		has, err := session.Table("direct_share").
+			Where("direct_share.owner_identity = ? AND direct_share.user_file_id = ?", uf.UserIdentity, path[i].Id).
+			And(cond, args...).
+			Exist(new(models.DirectShare))
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			return path[i:], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ShareWithUsers 把自己的文件或目录分享给用户和邮箱, 已经分享过的修改为新的权限. 邮箱已注册时分享给对应的用户
+func ShareWithUsers(ownerIdentity, fileIdentity string, users, emails []string, permission string) ([]models.DirectShare, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	uf, err := getUserFile(session, ownerIdentity, fileIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	type recipient struct{ user, email string }
+	recipients := make([]recipient, 0, len(users)+len(emails))
+	for _, identity := range users {
+		user := new(models.UserInfo)
+		has, err := session.Where("identity = ?", identity).Cols("identity", "email").Get(user)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			return nil, ErrNotFound
+		}
+		recipients = append(recipients, recipient{user.Identity, strings.ToLower(user.Email)})
+	}
+	for _, email := range emails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if !strings.Contains(email, "@") {
+			return nil, ErrInvalidEmail
+		}
+		user := new(models.UserInfo)
+		if _, err := session.Where("LOWER(email) = ?", email).Cols("identity").Get(user); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient{user.Identity, email})
+	}
+
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+	result := make([]models.DirectShare, 0, len(recipients))
+	for _, r := range recipients {
+		if r.user == ownerIdentity {
+			continue
+		}
+		share := new(models.DirectShare)
+		query := session.Where("owner_identity = ? AND user_file_id = ?", ownerIdentity, uf.Id)
+		if r.user != "" {
+			query = query.And("user_identity = ?", r.user)
+		} else {
+			query = query.And("user_identity = '' AND email = ?", r.email)
+		}
+		has, err := query.Get(share)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			share.Permission = permission
+			_, err = session.ID(share.Id).Cols("permission").Update(share)
+		} else {
+			share = &models.DirectShare{
+				Identity:      tool.GenerateUUID(),
+				OwnerIdentity: ownerIdentity,
+				UserFileId:    uf.Id,
+				UserIdentity:  r.user,
+				Email:         r.email,
+				Permission:    permission,
+			}
+			_, err = session.Insert(share)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *share)
+	}
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DirectShareItem 文件的一个被分享者
+type DirectShareItem struct {
+	models.DirectShare `xorm:"extends"`
+	UserName           string
+}
+
+// ListRecipients 自己的文件或目录被直接分享给了哪些用户和邮箱
+func ListRecipients(ownerIdentity, fileIdentity string) ([]DirectShareItem, error) {
+	uf, err := GetUserFile(ownerIdentity, fileIdentity)
+	if err != nil {
+		return nil, err
+	}
+	if uf.UserIdentity != ownerIdentity {
+		return nil, ErrNoPermission
+	}
+	items := make([]DirectShareItem, 0)
+	err = server.GetEngine().Table("direct_share").
+		Select("direct_share.*, COALESCE(user_info.name, '') AS user_name").
+		Join("LEFT", "user_info", "user_info.identity = direct_share.user_identity AND direct_share.user_identity <> ''").
+		Where("direct_share.owner_identity = ? AND direct_share.user_file_id = ?", ownerIdentity, uf.Id).
+		Asc("direct_share.id").
+		Find(&items)
+	return items, err
+}
+
+// UpdateDirectShare 修改被分享者的权限
+func UpdateDirectShare(ownerIdentity, identity, permission string) error {
+	n, err := server.GetEngine().Where("owner_identity = ? AND identity = ?", ownerIdentity, identity).
+		Cols("permission").Update(&models.DirectShare{Permission: permission})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeDirectShares 取消对某些用户的分享, 立即失去访问权限
+func RevokeDirectShares(ownerIdentity string, identities []string) error {
+	_, err := server.GetEngine().Where("owner_identity = ?", ownerIdentity).In("identity", identities).
+		Delete(new(models.DirectShare))
+	return err
+}
+
+// SharedItem "共享给我的" 列表中的一项
+type SharedItem struct {
+	UserFileItem  `xorm:"extends"`
+	ShareIdentity string
+	Permission    string
+	OwnerName     string
+	SharedAt      time.Time
+}
+
+// ListSharedWithMe 分页列出别人直接分享给用户的文件和目录, 最近分享的在前. 所有者移入回收站的不显示
+func ListSharedWithMe(userIdentity string, page, pageSize int) ([]SharedItem, int64, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	cond, args, err := recipientCondition(session, userIdentity)
+	if err != nil {
+		return nil, 0, err
+	}
+	items := make([]SharedItem, 0, pageSize)
+	count, err := session.Table("user_file").
+		Select("user_file.*, COALESCE(file_info.size, 0) AS size, direct_share.identity AS share_identity, "+
+			"direct_share.permission, COALESCE(user_info.name, '') AS owner_name, direct_share.created_at AS shared_at").
+		Join("INNER", "direct_share", "direct_share.user_file_id = user_file.id AND direct_share.owner_identity = user_file.user_identity").
+		Join("LEFT", "file_info", "file_info.identity = user_file.repository_identity").
+		Join("LEFT", "user_info", "user_info.identity = user_file.user_identity").
+		Where(cond, args...).
+		OrderBy("direct_share.id DESC").
+		Limit(pageSize, (page-1)*pageSize).
+		FindAndCount(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrChallengeFailed = errors.New("ownership challenge failed")
+
+	ErrInvalidPart      = errors.New("invalid part")
+	ErrUploadIncomplete = errors.New("upload incomplete")
+	ErrUploadInProgress = errors.New("upload session is locked by another request")
+	ErrOffsetMismatch   = errors.New("upload offset mismatch")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrHashMismatch     = errors.New("file hash mismatch")
+
+	ErrGCRunning = errors.New("gc is running")
+
+	ErrInvalidName = errors.New("invalid file name")
+	ErrNameExists  = errors.New("file name already exists")
+	ErrCycle       = errors.New("cannot move or copy a folder into itself")
+
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	ErrInvalidTag = errors.New("invalid tag name or color")
+	ErrTagExists  = errors.New("tag already exists")
+
+	ErrTooManyEntries = errors.New("too many files")
+
+	ErrUnsupportedArchive = errors.New("unsupported or corrupted archive")
+	ErrArchiveLimit       = errors.New("archive exceeds extraction limits")
+	ErrUnsafePath         = errors.New("archive contains unsafe path")
+
+	ErrShareExpired    = errors.New("share link expired")
+	ErrShareCode       = errors.New("wrong share code")
+	ErrShareExhausted  = errors.New("share download limit reached")
+	ErrTooManyAttempts = errors.New("too many failed attempts")
+
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+	ErrNoPermission = errors.New("permission denied")
+	ErrInvalidEmail = errors.New("invalid email")
+
+	ErrRequestClosed   = errors.New("file request expired or closed")
+	ErrRequestFull     = errors.New("file request reached the file limit")
+	ErrRequestPassword = errors.New("wrong file request password")
+	ErrFileTooLarge    = errors.New("file too large")
+	ErrFileType        = errors.New("file type not allowed")
+)
+
+// isDuplicateKey 插入或更新违反了唯一索引
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"net_disk/server"
+	"net_disk/server/models"
+)
+
+// 文件收集:
+//   - 创建者指定自己的一个目录, 没有账号的人通过链接上传文件到这个目录, 同名时自动改名
+//   - 上传的文件属于创建者并占用创建者的空间, 上传者的名字和 IP 记录在 FileRequestUpload
+//   - 密码错误次数按 IP 和按链接限制, 和分享的提取码相同
+
+const (
+	// MaxUploaderName 上传者名字的最大长度
+	MaxUploaderName = 64
+	// MaxRequestFormOverhead 上传请求中除文件内容以外的部分(表单字段和 multipart 分隔)的长度上限
+	MaxRequestFormOverhead = 64 << 10
+)
+
+// FileRequestOptions 收集链接的限制, 0 和空值表示不限制
+type FileRequestOptions struct {
+	Title       string
+	Days        int // 有效天数, 同分享 1/7/30, 0 为永久有效
+	MaxFileSize int64
+	Exts        []string // 允许的扩展名, 可以不带点, 不区分大小写
+	MaxFiles    int
+	Password    string
+}
+
+// FileRequestURL 收集链接
+func FileRequestURL(req *models.FileRequest) string {
+	base := server.GetConfig().Share.RequestURL
+	if base == "" {
+		base = "/r/"
+	}
+	return base + req.Identity
+}
+
+// normalizeExts 把扩展名转成 ".pdf,.docx" 的形式
+func normalizeExts(exts []string) string {
+	result := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		result = append(result, ext)
+	}
+	return strings.Join(result, ",")
+}
+
+func checkRequestPassword(hashed, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+}
+
+// CreateFileRequest 为自己的 folderId 目录创建收集链接
+func CreateFileRequest(userIdentity string, folderId int, opts FileRequestOptions) (*models.FileRequest, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	req := &models.FileRequest{
+		UserIdentity: userIdentity,
+		FolderId:     folderId,
+		Title:        strings.TrimSpace(opts.Title),
+		MaxFileSize:  opts.MaxFileSize,
+		Exts:         normalizeExts(opts.Exts),
+		MaxFiles:     opts.MaxFiles,
+	}
+	if opts.Days > 0 {
+		req.ExpiredAt = time.Now().AddDate(0, 0, opts.Days)
+	}
+	if opts.Password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		req.Password = string(hashed)
+	}
+	for {
+		identity, err := randomString(shareChars, shareIdentityLength)
+		if err != nil {
+			return nil, err
+		}
+		has, err := session.Unscoped().Where("identity = ?", identity).Exist(new(models.FileRequest))
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			req.Identity = identity
+			break
+		}
+	}
+	if _, err := session.Insert(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// FileRequestItem 收集链接列表中的一项, 目录已被删除时 Folder 为 nil. 根目录的 Folder 也为 nil
+type FileRequestItem struct {
+	models.FileRequest
+	Folder *models.UserFile
+}
+
+// ListFileRequests 分页列出用户的收集链接, 最近创建的在前
+func ListFileRequests(userIdentity string, page, pageSize int) ([]FileRequestItem, int64, error) {
+	engine := server.GetEngine()
+	requests := make([]models.FileRequest, 0, pageSize)
+	count, err := engine.Where("user_identity = ?", userIdentity).
+		Desc("id").
+		Limit(pageSize, (page-1)*pageSize).
+		FindAndCount(&requests)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int, 0, len(requests))
+	for _, req := range requests {
+		if req.FolderId != 0 {
+			ids = append(ids, req.FolderId)
+		}
+	}
+	var folders []models.UserFile
+	if len(ids) > 0 {
+		if err := engine.Where("user_identity = ?", userIdentity).In("id", ids).Find(&folders); err != nil {
+			return nil, 0, err
+		}
+	}
+	byId := make(map[int]*models.UserFile, len(folders))
+	for i := range folders {
+		byId[folders[i].Id] = &folders[i]
+	}
+	items := make([]FileRequestItem, 0, len(requests))
+	for _, req := range requests {
+		items = append(items, FileRequestItem{FileRequest: req, Folder: byId[req.FolderId]})
+	}
+	return items, count, nil
+}
+
+// CloseFileRequests 关闭收集链接, 已经上传的文件保留
+func CloseFileRequests(userIdentity string, identities []string) error {
+	_, err := server.GetEngine().Where("user_identity = ?", userIdentity).In("identity", identities).
+		Delete(new(models.FileRequest))
+	return err
+}
+
+// FileRequestUploadItem 收集到的一个文件, 文件已被删除时 UserFile 为 nil
+type FileRequestUploadItem struct {
+	models.FileRequestUpload
+	UserFile *models.UserFile
+}
+
+// ListFileRequestUploads 分页列出自己的收集链接收到的文件, 包括已关闭的链接, 最近上传的在前
+func ListFileRequestUploads(userIdentity, identity string, page, pageSize int) ([]FileRequestUploadItem, int64, error) {
+	engine := server.GetEngine()
+	req := new(models.FileRequest)
+	has, err := engine.Unscoped().Where("identity = ? AND user_identity = ?", identity, userIdentity).Get(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !has {
+		return nil, 0, ErrNotFound
+	}
+	uploads := make([]models.FileRequestUpload, 0, pageSize)
+	count, err := engine.Where("request_id = ?", req.Id).
+		Desc("id").
+		Limit(pageSize, (page-1)*pageSize).
+		FindAndCount(&uploads)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int, 0, len(uploads))
+	for _, upload := range uploads {
+		ids = append(ids, upload.UserFileId)
+	}
+	var files []models.UserFile
+	if len(ids) > 0 {
+		if err := engine.Where("user_identity = ?", userIdentity).In("id", ids).Find(&files); err != nil {
+			return nil, 0, err
+		}
+	}
+	byId := make(map[int]*models.UserFile, len(files))
+	for i := range files {
+		byId[files[i].Id] = &files[i]
+	}
+	items := make([]FileRequestUploadItem, 0, len(uploads))
+	for _, upload := range uploads {
+		items = append(items, FileRequestUploadItem{FileRequestUpload: upload, UserFile: byId[upload.UserFileId]})
+	}
+	return items, count, nil
+}
+
+// GetFileRequest 公开访问收集链接, 已关闭或过期时返回 ErrRequestClosed, 不检查密码
+func GetFileRequest(identity string) (*models.FileRequest, error) {
+	req := new(models.FileRequest)
+	has, err := server.GetEngine().Where("identity = ?", identity).Get(req)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	if !req.ExpiredAt.IsZero() && time.Now().After(req.ExpiredAt) {
+		return nil, ErrRequestClosed
+	}
+	return req, nil
+}
+
+// CheckRequestPassword 上传前检查链接的密码. 同一 IP 或同一链接连续输错密码过多时返回 ErrTooManyAttempts
+func CheckRequestPassword(ctx context.Context, req *models.FileRequest, password, ip string) error {
+	if req.Password == "" {
+		return nil
+	}
+	if err := checkFails(ctx, "request:fail:", req.Identity, ip); err != nil {
+		return err
+	}
+	if !checkRequestPassword(req.Password, password) {
+		if err := recordFail(ctx, "request:fail:", req.Identity, ip); err != nil {
+			return err
+		}
+		return ErrRequestPassword
+	}
+	return nil
+}
+
+// RequestExts 允许的扩展名, 空表示不限制
+func RequestExts(req *models.FileRequest) []string {
+	if req.Exts == "" {
+		return []string{}
+	}
+	return strings.Split(req.Exts, ",")
+}
+
+// checkRequestFile 检查文件的大小和扩展名
+func checkRequestFile(req *models.FileRequest, name string, size int64) error {
+	if req.MaxFileSize > 0 && size > req.MaxFileSize {
+		return ErrFileTooLarge
+	}
+	if req.Exts == "" {
+		return nil
+	}
+	ext := strings.ToLower(path.Ext(name))
+	for _, allowed := range RequestExts(req) {
+		if ext == allowed {
+			return nil
+		}
+	}
+	return ErrFileType
+}
+
+// UploadToRequest 把匿名上传的文件保存到收集链接的目录, 同名时自动改名.
+// 文件数在保存文件的事务中累加, 并发上传也不会超过 MaxFiles
+func UploadToRequest(ctx context.Context, req *models.FileRequest, r io.Reader, size int64, name, uploaderName, ip string) (*models.UserFile, error) {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if err := checkRequestFile(req, name, size); err != nil {
+		return nil, err
+	}
+	if req.MaxFiles > 0 && req.Uploaded >= req.MaxFiles {
+		return nil, ErrRequestFull
+	}
+	if req.FolderId != 0 {
+		// 目录被删除或移入回收站后不能再上传
+		has, err := server.GetEngine().Where("id = ? AND user_identity = ?", req.FolderId, req.UserIdentity).
+			Exist(new(models.UserFile))
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			return nil, ErrRequestClosed
+		}
+	}
+	if err := checkQuota(req.UserIdentity, size); err != nil {
+		return nil, err
+	}
+
+	fi, err := SaveBlob(ctx, req.UserIdentity, r, size, name, "")
+	if err != nil {
+		return nil, err
+	}
+	if req.MaxFileSize > 0 && fi.Size > req.MaxFileSize {
+		return nil, ErrFileTooLarge
+	}
+
+	unlock, err := LockQuota(ctx, req.UserIdentity)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+	n, err := session.ID(req.Id).Where("max_files = 0 OR uploaded < max_files").Incr("uploaded").
+		Update(new(models.FileRequest))
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrRequestFull
+	}
+	target := FileTarget{Owner: req.UserIdentity, ParentId: req.FolderId, Name: name, Conflict: ConflictRename}
+	uf, err := saveUserFile(session, req.UserIdentity, target, fi)
+	if err != nil {
+		return nil, err
+	}
+	_, err = session.Insert(&models.FileRequestUpload{
+		RequestId:    req.Id,
+		UserFileId:   uf.Id,
+		Name:         name,
+		Size:         fi.Size,
+		UploaderName: uploaderName,
+		Ip:           ip,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	enqueueIndex(fi, uf.Ext)
+	return uf, nil
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+const versionPruneLockKey = "version:prune:lock"
+
+// 空间锁, 保存的事务很短, 等待超过 quotaLockWait 时放弃
+const (
+	quotaLockPrefix = "quota:lock:"
+	quotaLockTTL    = time.Minute
+	quotaLockWait   = 30 * time.Second
+)
+
+// overwriteUserFile 把 uf 的内容替换成 fi, 原内容保存为历史版本. userIdentity 为写入的用户
+func overwriteUserFile(session *xorm.Session, userIdentity string, uf *models.UserFile, fi *models.FileInfo) (*models.UserFile, error) {
+	if IsFolder(uf) {
+		return nil, ErrNotFound
+	}
+	if uf.RepositoryIdentity == fi.Identity {
+		return uf, nil
+	}
+	old := new(models.FileInfo)
+	has, err := session.Where("identity = ?", uf.RepositoryIdentity).Get(old)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	if err := acquireBlob(session, fi.Identity); err != nil {
+		return nil, err
+	}
+	if err := grantFileKey(session, uf.UserIdentity, fi); err != nil {
+		return nil, err
+	}
+
+	// 原内容的引用转给历史版本
+	version := &models.FileVersion{
+		Identity:           tool.GenerateUUID(),
+		UserFileId:         uf.Id,
+		UserIdentity:       uf.UserIdentity,
+		RepositoryIdentity: old.Identity,
+		Size:               old.Size,
+		Hash:               old.Hash,
+		ModifiedBy:         uf.ModifiedBy,
+		ModifiedAt:         uf.ModifiedAt,
+	}
+	if version.ModifiedBy == "" {
+		version.ModifiedBy = uf.UserIdentity
+	}
+	if version.ModifiedAt.IsZero() {
+		version.ModifiedAt = uf.CreatedAt
+	}
+	if _, err := session.Insert(version); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	uf.RepositoryIdentity = fi.Identity
+	uf.ModifiedBy, uf.ModifiedAt, uf.UpdatedAt = userIdentity, now, now
+	_, err = session.ID(uf.Id).Cols("repository_identity", "modified_by", "modified_at", "updated_at").Update(uf)
+	if err != nil {
+		return nil, err
+	}
+	return uf, pruneVersions(session, uf.Id)
+}
+
+// ListFileVersions 文件的历史版本, 最近的在前
+func ListFileVersions(uf *models.UserFile) ([]models.FileVersion, error) {
+	versions := make([]models.FileVersion, 0)
+	err := server.GetEngine().Where("user_file_id = ?", uf.Id).Desc("id").Find(&versions)
+	return versions, err
+}
+
+// GetFileVersion 文件的某个历史版本
+func GetFileVersion(uf *models.UserFile, identity string) (*models.FileVersion, error) {
+	version := new(models.FileVersion)
+	has, err := server.GetEngine().Where("identity = ? AND user_file_id = ?", identity, uf.Id).Get(version)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	return version, nil
+}
+
+// RestoreFileVersion 把历史版本恢复为当前内容, 当前内容保存为新的历史版本
+func RestoreFileVersion(userIdentity string, uf *models.UserFile, versionIdentity string) (*models.UserFile, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+	version := new(models.FileVersion)
+	has, err := session.Where("identity = ? AND user_file_id = ?", versionIdentity, uf.Id).Get(version)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	fi := new(models.FileInfo)
+	has, err = session.Where("identity = ?", version.RepositoryIdentity).Get(fi)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+
+	// 先删除被恢复的版本, 避免覆盖时按保留策略清理到它. 覆盖时增加引用后再释放版本的引用,
+	// 引用数不会中途降为 0, 全文索引不会被删除
+	if _, err := session.ID(version.Id).Delete(new(models.FileVersion)); err != nil {
+		return nil, err
+	}
+	if uf, err = overwriteUserFile(session, userIdentity, uf, fi); err != nil {
+		return nil, err
+	}
+	if err := releaseBlob(session, version.RepositoryIdentity); err != nil {
+		return nil, err
+	}
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	enqueueIndex(fi, uf.Ext)
+	return uf, nil
+}
+
+// deleteVersions 删除历史版本并释放文件引用
+func deleteVersions(session *xorm.Session, versions []models.FileVersion) error {
+	for _, v := range versions {
+		if _, err := session.ID(v.Id).Delete(new(models.FileVersion)); err != nil {
+			return err
+		}
+		if err := releaseBlob(session, v.RepositoryIdentity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeVersions 文件被彻底删除时删除它的所有历史版本
+func purgeVersions(session *xorm.Session, userFileId int) error {
+	var versions []models.FileVersion
+	if err := session.Where("user_file_id = ?", userFileId).Find(&versions); err != nil {
+		return err
+	}
+	return deleteVersions(session, versions)
+}
+
+// pruneVersions 按 keep_last 删除超出数量的旧版本
+func pruneVersions(session *xorm.Session, userFileId int) error {
+	keep := server.GetConfig().Version.KeepLast
+	if keep <= 0 {
+		return nil
+	}
+	var versions []models.FileVersion
+	if err := session.Where("user_file_id = ?", userFileId).Desc("id").Find(&versions); err != nil {
+		return err
+	}
+	if len(versions) <= keep {
+		return nil
+	}
+	return deleteVersions(session, versions[keep:])
+}
+
+// PruneExpiredVersions 按 keep_days 删除过期的版本, 返回删除的数量
+func PruneExpiredVersions(ctx context.Context) (int, error) {
+	days := server.GetConfig().Version.KeepDays
+	if days <= 0 {
+		return 0, nil
+	}
+	client := server.GetRedisClient()
+	ok, err := client.SetNX(ctx, versionPruneLockKey, 1, time.Hour).Result()
+	if err != nil || !ok {
+		return 0, err
+	}
+	defer client.Del(context.Background(), versionPruneLockKey)
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	pruned := 0
+	for {
+		var versions []models.FileVersion
+		err := server.GetEngine().Where("created_at < ?", cutoff).Asc("id").Limit(recyclePurgeBatch).Find(&versions)
+		if err != nil {
+			return pruned, err
+		}
+		session := server.GetEngine().NewSession()
+		err = deleteVersions(session, versions)
+		session.Close()
+		if err != nil {
+			return pruned, err
+		}
+		pruned += len(versions)
+		if len(versions) < recyclePurgeBatch {
+			return pruned, nil
+		}
+	}
+}
+
+// StartVersionPrune 每小时清理一次过期的历史版本
+func StartVersionPrune(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			pruned, err := PruneExpiredVersions(ctx)
+			if err != nil {
+				tool.Logger.Errorf("prune file versions error: %v", err)
+				continue
+			}
+			if pruned > 0 {
+				tool.Logger.Infof("pruned %d expired file versions", pruned)
+			}
+		}
+	}()
+}
+
+// Usage 用户占用的空间. 同一内容被引用多次时按次数计算
+type Usage struct {
+	Files    int64 // 正常文件
+	Recycle  int64 // 回收站中的文件
+	Versions int64 // 历史版本
+}
+
+// Total 总占用
+func (u *Usage) Total() int64 {
+	return u.Files + u.Recycle + u.Versions
+}
+
+// UserQuota 用户的空间上限, 0 表示不限制
+func UserQuota() int64 {
+	return server.GetConfig().Quota.Default << 20
+}
+
+// CheckUploadQuota 上传前按声明的大小检查目标所有者的空间, 避免传完才发现超出. 保存时 saveUserFile 还会按实际大小再检查
+func CheckUploadQuota(userIdentity string, target FileTarget, size int64) error {
+	return checkQuota(target.owner(userIdentity), size)
+}
+
+// checkQuota 再占用 size 字节后超出空间上限时返回 ErrQuotaExceeded. 保存前的检查需要持有 LockQuota
+func checkQuota(userIdentity string, size int64) error {
+	quota := UserQuota()
+	if quota <= 0 {
+		return nil
+	}
+	usage, err := GetUsage(userIdentity)
+	if err != nil {
+		return err
+	}
+	if usage.Total()+size > quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// LockQuota 获取用户的空间锁. 增加占用的操作在锁内检查空间并提交保存的事务, 锁持有到事务提交之后,
+// 否则并发的保存都能通过检查. 不限制空间时不加锁
+func LockQuota(ctx context.Context, userIdentity string) (unlock func(), err error) {
+	if UserQuota() <= 0 {
+		return func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, quotaLockWait)
+	defer cancel()
+	return waitLock(ctx, quotaLockPrefix+userIdentity, quotaLockTTL, 50*time.Millisecond)
+}
+
+// GetUsage 统计用户占用的空间, 包括回收站和历史版本
+func GetUsage(userIdentity string) (*Usage, error) {
+	engine := server.GetEngine()
+	sum := func(unscoped bool) (int64, error) {
+		session := engine.Table("user_file").
+			Join("INNER", "file_info", "file_info.identity = user_file.repository_identity").
+			Where("user_file.user_identity = ?", userIdentity)
+		if unscoped {
+			session = session.Unscoped()
+		}
+		return session.SumInt(new(models.UserFile), "file_info.size")
+	}
+	files, err := sum(false)
+	if err != nil {
+		return nil, err
+	}
+	all, err := sum(true)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := engine.Where("user_identity = ?", userIdentity).SumInt(new(models.FileVersion), "size")
+	if err != nil {
+		return nil, err
+	}
+	return &Usage{Files: files, Recycle: all - files, Versions: versions}, nil
+}
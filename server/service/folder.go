@@ -0,0 +1,213 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+const (
+	// MaxNameLength 文件名最大字符数
+	MaxNameLength = 255
+	// 目录的最大层级, 查找路径时防止数据异常导致死循环
+	maxFolderDepth = 1000
+)
+
+// 目录列表排序字段
+const (
+	SortByName = "name"
+	SortBySize = "size"
+	SortByTime = "time"
+)
+
+// UserFileItem 目录列表中的一项, 目录的 Size 为 0
+type UserFileItem struct {
+	models.UserFile `xorm:"extends"`
+	Size            int64
+}
+
+// IsFolder 目录没有对应的 FileInfo
+func IsFolder(uf *models.UserFile) bool {
+	return uf.RepositoryIdentity == ""
+}
+
+// checkName 校验文件名, 并且同一目录下不能重名. excludeId 为重命名的记录本身
+func checkName(session *xorm.Session, userIdentity string, parentId int, name string, excludeId int) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") ||
+		utf8.RuneCountInString(name) > MaxNameLength {
+		return ErrInvalidName
+	}
+	has, err := session.Where("user_identity = ? AND parent_id = ? AND name = ? AND id <> ?", userIdentity, parentId, name, excludeId).
+		Exist(new(models.UserFile))
+	if err != nil {
+		return err
+	}
+	if has {
+		return ErrNameExists
+	}
+	return nil
+}
+
+// CreateFolder 在 parentId 目录下新建目录
+func CreateFolder(userIdentity string, parentId int, name string) (*models.UserFile, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := checkName(session, userIdentity, parentId, name, 0); err != nil {
+		return nil, err
+	}
+	return insertFolder(session, userIdentity, parentId, name)
+}
+
+// insertFolder 不检查重名, 调用方需要先调用 checkName
+func insertFolder(session *xorm.Session, userIdentity string, parentId int, name string) (*models.UserFile, error) {
+	folder := &models.UserFile{
+		Identity:     tool.GenerateUUID(),
+		UserIdentity: userIdentity,
+		ParentId:     parentId,
+		Name:         name,
+		UpdatedAt:    time.Now(),
+	}
+	if _, err := session.Insert(folder); err != nil {
+		return nil, nameError(err)
+	}
+	return folder, nil
+}
+
+// ListFolder 分页列出目录内容, 目录在前, 再按 sort 排序. tagId 不为 0 时只列出带有该标签的
+func ListFolder(userIdentity string, parentId, tagId int, sort string, desc bool, page, pageSize int) ([]UserFileItem, int64, error) {
+	engine := server.GetEngine()
+	query := func() *xorm.Session {
+		session := engine.Table("user_file").
+			Where("user_file.user_identity = ? AND user_file.parent_id = ?", userIdentity, parentId)
+		if tagId != 0 {
+			session.Join("INNER", "user_file_tag", "user_file_tag.user_file_id = user_file.id AND user_file_tag.tag_id = ?", tagId)
+		}
+		return session
+	}
+	count, err := query().Count(new(models.UserFile))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	column := "user_file.name"
+	switch sort {
+	case SortBySize:
+		column = "size"
+	case SortByTime:
+		column = "user_file.updated_at"
+	}
+	if desc {
+		column += " DESC"
+	}
+	items := make([]UserFileItem, 0, pageSize)
+	err = query().
+		Select("user_file.*, COALESCE(file_info.size, 0) AS size").
+		Join("LEFT", "file_info", "file_info.identity = user_file.repository_identity").
+		OrderBy("user_file.repository_identity = '' DESC, "+column+", user_file.id").
+		Limit(pageSize, (page-1)*pageSize).
+		Find(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
+
+// FolderPath 从根目录到 uf 的路径, 不包含根目录, 包含 uf 本身
+func FolderPath(uf *models.UserFile) ([]models.UserFile, error) {
+	engine := server.GetEngine()
+	path := []models.UserFile{*uf}
+	for parentId := uf.ParentId; parentId != 0; {
+		if len(path) > maxFolderDepth {
+			return nil, ErrNotFound
+		}
+		parent := new(models.UserFile)
+		has, err := engine.Where("id = ? AND user_identity = ?", parentId, uf.UserIdentity).Get(parent)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			return nil, ErrNotFound
+		}
+		path = append(path, *parent)
+		parentId = parent.ParentId
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, nil
+}
+
+// RenameUserFile 重命名文件或目录, 文件的扩展名随新名字变化
+func RenameUserFile(uf *models.UserFile, name string) error {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := checkName(session, uf.UserIdentity, uf.ParentId, name, uf.Id); err != nil {
+		return err
+	}
+	uf.Name = name
+	if !IsFolder(uf) {
+		uf.Ext = path.Ext(name)
+	}
+	uf.UpdatedAt = time.Now()
+	_, err := session.ID(uf.Id).Cols("name", "ext", "updated_at").Update(uf)
+	return nameError(err)
+}
+
+// uniqueName 同一目录下 name 已存在时依次尝试 "name (1).ext", "name (2).ext" ...
+func uniqueName(session *xorm.Session, userIdentity string, parentId int, name string, isFolder bool) (string, error) {
+	candidate := name
+	for i := 1; ; i++ {
+		err := checkName(session, userIdentity, parentId, candidate, 0)
+		if err != ErrNameExists {
+			return candidate, err
+		}
+		candidate = numberedName(name, i, isFolder)
+	}
+}
+
+// numberedName "name (i).ext", 目录名不拆分扩展名
+func numberedName(name string, i int, isFolder bool) string {
+	base, ext := name, ""
+	if !isFolder {
+		ext = path.Ext(name)
+		base = strings.TrimSuffix(name, ext)
+	}
+	return fmt.Sprintf("%s (%d)%s", base, i, ext)
+}
+
+// listSubtree uf 下所有的子目录和文件, 不包含 uf 本身
+func listSubtree(session *xorm.Session, uf *models.UserFile) ([]UserFileItem, error) {
+	var items []UserFileItem
+	if !IsFolder(uf) {
+		return items, nil
+	}
+	folders := []int{uf.Id}
+	for len(folders) > 0 {
+		var children []UserFileItem
+		err := session.Table("user_file").
+			Select("user_file.*, COALESCE(file_info.size, 0) AS size").
+			Join("LEFT", "file_info", "file_info.identity = user_file.repository_identity").
+			Where("user_file.user_identity = ?", uf.UserIdentity).
+			In("user_file.parent_id", folders).
+			Find(&children)
+		if err != nil {
+			return nil, err
+		}
+		folders = folders[:0]
+		for i := range children {
+			if IsFolder(&children[i].UserFile) {
+				folders = append(folders, children[i].Id)
+			}
+		}
+		items = append(items, children...)
+	}
+	return items, nil
+}
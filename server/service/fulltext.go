@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/fulltext"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+// 全文检索:
+//   - 索引按 FileInfo 建立, 相同内容的文件共用一份索引, 查询时关联用户的 UserFile, 所以移入回收站的文件不会被搜到, 恢复后又能搜到
+//   - 保存文件后把 FileInfo 放入 redis 队列, 由 StartIndexer 启动的后台任务提取文本并写入 FileText 和 FileTerm
+//   - FileInfo 不再被任何 UserFile 和历史版本引用时删除索引, 见 releaseBlob
+
+const (
+	indexQueueKey    = "fulltext:queue"
+	indexLockPrefix  = "fulltext:lock:"
+	indexInsertBatch = 500
+	// MaxQueryTerms 查询拆分出的词数上限
+	MaxQueryTerms = 32
+)
+
+func fullTextEnabled() bool {
+	return server.GetConfig().FullText.Enabled
+}
+
+func maxIndexFileSize() int64 {
+	if size := server.GetConfig().FullText.MaxFileSize; size > 0 {
+		return int64(size) << 20
+	}
+	return 20 << 20
+}
+
+func maxIndexText() int {
+	if size := server.GetConfig().FullText.MaxText; size > 0 {
+		return size << 10
+	}
+	return 1 << 20
+}
+
+// enqueueIndex 支持的文件类型放入索引队列, 已建过索引的在后台任务中跳过
+func enqueueIndex(fi *models.FileInfo, ext string) {
+	if !fullTextEnabled() || !fulltext.Supported(ext) || fi.Size > maxIndexFileSize() {
+		return
+	}
+	err := server.GetRedisClient().LPush(context.Background(), indexQueueKey, fi.Identity+" "+strings.ToLower(ext)).Err()
+	if err != nil {
+		tool.Logger.Errorf("enqueue index %s error: %v", fi.Identity, err)
+	}
+}
+
+// StartIndexer 后台消费索引队列
+func StartIndexer(ctx context.Context) {
+	if !fullTextEnabled() {
+		return
+	}
+	go func() {
+		client := server.GetRedisClient()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			val, err := client.BRPop(ctx, 5*time.Second, indexQueueKey).Result()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				tool.Logger.Errorf("pop index queue error: %v", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			fields := strings.Fields(val[1])
+			if len(fields) != 2 {
+				continue
+			}
+			if err := indexFile(ctx, fields[0], fields[1]); err != nil {
+				tool.Logger.Errorf("index file %s error: %v", fields[0], err)
+			}
+		}
+	}()
+}
+
+// indexFile 提取 FileInfo 的文本并建立索引
+func indexFile(ctx context.Context, fileIdentity, ext string) error {
+	client := server.GetRedisClient()
+	lockKey := indexLockPrefix + fileIdentity
+	ok, err := client.SetNX(ctx, lockKey, 1, 10*time.Minute).Result()
+	if err != nil || !ok {
+		return err
+	}
+	defer client.Del(context.Background(), lockKey)
+
+	engine := server.GetEngine()
+	has, err := engine.Where("file_identity = ?", fileIdentity).Exist(new(models.FileText))
+	if err != nil || has {
+		return err
+	}
+	fi := new(models.FileInfo)
+	has, err = engine.Where("identity = ?", fileIdentity).Get(fi)
+	if err != nil || !has {
+		return err
+	}
+
+	text, err := extractText(ctx, fi, ext)
+	if err != nil {
+		return err
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	if _, err := session.Insert(&models.FileText{FileIdentity: fi.Identity, Content: text}); err != nil {
+		return err
+	}
+	batch := make([]models.FileTerm, 0, indexInsertBatch)
+	for term, freq := range fulltext.IndexTerms(text) {
+		batch = append(batch, models.FileTerm{Term: term, FileIdentity: fi.Identity, Freq: freq})
+		if len(batch) == indexInsertBatch {
+			if _, err := session.Insert(&batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if _, err := session.Insert(&batch); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+func extractText(ctx context.Context, fi *models.FileInfo, ext string) (string, error) {
+	limit := maxIndexText()
+	if fulltext.IsPlain(ext) {
+		r, err := OpenBlob(ctx, fi, "", 0, int64(limit))
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		return fulltext.ExtractPlain(r, limit)
+	}
+	f, err := TempBlob(ctx, fi, "")
+	if err != nil {
+		return "", err
+	}
+	defer RemoveTemp(f)
+	return fulltext.ExtractOOXML(f, fi.Size, ext, limit)
+}
+
+// removeFileIndex 删除 FileInfo 的索引
+func removeFileIndex(session *xorm.Session, fileIdentity string) error {
+	if _, err := session.Where("file_identity = ?", fileIdentity).Delete(new(models.FileTerm)); err != nil {
+		return err
+	}
+	_, err := session.Where("file_identity = ?", fileIdentity).Delete(new(models.FileText))
+	return err
+}
+
+// FullTextHit 全文检索的结果, Snippet 中命中的部分用 <em></em> 包围
+type FullTextHit struct {
+	UserFileItem
+	Snippet string
+}
+
+type fullTextRow struct {
+	models.UserFile `xorm:"extends"`
+	Size            int64
+	Score           int64
+}
+
+// SearchFullText 搜索内容包含 query 中所有词的文件, 按词频排序
+func SearchFullText(userIdentity, query string, page, pageSize int) ([]FullTextHit, int64, error) {
+	terms := fulltext.QueryTerms(query)
+	if len(terms) == 0 {
+		return []FullTextHit{}, 0, nil
+	}
+	if len(terms) > MaxQueryTerms {
+		terms = terms[:MaxQueryTerms]
+	}
+	engine := server.GetEngine()
+	match := func(session *xorm.Session) *xorm.Session {
+		return session.Join("INNER", "file_term", "file_term.file_identity = user_file.repository_identity").
+			Where("user_file.user_identity = ?", userIdentity).
+			In("file_term.term", terms).
+			GroupBy("user_file.id").
+			Having(fmt.Sprintf("COUNT(DISTINCT file_term.term) = %d", len(terms)))
+	}
+
+	// 非结构体的查询不会自动加软删除条件, 回收站中的文件要显式排除, 条件和 xorm 自动加的一致
+	args := []interface{}{userIdentity}
+	for _, term := range terms {
+		args = append(args, term)
+	}
+	var count int64
+	_, err := engine.SQL(fmt.Sprintf("SELECT COUNT(*) FROM (SELECT user_file.id FROM user_file "+
+		"INNER JOIN file_term ON file_term.file_identity = user_file.repository_identity "+
+		"WHERE user_file.user_identity = ? AND (user_file.deleted_at IS NULL OR user_file.deleted_at = '0001-01-01 00:00:00') "+
+		"AND file_term.term IN (%s) "+
+		"GROUP BY user_file.id HAVING COUNT(DISTINCT file_term.term) = %d) matched",
+		strings.TrimSuffix(strings.Repeat("?,", len(terms)), ","), len(terms)), args...).Get(&count)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows := make([]fullTextRow, 0, pageSize)
+	err = match(engine.Table("user_file").
+		Select("user_file.*, MAX(file_info.size) AS size, SUM(file_term.freq) AS score").
+		Join("INNER", "file_info", "file_info.identity = user_file.repository_identity")).
+		OrderBy("score DESC, user_file.id").
+		Limit(pageSize, (page-1)*pageSize).
+		Find(&rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	files := make([]string, 0, len(rows))
+	for _, row := range rows {
+		files = append(files, row.RepositoryIdentity)
+	}
+	var texts []models.FileText
+	if len(files) > 0 {
+		if err := engine.In("file_identity", files).Find(&texts); err != nil {
+			return nil, 0, err
+		}
+	}
+	contents := make(map[string]string, len(texts))
+	for _, t := range texts {
+		contents[t.FileIdentity] = t.Content
+	}
+
+	hits := make([]FullTextHit, 0, len(rows))
+	for _, row := range rows {
+		hits = append(hits, FullTextHit{
+			UserFileItem: UserFileItem{UserFile: row.UserFile, Size: row.Size},
+			Snippet:      fulltext.Snippet(contents[row.RepositoryIdentity], terms),
+		})
+	}
+	return hits, count, nil
+}
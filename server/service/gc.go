@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+const (
+	gcLockKey   = "gc:lock"
+	gcReportKey = "gc:report"
+	gcBatchSize = 500
+)
+
+// GCReport 一次回收的结果
+type GCReport struct {
+	DryRun         bool      `json:"dryRun"`
+	ScannedBlobs   int       `json:"scannedBlobs"`
+	DeletedBlobs   int       `json:"deletedBlobs"`
+	ReclaimedBytes int64     `json:"reclaimedBytes"`
+	RepairedBlobs  int       `json:"repairedBlobs"` // 引用计数和实际引用不一致, 已按实际引用修正
+	AbortedUploads int       `json:"abortedUploads"`
+	Errors         int       `json:"errors"`
+	StartedAt      time.Time `json:"startedAt"`
+	FinishedAt     time.Time `json:"finishedAt"`
+}
+
+func gcGracePeriod() time.Duration {
+	if grace := server.GetConfig().GC.GracePeriod; grace > 0 {
+		return time.Duration(grace) * time.Second
+	}
+	return 24 * time.Hour
+}
+
+// RunGC 回收引用数为 0 且超过宽限期的 FileInfo 及其存储对象, 并取消过期的分片上传.
+// dryRun 时只统计, 不做任何修改. 多个节点同时运行时只有一个会执行
+func RunGC(ctx context.Context, dryRun bool) (*GCReport, error) {
+	unlock, ok, err := tryLock(ctx, gcLockKey, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrGCRunning
+	}
+	defer unlock()
+
+	report := &GCReport{DryRun: dryRun, StartedAt: time.Now()}
+	if err := collectBlobs(ctx, report); err != nil {
+		return nil, err
+	}
+	if err := abortStaleUploads(ctx, report); err != nil {
+		return nil, err
+	}
+	report.FinishedAt = time.Now()
+
+	data, _ := json.Marshal(report)
+	if err := server.GetRedisClient().Set(ctx, gcReportKey, data, 0).Err(); err != nil {
+		tool.Logger.Errorf("save gc report error: %v", err)
+	}
+	return report, nil
+}
+
+func collectBlobs(ctx context.Context, report *GCReport) error {
+	engine := server.GetEngine()
+	cutoff := time.Now().Add(-gcGracePeriod())
+	lastId := 0
+	for {
+		var blobs []models.FileInfo
+		err := engine.Where("id > ? AND ref_count <= 0 AND released_at < ?", lastId, cutoff).
+			Asc("id").Limit(gcBatchSize).Find(&blobs)
+		if err != nil {
+			return err
+		}
+		for i := range blobs {
+			collectBlob(ctx, &blobs[i], report)
+		}
+		if len(blobs) < gcBatchSize {
+			return nil
+		}
+		lastId = blobs[len(blobs)-1].Id
+	}
+}
+
+func collectBlob(ctx context.Context, fi *models.FileInfo, report *GCReport) {
+	report.ScannedBlobs++
+	engine := server.GetEngine()
+	session := engine.NewSession()
+	defer session.Close()
+
+	// 引用计数可能不准 (例如加字段之前的历史数据), 删除前按实际引用再确认一次
+	refs, err := countBlobReferences(session, fi.Identity)
+	if err != nil {
+		tool.Logger.Errorf("count references of %s error: %v", fi.Identity, err)
+		report.Errors++
+		return
+	}
+	if refs > 0 {
+		report.RepairedBlobs++
+		if !report.DryRun {
+			_, err = engine.ID(fi.Id).Cols("ref_count").Update(&models.FileInfo{RefCount: int(refs)})
+			if err != nil {
+				tool.Logger.Errorf("repair ref count of %s error: %v", fi.Identity, err)
+				report.Errors++
+			}
+		}
+		return
+	}
+
+	if report.DryRun {
+		report.DeletedBlobs++
+		report.ReclaimedBytes += fi.Size
+		return
+	}
+
+	// 带上 ref_count 条件, 期间被重新引用的文件不会被删除
+	affected, err := engine.Where("id = ? AND ref_count <= 0", fi.Id).Delete(new(models.FileInfo))
+	if err != nil {
+		tool.Logger.Errorf("delete file info %s error: %v", fi.Identity, err)
+		report.Errors++
+		return
+	}
+	if affected == 0 {
+		return
+	}
+	if _, err := engine.Where("file_identity = ?", fi.Identity).Delete(new(models.FileKey)); err != nil {
+		tool.Logger.Errorf("delete file keys of %s error: %v", fi.Identity, err)
+		report.Errors++
+	}
+	if err := removeFileIndex(session, fi.Identity); err != nil {
+		tool.Logger.Errorf("delete full text index of %s error: %v", fi.Identity, err)
+		report.Errors++
+	}
+	if err := server.GetStorage().Delete(ctx, objectKey(fi)); err != nil {
+		tool.Logger.Errorf("delete object %s error: %v", objectKey(fi), err)
+		report.Errors++
+		return
+	}
+	report.DeletedBlobs++
+	report.ReclaimedBytes += fi.Size
+}
+
+// abortStaleUploads 会话已经过期的分片上传不会再被完成, 取消它们释放已上传的分片
+func abortStaleUploads(ctx context.Context, report *GCReport) error {
+	uploads, err := server.GetStorage().ListMultipart(ctx, "")
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-sessionExpire() - time.Hour)
+	for _, u := range uploads {
+		if u.Initiated.IsZero() || u.Initiated.After(cutoff) {
+			continue
+		}
+		if !report.DryRun {
+			if err := server.GetStorage().AbortMultipart(ctx, u.Key, u.UploadID); err != nil {
+				tool.Logger.Errorf("abort upload %s of %s error: %v", u.UploadID, u.Key, err)
+				report.Errors++
+				continue
+			}
+		}
+		report.AbortedUploads++
+	}
+	return nil
+}
+
+// LastGCReport 最近一次回收的结果, 还没有运行过时返回 ErrNotFound
+func LastGCReport(ctx context.Context) (*GCReport, error) {
+	val, err := server.GetRedisClient().Get(ctx, gcReportKey).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var report GCReport
+	if err := json.Unmarshal([]byte(val), &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// StartGC 按配置的间隔在后台运行回收, 间隔为 0 时不启动
+func StartGC(ctx context.Context) {
+	config := server.GetConfig().GC
+	if config.Interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			report, err := RunGC(ctx, config.DryRun)
+			if err != nil {
+				tool.Logger.Errorf("gc error: %v", err)
+				continue
+			}
+			tool.Logger.Infof("gc finished, dry run: %v, deleted blobs: %d, reclaimed bytes: %d, aborted uploads: %d",
+				report.DryRun, report.DeletedBlobs, report.ReclaimedBytes, report.AbortedUploads)
+		}
+	}()
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+// 秒传校验时读取的区间长度
+const challengeLength = 64 << 10
+
+// Challenge 秒传时要求客户端回答的区间 hash 校验
+type Challenge struct {
+	Token        string
+	Offset       int64
+	Length       int64
+	UserIdentity string
+	FileIdentity string
+	Owner        string // 上传到别人分享的目录时为目录的所有者
+	ParentId     int
+	Name         string
+	Overwrite    string // 覆盖的 UserFile
+	Conflict     string
+}
+
+// consumeChallengeScript 值未变时删除 challenge, 返回删除的个数
+var consumeChallengeScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func challengeKey(token string) string {
+	return "upload:challenge:" + token
+}
+
+// InstantUpload 秒传: 内容 (hash + size) 已存在时直接创建 UserFile, 不传输任何数据.
+// 未命中时两个返回值都为 nil; 开启 prove_ownership 时命中后返回 Challenge, 需要客户端调用 ProveInstantUpload
+func InstantUpload(userIdentity string, target FileTarget, hash string, size int64) (*models.UserFile, *Challenge, error) {
+	fi, err := GetFileInfoByHash(strings.ToLower(hash), size)
+	if err != nil || fi == nil {
+		return nil, nil, err
+	}
+	if err := CheckUploadQuota(userIdentity, target, fi.Size); err != nil {
+		return nil, nil, err
+	}
+
+	if server.GetConfig().Upload.ProveOwnership && fi.Size > 0 {
+		challenge := &Challenge{
+			Token:        tool.GenerateUUID(),
+			Length:       challengeLength,
+			UserIdentity: userIdentity,
+			FileIdentity: fi.Identity,
+			Owner:        target.Owner,
+			ParentId:     target.ParentId,
+			Name:         target.Name,
+			Overwrite:    target.Identity,
+			Conflict:     target.Conflict,
+		}
+		if fi.Size <= challenge.Length {
+			challenge.Length = fi.Size
+		} else {
+			r := rand.New(rand.NewSource(time.Now().UnixNano()))
+			challenge.Offset = r.Int63n(fi.Size - challenge.Length + 1)
+		}
+		data, _ := json.Marshal(challenge)
+		err = server.GetRedisClient().Set(context.Background(), challengeKey(challenge.Token), data,
+			time.Duration(server.ChallengeExpire)*time.Second).Err()
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, challenge, nil
+	}
+
+	uf, err := createInstantFile(userIdentity, target, fi)
+	return uf, nil, err
+}
+
+// ProveInstantUpload 校验客户端对 Challenge 区间计算的 md5, 通过后创建 UserFile
+func ProveInstantUpload(ctx context.Context, userIdentity, token, proof string) (*models.UserFile, error) {
+	client := server.GetRedisClient()
+	key := challengeKey(token)
+	val, err := client.Get(ctx, key).Result()
+	if err != nil {
+		return nil, ErrChallengeFailed
+	}
+	var challenge Challenge
+	if err := json.Unmarshal([]byte(val), &challenge); err != nil {
+		return nil, err
+	}
+	// 先确认是自己的 challenge 再删除, 其他用户拿到 token 也不能作废它
+	if challenge.UserIdentity != userIdentity {
+		return nil, ErrChallengeFailed
+	}
+	// 每个 challenge 只能回答一次, 并发回答时只有删除成功的一方继续
+	deleted, err := consumeChallengeScript.Run(ctx, client, []string{key}, val).Int()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrChallengeFailed
+	}
+
+	fi, err := GetFileInfo(challenge.FileIdentity)
+	if err != nil {
+		return nil, err
+	}
+	// 用户还没有引用该文件, 用已有持有者的密钥读取
+	r, err := OpenBlob(ctx, fi, "", challenge.Offset, challenge.Length)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), proof) {
+		return nil, ErrChallengeFailed
+	}
+
+	target := FileTarget{Owner: challenge.Owner, ParentId: challenge.ParentId, Name: challenge.Name, Identity: challenge.Overwrite, Conflict: challenge.Conflict}
+	return createInstantFile(userIdentity, target, fi)
+}
+
+// createInstantFile 在一个事务中增加引用、保存密钥并创建文件记录, 任一步失败都不会留下多余的引用
+func createInstantFile(userIdentity string, target FileTarget, fi *models.FileInfo) (*models.UserFile, error) {
+	unlock, err := LockQuota(context.Background(), target.owner(userIdentity))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+	uf, err := saveUserFile(session, userIdentity, target, fi)
+	if err != nil {
+		return nil, err
+	}
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	if uf.RepositoryIdentity == fi.Identity {
+		enqueueIndex(fi, uf.Ext)
+	}
+	return uf, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"net_disk/server"
+	"net_disk/tool"
+)
+
+// 后台任务状态
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// 任务结束后保留进度的时间
+const jobExpire = 24 * time.Hour
+
+// Job 后台任务, 进度保存在 redis 中
+type Job struct {
+	Identity     string
+	UserIdentity string
+	Type         string
+	Status       string
+	Total        int64
+	Done         int64
+	Error        string
+	Result       []string // 任务创建的顶层文件 identity
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func jobKey(identity string) string {
+	return "job:" + identity
+}
+
+func saveJob(job *Job) {
+	job.UpdatedAt = time.Now()
+	data, _ := json.Marshal(job)
+	if err := server.GetRedisClient().Set(context.Background(), jobKey(job.Identity), data, jobExpire).Err(); err != nil {
+		tool.Logger.Errorf("save job %s error: %v", job.Identity, err)
+	}
+}
+
+// StartJob 创建任务并在后台运行 fn, fn 通过 Progress 汇报进度
+func StartJob(userIdentity, jobType string, total int64, fn func(job *Job) error) *Job {
+	job := &Job{
+		Identity:     tool.GenerateUUID(),
+		UserIdentity: userIdentity,
+		Type:         jobType,
+		Status:       JobRunning,
+		Total:        total,
+		CreatedAt:    time.Now(),
+	}
+	saveJob(job)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				tool.Logger.Errorf("job %s panic: %v", job.Identity, r)
+				job.Status, job.Error = JobFailed, "internal error"
+				saveJob(job)
+			}
+		}()
+		if err := fn(job); err != nil {
+			tool.Logger.Errorf("job %s error: %v", job.Identity, err)
+			job.Status, job.Error = JobFailed, err.Error()
+		} else {
+			job.Status = JobSucceeded
+		}
+		saveJob(job)
+	}()
+	return job
+}
+
+// Progress 完成 n 项, 每秒最多写一次 redis
+func (job *Job) Progress(n int64) {
+	job.Done += n
+	if time.Since(job.UpdatedAt) >= time.Second {
+		saveJob(job)
+	}
+}
+
+// GetJob 当前用户的任务, 不存在或已过期时返回 ErrNotFound
+func GetJob(ctx context.Context, userIdentity, identity string) (*Job, error) {
+	val, err := server.GetRedisClient().Get(ctx, jobKey(identity)).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal([]byte(val), &job); err != nil {
+		return nil, err
+	}
+	if job.UserIdentity != userIdentity {
+		return nil, ErrNotFound
+	}
+	return &job, nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"net_disk/server"
+	"net_disk/tool"
+)
+
+// unlockScript 锁的值仍是自己的 token 时才删除. 锁过期后被别的节点重新获取时, 原持有者不会删掉别人的锁
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// tryLock 获取 key 上的锁, 已被占用时 ok 为 false. 返回的 unlock 只释放自己持有的锁
+func tryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(), ok bool, err error) {
+	client := server.GetRedisClient()
+	token := tool.GenerateUUID()
+	ok, err = client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func() {
+		if err := unlockScript.Run(context.Background(), client, []string{key}, token).Err(); err != nil {
+			tool.Logger.Errorf("unlock %s error: %v", key, err)
+		}
+	}, true, nil
+}
+
+// waitLock 每隔 interval 尝试获取 key 上的锁, 直到获取成功或者 ctx 结束
+func waitLock(ctx context.Context, key string, ttl, interval time.Duration) (unlock func(), err error) {
+	for {
+		unlock, ok, err := tryLock(ctx, key, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return unlock, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
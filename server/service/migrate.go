@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+// 表结构迁移:
+//   - 启动时按 models 中的定义同步表、字段和索引. 字段只增加, 已有字段的类型不会修改; models 中没有定义的索引会被删除
+//   - 一次性的数据迁移按名字记录在 SchemaMigration 中, 每个只执行一次
+//   - 新增的唯一索引要求已有数据不重复, 对应的数据迁移在同步索引之前执行
+//   - 多个节点同时启动时只有一个执行迁移, 其余的等待它完成
+
+const (
+	migrateLockKey = "migrate:lock"
+	migrateLockTTL = 10 * time.Minute
+)
+
+// syncedModels 启动时同步的表, user_info 由账号服务维护, 不在这里同步
+var syncedModels = []interface{}{
+	new(models.UserFile),
+	new(models.FileInfo),
+	new(models.FileKey),
+	new(models.UserKey),
+	new(models.FileVersion),
+	new(models.RecycleItem),
+	new(models.FileText),
+	new(models.FileTerm),
+	new(models.Tag),
+	new(models.UserFileTag),
+	new(models.FileShare),
+	new(models.ShareDailyStat),
+	new(models.DirectShare),
+	new(models.FileRequest),
+	new(models.FileRequestUpload),
+}
+
+type migration struct {
+	name string
+	run  func(session *xorm.Session) error
+}
+
+// beforeSync 在同步索引之前执行, 整理会违反新唯一索引的数据
+var beforeSync = []migration{
+	{"dedupe_user_key", dedupeUserKeys},
+	{"dedupe_file_key", dedupeFileKeys},
+	{"unique_user_file_name", uniqueUserFileNames},
+}
+
+// afterSync 在同步表结构之后执行
+var afterSync = []migration{
+	{"backfill_ref_count", backfillRefCount},
+}
+
+// userFileColumns 整理 user_file 重名数据时需要的字段, 先于唯一索引同步.
+// Sync2 会删除结构体中没有定义的索引, 所以只在数据迁移中同步一次, 随后由完整的同步重新建立
+type userFileColumns struct {
+	Id              int `xorm:"pk autoincr"`
+	RecycleIdentity string
+}
+
+func (r *userFileColumns) TableName() string {
+	return "user_file"
+}
+
+// Migrate 同步表结构并执行还没有执行过的数据迁移
+func Migrate(ctx context.Context) error {
+	unlock, err := waitLock(ctx, migrateLockKey, migrateLockTTL, time.Second)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	engine := server.GetEngine()
+	if err := engine.Sync2(new(models.SchemaMigration)); err != nil {
+		return err
+	}
+	if err := runMigrations(beforeSync); err != nil {
+		return err
+	}
+	if err := engine.Sync2(syncedModels...); err != nil {
+		return err
+	}
+	return runMigrations(afterSync)
+}
+
+// runMigrations 每个数据迁移和它的执行记录在同一个事务中提交
+func runMigrations(migrations []migration) error {
+	engine := server.GetEngine()
+	for _, m := range migrations {
+		has, err := engine.Where("name = ?", m.name).Exist(new(models.SchemaMigration))
+		if err != nil {
+			return err
+		}
+		if has {
+			continue
+		}
+		tool.Logger.Infof("run migration %s", m.name)
+		session := engine.NewSession()
+		err = runMigration(session, m)
+		session.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runMigration(session *xorm.Session, m migration) error {
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	if err := m.run(session); err != nil {
+		return err
+	}
+	if _, err := session.Insert(&models.SchemaMigration{Name: m.name}); err != nil {
+		return err
+	}
+	return session.Commit()
+}
+
+// dedupeUserKeys 并发创建用户密钥时可能插入多条, 已有数据一直使用最早的一条, 删除其余的
+func dedupeUserKeys(session *xorm.Session) error {
+	exist, err := session.IsTableExist(new(models.UserKey))
+	if err != nil || !exist {
+		return err
+	}
+	_, err = session.Exec("DELETE k FROM user_key k JOIN user_key e ON k.user_identity = e.user_identity AND k.id > e.id")
+	return err
+}
+
+// dedupeFileKeys 同一用户的多份数据密钥内容相同, 只保留最早的一条
+func dedupeFileKeys(session *xorm.Session) error {
+	exist, err := session.IsTableExist(new(models.FileKey))
+	if err != nil || !exist {
+		return err
+	}
+	_, err = session.Exec("DELETE k FROM file_key k JOIN file_key e " +
+		"ON k.file_identity = e.file_identity AND k.user_identity = e.user_identity AND k.id > e.id")
+	return err
+}
+
+// duplicateName 同一目录下重名的一组记录, Keep 为保留原名的最早一条
+type duplicateName struct {
+	UserIdentity    string
+	ParentId        int
+	Name            string
+	RecycleIdentity string
+	Keep            int
+}
+
+// uniqueUserFileNames 为建立 user_file_name 唯一索引整理数据:
+// 加回收站之前删除的记录没有 RecycleIdentity, 用自己的 identity 填充; 重名的记录除最早的一条外自动改名
+func uniqueUserFileNames(session *xorm.Session) error {
+	if err := server.GetEngine().Sync2(new(userFileColumns)); err != nil {
+		return err
+	}
+	_, err := session.Exec("UPDATE user_file SET recycle_identity = identity WHERE recycle_identity = '' " +
+		"AND deleted_at IS NOT NULL AND deleted_at <> '0001-01-01 00:00:00'")
+	if err != nil {
+		return err
+	}
+	var groups []duplicateName
+	err = session.SQL("SELECT user_identity, parent_id, name, recycle_identity, MIN(id) AS keep FROM user_file " +
+		"GROUP BY user_identity, parent_id, name, recycle_identity HAVING COUNT(*) > 1").Find(&groups)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		var files []models.UserFile
+		err := session.Unscoped().Where("user_identity = ? AND parent_id = ? AND name = ? AND recycle_identity = ? AND id <> ?",
+			g.UserIdentity, g.ParentId, g.Name, g.RecycleIdentity, g.Keep).Find(&files)
+		if err != nil {
+			return err
+		}
+		for i := range files {
+			uf := &files[i]
+			// 回收站中的记录不和目录中现有的文件比较, 用 id 编号保证不重复
+			name := numberedName(uf.Name, uf.Id, IsFolder(uf))
+			if uf.RecycleIdentity == "" {
+				if name, err = uniqueName(session, uf.UserIdentity, uf.ParentId, uf.Name, IsFolder(uf)); err != nil {
+					return err
+				}
+			}
+			if _, err := session.Exec("UPDATE user_file SET name = ? WHERE id = ?", name, uf.Id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backfillRefCount 按实际引用 (包括回收站中的文件和历史版本, 同 countBlobReferences) 重新计算引用计数.
+// 没有引用的记录从现在开始计算宽限期, 之后由 GC 回收
+func backfillRefCount(session *xorm.Session) error {
+	_, err := session.Exec("UPDATE file_info SET ref_count = " +
+		"(SELECT COUNT(*) FROM user_file WHERE user_file.repository_identity = file_info.identity) + " +
+		"(SELECT COUNT(*) FROM file_version WHERE file_version.repository_identity = file_info.identity)")
+	if err != nil {
+		return err
+	}
+	_, err = session.Exec("UPDATE file_info SET released_at = ? WHERE ref_count = 0 "+
+		"AND (released_at IS NULL OR released_at < '1970-01-02')", time.Now())
+	return err
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/models"
+)
+
+// CopySyncLimit 复制的文件和目录总数超过该值时转为后台任务
+const CopySyncLimit = 200
+
+// JobTypeCopy 复制任务
+const JobTypeCopy = "copy"
+
+// isDescendant folderId 是否是 ancestorId 本身或者它的子目录
+func isDescendant(session *xorm.Session, userIdentity string, folderId, ancestorId int) (bool, error) {
+	for depth := 0; folderId != 0; depth++ {
+		if folderId == ancestorId {
+			return true, nil
+		}
+		if depth > maxFolderDepth {
+			return false, ErrNotFound
+		}
+		parent := new(models.UserFile)
+		has, err := session.Where("id = ? AND user_identity = ?", folderId, userIdentity).Get(parent)
+		if err != nil {
+			return false, err
+		}
+		if !has {
+			return false, ErrNotFound
+		}
+		folderId = parent.ParentId
+	}
+	return false, nil
+}
+
+// checkTarget 目录不能移动或复制到它自己或它的子目录中
+func checkTarget(session *xorm.Session, uf *models.UserFile, targetId int) error {
+	if !IsFolder(uf) {
+		return nil
+	}
+	cycle, err := isDescendant(session, uf.UserIdentity, targetId, uf.Id)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrCycle
+	}
+	return nil
+}
+
+// MoveUserFiles 把文件和目录移动到 targetId 目录, 同名时按 policy 处理, 全部成功或全部失败
+func MoveUserFiles(userIdentity string, identities []string, targetId int, policy string) error {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		uf, err := getUserFile(session, userIdentity, identity)
+		if err != nil {
+			return err
+		}
+		if uf.ParentId == targetId {
+			continue
+		}
+		if err := checkTarget(session, uf, targetId); err != nil {
+			return err
+		}
+		if err := moveUserFile(session, userIdentity, uf, targetId, policy); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+func moveUserFile(session *xorm.Session, userIdentity string, uf *models.UserFile, targetId int, policy string) error {
+	name, exist, err := resolveConflict(session, userIdentity, targetId, uf.Name, IsFolder(uf), policy)
+	if err != nil {
+		return err
+	}
+	if exist != nil {
+		// 移动到自己所在的目录时同名的就是 uf 本身, 不需要移动
+		if policy == ConflictSkip || exist.Id == uf.Id {
+			return nil
+		}
+		return mergeInto(session, userIdentity, uf, exist)
+	}
+	uf.ParentId, uf.Name, uf.UpdatedAt = targetId, name, time.Now()
+	if !IsFolder(uf) {
+		uf.Ext = path.Ext(name)
+	}
+	_, err = session.ID(uf.Id).Cols("parent_id", "name", "ext", "updated_at").Update(uf)
+	return nameError(err)
+}
+
+// CopyUserFiles 把文件和目录复制到 targetId 目录, 同名时按 policy 处理, 文件复用原来的 FileInfo, 不复制存储对象.
+// 总数不超过 CopySyncLimit 时在一个事务中完成并返回新文件的 identity, 否则返回后台任务
+func CopyUserFiles(userIdentity string, identities []string, targetId int, policy string) ([]string, *Job, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+
+	sources := make([]*models.UserFile, 0, len(identities))
+	names := make(map[string]bool, len(identities))
+	var total, size int64
+	for _, identity := range identities {
+		uf, err := getUserFile(session, userIdentity, identity)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := checkTarget(session, uf, targetId); err != nil {
+			return nil, nil, err
+		}
+		// 默认的 fail 在开始复制前检查, 避免后台任务复制到一半失败
+		if policy == "" || policy == ConflictFail {
+			if names[uf.Name] {
+				return nil, nil, ErrNameExists
+			}
+			names[uf.Name] = true
+			if err := checkName(session, userIdentity, targetId, uf.Name, 0); err != nil {
+				return nil, nil, err
+			}
+		}
+		n, bytes, err := treeSize(session, uf)
+		if err != nil {
+			return nil, nil, err
+		}
+		total += n
+		size += bytes
+		sources = append(sources, uf)
+	}
+	// 复制不复制存储对象, 但每个引用都占用空间. 同步复制时锁持有到事务提交; 后台任务只在开始前检查
+	unlock, err := LockQuota(context.Background(), userIdentity)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	if err := checkQuota(userIdentity, size); err != nil {
+		return nil, nil, err
+	}
+	return copyUserFiles(userIdentity, sources, targetId, policy, total)
+}
+
+// copyUserFiles 把 sources 复制到 userIdentity 的 targetId 目录, sources 可以属于其他用户. total 为包括子目录在内的总数
+func copyUserFiles(userIdentity string, sources []*models.UserFile, targetId int, policy string, total int64) ([]string, *Job, error) {
+	if total > CopySyncLimit {
+		job := StartJob(userIdentity, JobTypeCopy, total, func(job *Job) error {
+			// 后台复制不使用事务, 失败时已经复制的部分保留
+			session := server.GetEngine().NewSession()
+			defer session.Close()
+			for _, src := range sources {
+				uf, err := copyTree(session, userIdentity, src, targetId, policy, job.Progress)
+				if err != nil {
+					return err
+				}
+				if uf != nil {
+					job.Result = append(job.Result, uf.Identity)
+				}
+			}
+			return nil
+		})
+		return nil, job, nil
+	}
+
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, nil, err
+	}
+	result := make([]string, 0, len(sources))
+	for _, src := range sources {
+		uf, err := copyTree(session, userIdentity, src, targetId, policy, func(int64) {})
+		if err != nil {
+			return nil, nil, err
+		}
+		if uf != nil {
+			result = append(result, uf.Identity)
+		}
+	}
+	if err := session.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return result, nil, nil
+}
+
+// listChildren 目录下的文件和目录
+func listChildren(session *xorm.Session, folder *models.UserFile) ([]models.UserFile, error) {
+	var children []models.UserFile
+	err := session.Where("user_identity = ? AND parent_id = ?", folder.UserIdentity, folder.Id).Asc("id").Find(&children)
+	return children, err
+}
+
+// countTree uf 及其子目录中的文件和目录总数
+func countTree(session *xorm.Session, uf *models.UserFile) (int64, error) {
+	total := int64(1)
+	folders := []int{uf.Id}
+	if !IsFolder(uf) {
+		folders = nil
+	}
+	for len(folders) > 0 {
+		var children []models.UserFile
+		err := session.Where("user_identity = ?", uf.UserIdentity).In("parent_id", folders).
+			Cols("id", "repository_identity").Find(&children)
+		if err != nil {
+			return 0, err
+		}
+		total += int64(len(children))
+		folders = folders[:0]
+		for _, child := range children {
+			if IsFolder(&child) {
+				folders = append(folders, child.Id)
+			}
+		}
+	}
+	return total, nil
+}
+
+// copyTree 把 src 复制到 userIdentity 的 targetId 目录下, 每复制一项调用一次 progress. 跳过时返回 nil;
+// 覆盖时文件覆盖同名文件, 目录合并到同名目录中
+func copyTree(session *xorm.Session, userIdentity string, src *models.UserFile, targetId int, policy string, progress func(int64)) (*models.UserFile, error) {
+	name, exist, err := resolveConflict(session, userIdentity, targetId, src.Name, IsFolder(src), policy)
+	if err != nil {
+		return nil, err
+	}
+	if exist != nil && exist.Id == src.Id {
+		// 复制到自己所在的目录, 同名的就是 src 本身, 不能覆盖或合并到自己, 按 rename 处理
+		if name, err = uniqueName(session, userIdentity, targetId, src.Name, IsFolder(src)); err != nil {
+			return nil, err
+		}
+		exist = nil
+	}
+	if exist != nil && policy == ConflictSkip {
+		n, err := countTree(session, src)
+		progress(n)
+		return nil, err
+	}
+
+	if !IsFolder(src) {
+		fi := new(models.FileInfo)
+		has, err := session.Where("identity = ?", src.RepositoryIdentity).Get(fi)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			return nil, ErrNotFound
+		}
+		var uf *models.UserFile
+		if exist != nil {
+			uf, err = overwriteUserFile(session, userIdentity, exist, fi)
+		} else {
+			uf, err = CreateUserFile(session, userIdentity, targetId, name, fi)
+		}
+		if err != nil {
+			return nil, err
+		}
+		progress(1)
+		return uf, nil
+	}
+
+	folder := exist
+	if folder == nil {
+		if folder, err = insertFolder(session, userIdentity, targetId, name); err != nil {
+			return nil, err
+		}
+	}
+	progress(1)
+	children, err := listChildren(session, src)
+	if err != nil {
+		return nil, err
+	}
+	for i := range children {
+		if _, err := copyTree(session, userIdentity, &children[i], folder.Id, policy, progress); err != nil {
+			return nil, err
+		}
+	}
+	return folder, nil
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"testing"
+
+	"net_disk/server/models"
+)
+
+func TestIsDescendant(t *testing.T) {
+	session := newTestSession(t, new(models.UserFile))
+	a := insertTestFile(t, session, "u1", 0, "a", "")
+	b := insertTestFile(t, session, "u1", a.Id, "b", "")
+	c := insertTestFile(t, session, "u1", b.Id, "c", "")
+	other := insertTestFile(t, session, "u2", 0, "other", "")
+
+	tests := []struct {
+		name                 string
+		folderId, ancestorId int
+		want                 bool
+		err                  error
+	}{
+		{"self", a.Id, a.Id, true, nil},
+		{"child", b.Id, a.Id, true, nil},
+		{"grandchild", c.Id, a.Id, true, nil},
+		{"parent", a.Id, c.Id, false, nil},
+		{"root", 0, a.Id, false, nil},
+		{"sibling tree", a.Id, other.Id, false, nil},
+		{"other user's folder", other.Id, a.Id, false, ErrNotFound},
+		{"missing folder", 1000, a.Id, false, ErrNotFound},
+	}
+	for _, tt := range tests {
+		got, err := isDescendant(session, "u1", tt.folderId, tt.ancestorId)
+		if got != tt.want || err != tt.err {
+			t.Errorf("%s: isDescendant(%d, %d) = %v, %v, want %v, %v", tt.name, tt.folderId, tt.ancestorId, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+const (
+	recyclePurgeLockKey = "recycle:purge:lock"
+	recyclePurgeBatch   = 100
+)
+
+// RecycleRetention 回收站保留时间, 超过后自动彻底删除
+func RecycleRetention() time.Duration {
+	if days := server.GetConfig().Recycle.Retention; days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return 30 * 24 * time.Hour
+}
+
+// DeleteUserFiles 把文件和目录连同子目录移入回收站, 全部成功或全部失败
+func DeleteUserFiles(userIdentity string, identities []string) error {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	files := make([]*models.UserFile, 0, len(identities))
+	for _, identity := range identities {
+		uf, err := getUserFile(session, userIdentity, identity)
+		if err != nil {
+			return err
+		}
+		files = append(files, uf)
+	}
+	for _, uf := range files {
+		// 同一批中已经随父目录删除的跳过
+		alive, err := session.Where("id = ?", uf.Id).Exist(new(models.UserFile))
+		if err != nil {
+			return err
+		}
+		if !alive {
+			continue
+		}
+		if _, err := recycleUserFile(session, uf); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+func recycleUserFile(session *xorm.Session, uf *models.UserFile) (*models.RecycleItem, error) {
+	subtree, err := listSubtree(session, uf)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(subtree)+1)
+	ids = append(ids, uf.Id)
+	var size int64
+	for _, item := range subtree {
+		ids = append(ids, item.Id)
+		size += item.Size
+	}
+	if !IsFolder(uf) {
+		fi := new(models.FileInfo)
+		if _, err := session.Where("identity = ?", uf.RepositoryIdentity).Get(fi); err != nil {
+			return nil, err
+		}
+		size = fi.Size
+	}
+
+	var parentPath []string
+	if uf.ParentId != 0 {
+		parent := new(models.UserFile)
+		has, err := session.Where("id = ?", uf.ParentId).Get(parent)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			folders, err := FolderPath(parent)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range folders {
+				parentPath = append(parentPath, f.Name)
+			}
+		}
+	}
+
+	item := &models.RecycleItem{
+		Identity:     tool.GenerateUUID(),
+		UserIdentity: uf.UserIdentity,
+		UserFileId:   uf.Id,
+		ParentId:     uf.ParentId,
+		Path:         strings.Join(parentPath, "/"),
+		Name:         uf.Name,
+		IsFolder:     IsFolder(uf),
+		Size:         size,
+	}
+	if _, err := session.Insert(item); err != nil {
+		return nil, err
+	}
+	// 同一批删除的记录用 recycle_identity 关联, 恢复和彻底删除时一起处理
+	_, err = session.In("id", ids).Cols("recycle_identity").Update(&models.UserFile{RecycleIdentity: item.Identity})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := session.In("id", ids).Delete(new(models.UserFile)); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ListRecycleItems 分页列出回收站, 最近删除的在前
+func ListRecycleItems(userIdentity string, page, pageSize int) ([]models.RecycleItem, int64, error) {
+	items := make([]models.RecycleItem, 0, pageSize)
+	count, err := server.GetEngine().Where("user_identity = ?", userIdentity).
+		Desc("id").Limit(pageSize, (page-1)*pageSize).FindAndCount(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
+
+func getRecycleItem(session *xorm.Session, userIdentity, identity string) (*models.RecycleItem, error) {
+	item := new(models.RecycleItem)
+	has, err := session.Where("identity = ? AND user_identity = ?", identity, userIdentity).Get(item)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	return item, nil
+}
+
+// RestoreRecycleItems 恢复到原来的目录. 原目录已不存在时按删除时的路径重建, 重名时按 policy 处理, 默认自动改名为 "name (1)".
+// 跳过的项目留在回收站中, 不出现在返回结果里
+func RestoreRecycleItems(userIdentity string, identities []string, policy string) ([]string, error) {
+	if policy == "" {
+		policy = ConflictRename
+	}
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(identities))
+	for _, identity := range identities {
+		item, err := getRecycleItem(session, userIdentity, identity)
+		if err != nil {
+			return nil, err
+		}
+		uf, err := restoreRecycleItem(session, item, policy)
+		if err != nil {
+			return nil, err
+		}
+		if uf != nil {
+			result = append(result, uf.Identity)
+		}
+	}
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func restoreRecycleItem(session *xorm.Session, item *models.RecycleItem, policy string) (*models.UserFile, error) {
+	uf := new(models.UserFile)
+	has, err := session.Unscoped().Where("id = ?", item.UserFileId).Get(uf)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	parentId, err := restoreParent(session, item)
+	if err != nil {
+		return nil, err
+	}
+	name, exist, err := resolveConflict(session, item.UserIdentity, parentId, uf.Name, item.IsFolder, policy)
+	if err != nil {
+		return nil, err
+	}
+	if exist != nil && policy == ConflictSkip {
+		return nil, nil
+	}
+
+	uf.ParentId, uf.Name, uf.UpdatedAt = parentId, name, time.Now()
+	if !item.IsFolder {
+		uf.Ext = path.Ext(name)
+	}
+	_, err = session.Unscoped().ID(uf.Id).Cols("parent_id", "name", "ext", "updated_at").Update(uf)
+	if err != nil {
+		return nil, err
+	}
+	_, err = session.Exec("UPDATE user_file SET deleted_at = NULL, recycle_identity = '' WHERE user_identity = ? AND recycle_identity = ?",
+		item.UserIdentity, item.Identity)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := session.ID(item.Id).Delete(new(models.RecycleItem)); err != nil {
+		return nil, err
+	}
+	if exist != nil {
+		// 恢复后再合并到同名的文件或目录中
+		if err := mergeInto(session, item.UserIdentity, uf, exist); err != nil {
+			return nil, err
+		}
+		return exist, nil
+	}
+	return uf, nil
+}
+
+// restoreParent 恢复的目标目录: 原目录还在时直接使用, 否则从根目录开始按路径查找或新建
+func restoreParent(session *xorm.Session, item *models.RecycleItem) (int, error) {
+	if item.ParentId == 0 {
+		return 0, nil
+	}
+	has, err := session.Where("id = ? AND user_identity = ?", item.ParentId, item.UserIdentity).Exist(new(models.UserFile))
+	if err != nil {
+		return 0, err
+	}
+	if has {
+		return item.ParentId, nil
+	}
+
+	parentId := 0
+	for _, name := range strings.Split(item.Path, "/") {
+		if name == "" {
+			continue
+		}
+		folder := new(models.UserFile)
+		has, err := session.Where("user_identity = ? AND parent_id = ? AND name = ? AND repository_identity = ''",
+			item.UserIdentity, parentId, name).Get(folder)
+		if err != nil {
+			return 0, err
+		}
+		if !has {
+			// 同名的是文件时新建的目录改名
+			if name, err = uniqueName(session, item.UserIdentity, parentId, name, true); err != nil {
+				return 0, err
+			}
+			if folder, err = insertFolder(session, item.UserIdentity, parentId, name); err != nil {
+				return 0, err
+			}
+		}
+		parentId = folder.Id
+	}
+	return parentId, nil
+}
+
+// PurgeRecycleItems 彻底删除, 释放文件引用, 没有其它引用的文件由 GC 回收
+func PurgeRecycleItems(userIdentity string, identities []string) error {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		item, err := getRecycleItem(session, userIdentity, identity)
+		if err != nil {
+			return err
+		}
+		if err := purgeRecycleItem(session, item); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+func purgeRecycleItem(session *xorm.Session, item *models.RecycleItem) error {
+	var files []models.UserFile
+	err := session.Unscoped().Where("user_identity = ? AND recycle_identity = ?", item.UserIdentity, item.Identity).Find(&files)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0, len(files))
+	for _, uf := range files {
+		ids = append(ids, uf.Id)
+		if IsFolder(&uf) {
+			continue
+		}
+		if err := releaseBlob(session, uf.RepositoryIdentity); err != nil {
+			return err
+		}
+		if err := purgeVersions(session, uf.Id); err != nil {
+			return err
+		}
+	}
+	if err := deleteFileTags(session, ids); err != nil {
+		return err
+	}
+	_, err = session.Unscoped().Where("user_identity = ? AND recycle_identity = ?", item.UserIdentity, item.Identity).
+		Delete(new(models.UserFile))
+	if err != nil {
+		return err
+	}
+	_, err = session.ID(item.Id).Delete(new(models.RecycleItem))
+	return err
+}
+
+// PurgeExpiredRecycleItems 彻底删除超过保留时间的回收站记录, 返回删除的数量
+func PurgeExpiredRecycleItems(ctx context.Context) (int, error) {
+	unlock, ok, err := tryLock(ctx, recyclePurgeLockKey, time.Hour)
+	if err != nil || !ok {
+		return 0, err
+	}
+	defer unlock()
+
+	engine := server.GetEngine()
+	cutoff := time.Now().Add(-RecycleRetention())
+	purged, lastId := 0, 0
+	for {
+		var items []models.RecycleItem
+		err := engine.Where("created_at < ? AND id > ?", cutoff, lastId).Asc("id").Limit(recyclePurgeBatch).Find(&items)
+		if err != nil {
+			return purged, err
+		}
+		for i := range items {
+			lastId = items[i].Id
+			// 单条失败不影响其他记录, 失败的记录下次清理时重试
+			if err := purgeExpired(&items[i]); err != nil {
+				tool.Logger.Errorf("purge recycle item %s error: %v", items[i].Identity, err)
+				continue
+			}
+			purged++
+		}
+		if len(items) < recyclePurgeBatch {
+			return purged, nil
+		}
+	}
+}
+
+func purgeExpired(item *models.RecycleItem) error {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	if err := purgeRecycleItem(session, item); err != nil {
+		return err
+	}
+	return session.Commit()
+}
+
+// StartRecyclePurge 每小时清理一次过期的回收站记录
+func StartRecyclePurge(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			purged, err := PurgeExpiredRecycleItems(ctx)
+			if err != nil {
+				tool.Logger.Errorf("purge recycle items error: %v", err)
+				continue
+			}
+			if purged > 0 {
+				tool.Logger.Infof("purged %d expired recycle items", purged)
+			}
+		}
+	}()
+}
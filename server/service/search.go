@@ -0,0 +1,241 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"net_disk/server"
+	"net_disk/server/models"
+)
+
+// SortByCreated 按创建时间排序, 只用于搜索
+const SortByCreated = "created"
+
+// CategoryFolder 搜索目录的类型
+const CategoryFolder = "folder"
+
+// FileCategories 文件类型和扩展名, 扩展名为小写并带 "."
+var FileCategories = map[string][]string{
+	"image":    {".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".svg", ".ico", ".tif", ".tiff", ".heic", ".raw"},
+	"video":    {".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv", ".webm", ".m4v", ".mpg", ".mpeg", ".3gp", ".ts"},
+	"audio":    {".mp3", ".wav", ".flac", ".aac", ".ogg", ".wma", ".m4a", ".ape", ".opus"},
+	"document": {".txt", ".md", ".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".csv", ".rtf", ".odt", ".ods", ".odp", ".wps"},
+	"archive":  {".zip", ".rar", ".7z", ".tar", ".gz", ".tgz", ".bz2", ".xz", ".zst"},
+	"code": {".go", ".java", ".py", ".js", ".jsx", ".tsx", ".c", ".h", ".cpp", ".hpp", ".cs", ".php", ".rb", ".rs",
+		".kt", ".swift", ".sh", ".sql", ".html", ".css", ".json", ".xml", ".yaml", ".yml", ".toml", ".ini", ".vue"},
+}
+
+// ValidCategory 是否为 FileCategories 中的类型或 CategoryFolder
+func ValidCategory(category string) bool {
+	_, ok := FileCategories[category]
+	return ok || category == CategoryFolder
+}
+
+// SearchQuery 搜索条件, 零值表示不限制
+type SearchQuery struct {
+	Name        string   // 名字包含的字符串, 不区分大小写
+	Prefix      bool     // Name 只匹配名字开头
+	Categories  []string // 满足任一类型即可
+	Exts        []string // 扩展名, 带不带 "." 都可以
+	MinSize     int64
+	MaxSize     int64     // 大于 0 时生效, 设置了大小范围时不返回目录
+	CreatedFrom time.Time // [CreatedFrom, CreatedTo)
+	CreatedTo   time.Time
+	UpdatedFrom time.Time // [UpdatedFrom, UpdatedTo)
+	UpdatedTo   time.Time
+	Within      *models.UserFile // 只搜索该目录的子树
+	TagId       int              // 只搜索带有该标签的
+	Sort        string           // name(默认)/size/time/created
+	Desc        bool
+	Cursor      string // 上一页返回的 next cursor
+	Limit       int
+}
+
+// searchCursor 上一页最后一项的排序字段和 id
+type searchCursor struct {
+	Name string    `json:"n,omitempty"`
+	Size int64     `json:"s,omitempty"`
+	Time time.Time `json:"t,omitempty"`
+	Id   int       `json:"i"`
+}
+
+func encodeCursor(c searchCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*searchCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := new(searchCursor)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// escapeLike 转义 LIKE 的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SearchUserFiles 按条件搜索用户的文件和目录, 使用 keyset 分页: 返回的 next cursor 为空表示没有更多结果
+func SearchUserFiles(userIdentity string, q SearchQuery) ([]UserFileItem, string, error) {
+	engine := server.GetEngine()
+	session := engine.Table("user_file").
+		Select("user_file.*, COALESCE(file_info.size, 0) AS size").
+		Join("LEFT", "file_info", "file_info.identity = user_file.repository_identity").
+		Where("user_file.user_identity = ?", userIdentity)
+	defer session.Close()
+
+	if q.Name != "" {
+		pattern := escapeLike(strings.ToLower(q.Name)) + "%"
+		if !q.Prefix {
+			pattern = "%" + pattern
+		}
+		session.And("LOWER(user_file.name) LIKE ?", pattern)
+	}
+
+	var exts []string
+	folder := false
+	for _, category := range q.Categories {
+		if category == CategoryFolder {
+			folder = true
+			continue
+		}
+		exts = append(exts, FileCategories[category]...)
+	}
+	for _, ext := range q.Exts {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	switch {
+	case len(exts) > 0 && folder:
+		session.And("("+inCondition("LOWER(user_file.ext)", len(exts))+" OR user_file.repository_identity = '')", toArgs(exts)...)
+	case len(exts) > 0:
+		session.And("user_file.repository_identity <> ''").In("LOWER(user_file.ext)", exts)
+	case folder:
+		session.And("user_file.repository_identity = ''")
+	}
+
+	if q.MinSize > 0 || q.MaxSize > 0 {
+		session.And("user_file.repository_identity <> ''")
+		if q.MinSize > 0 {
+			session.And("file_info.size >= ?", q.MinSize)
+		}
+		if q.MaxSize > 0 {
+			session.And("file_info.size <= ?", q.MaxSize)
+		}
+	}
+	if !q.CreatedFrom.IsZero() {
+		session.And("user_file.created_at >= ?", q.CreatedFrom)
+	}
+	if !q.CreatedTo.IsZero() {
+		session.And("user_file.created_at < ?", q.CreatedTo)
+	}
+	if !q.UpdatedFrom.IsZero() {
+		session.And("user_file.updated_at >= ?", q.UpdatedFrom)
+	}
+	if !q.UpdatedTo.IsZero() {
+		session.And("user_file.updated_at < ?", q.UpdatedTo)
+	}
+
+	if q.TagId != 0 {
+		session.Join("INNER", "user_file_tag", "user_file_tag.user_file_id = user_file.id AND user_file_tag.tag_id = ?", q.TagId)
+	}
+	if q.Within != nil {
+		folders, err := subtreeFolders(q.Within)
+		if err != nil {
+			return nil, "", err
+		}
+		session.In("user_file.parent_id", folders)
+	}
+
+	column := "user_file.name"
+	switch q.Sort {
+	case SortBySize:
+		column = "COALESCE(file_info.size, 0)"
+	case SortByTime:
+		column = "user_file.updated_at"
+	case SortByCreated:
+		column = "user_file.created_at"
+	}
+	op, order := ">", ""
+	if q.Desc {
+		op, order = "<", " DESC"
+	}
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		var value interface{} = cursor.Name
+		switch q.Sort {
+		case SortBySize:
+			value = cursor.Size
+		case SortByTime, SortByCreated:
+			value = cursor.Time
+		}
+		session.And("("+column+" "+op+" ? OR ("+column+" = ? AND user_file.id "+op+" ?))", value, value, cursor.Id)
+	}
+
+	items := make([]UserFileItem, 0, q.Limit+1)
+	err := session.OrderBy(column + order + ", user_file.id" + order).Limit(q.Limit + 1).Find(&items)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(items) <= q.Limit {
+		return items, "", nil
+	}
+	items = items[:q.Limit]
+	last := items[len(items)-1]
+	cursor := searchCursor{Id: last.Id}
+	switch q.Sort {
+	case SortBySize:
+		cursor.Size = last.Size
+	case SortByTime:
+		cursor.Time = last.UpdatedAt
+	case SortByCreated:
+		cursor.Time = last.CreatedAt
+	default:
+		cursor.Name = last.Name
+	}
+	return items, encodeCursor(cursor), nil
+}
+
+// subtreeFolders folder 和它所有子目录的 id
+func subtreeFolders(folder *models.UserFile) ([]int, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	items, err := listSubtree(session, folder)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int{folder.Id}
+	for i := range items {
+		if IsFolder(&items[i].UserFile) {
+			ids = append(ids, items[i].Id)
+		}
+	}
+	return ids, nil
+}
+
+// inCondition 生成 "column IN (?,?,...)"
+func inCondition(column string, n int) string {
+	return column + " IN (" + strings.TrimSuffix(strings.Repeat("?,", n), ",") + ")"
+}
+
+func toArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
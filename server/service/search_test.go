@@ -0,0 +1,32 @@
+package service
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	tests := []searchCursor{
+		{Id: 1},
+		{Name: "报告 (1).pdf", Id: 42},
+		{Size: 1 << 40, Id: 7},
+		{Time: time.Date(2024, 5, 6, 7, 8, 9, 123, time.UTC), Id: 9},
+	}
+	for _, c := range tests {
+		s := encodeCursor(c)
+		got, err := decodeCursor(s)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q) error = %v", s, err)
+		}
+		if got.Name != c.Name || got.Size != c.Size || !got.Time.Equal(c.Time) || got.Id != c.Id {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) = %+v", c, got)
+		}
+	}
+
+	for _, s := range []string{"not base64!", base64.RawURLEncoding.EncodeToString([]byte("not json"))} {
+		if _, err := decodeCursor(s); err != ErrInvalidCursor {
+			t.Errorf("decodeCursor(%q) error = %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
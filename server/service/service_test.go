@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/go-xorm/xorm"
+	_ "github.com/mattn/go-sqlite3"
+	xormcore "xorm.io/core"
+
+	"net_disk/server/models"
+)
+
+// newTestSession 内存 sqlite 上的 session, 只同步需要的表
+func newTestSession(t *testing.T, beans ...interface{}) *xorm.Session {
+	t.Helper()
+	engine, err := xorm.NewEngine("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接一份, 只用一个连接
+	engine.SetMaxOpenConns(1)
+	engine.SetMapper(xormcore.GonicMapper{})
+	if err := engine.Sync2(beans...); err != nil {
+		t.Fatal(err)
+	}
+	session := engine.NewSession()
+	t.Cleanup(func() {
+		session.Close()
+		engine.Close()
+	})
+	return session
+}
+
+// insertTestFile 插入一条 UserFile, repository 为空时是目录
+func insertTestFile(t *testing.T, session *xorm.Session, userIdentity string, parentId int, name, repository string) *models.UserFile {
+	t.Helper()
+	uf := &models.UserFile{
+		Identity:           userIdentity + "/" + name,
+		UserIdentity:       userIdentity,
+		ParentId:           parentId,
+		Name:               name,
+		RepositoryIdentity: repository,
+	}
+	if _, err := session.Insert(uf); err != nil {
+		t.Fatal(err)
+	}
+	return uf
+}
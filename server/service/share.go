@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/models"
+)
+
+const (
+	shareIdentityLength = 8
+	shareCodeLength     = 4
+	shareCodeChars      = "abcdefghijkmnpqrstuvwxyz23456789" // 去掉容易混淆的 l/o/0/1
+	shareChars          = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	// 同一 IP 对同一分享连续输错提取码的次数上限, 超过后在 shareFailWindow 内拒绝
+	maxShareFails = 10
+	// 同一分享所有来源累计输错的上限, 防止更换或伪造 IP 绕过按 IP 的限制
+	maxShareTotalFails = 100
+	shareFailWindow    = 10 * time.Minute
+)
+
+var shareCodeRegexp = regexp.MustCompile(`^[0-9a-zA-Z]{4}$`)
+
+// ValidShareDays 分享有效期只能是 1/7/30 天, 0 表示永久有效
+func ValidShareDays(days int) bool {
+	switch days {
+	case 0, 1, 7, 30:
+		return true
+	}
+	return false
+}
+
+// ValidShareCode 提取码为 4 位字母或数字, 空串表示不需要提取码
+func ValidShareCode(code string) bool {
+	return code == "" || shareCodeRegexp.MatchString(code)
+}
+
+// ShareURL 分享链接
+func ShareURL(share *models.FileShare) string {
+	base := server.GetConfig().Share.BaseURL
+	if base == "" {
+		base = "/s/"
+	}
+	return base + share.Identity
+}
+
+func randomString(chars string, n int) (string, error) {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(chars)))
+	for i := range b {
+		v, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = chars[v.Int64()]
+	}
+	return string(b), nil
+}
+
+// CreateShare 分享用户自己的文件或目录, days 为 0 时永久有效. randomCode 为 true 时忽略 code 并随机生成提取码.
+// maxDownloads 大于 0 时下载次数达到后链接失效
+func CreateShare(userIdentity, fileIdentity string, days int, code string, randomCode bool, maxDownloads int) (*models.FileShare, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	uf, err := getUserFile(session, userIdentity, fileIdentity)
+	if err != nil {
+		return nil, err
+	}
+	if randomCode {
+		if code, err = randomString(shareCodeChars, shareCodeLength); err != nil {
+			return nil, err
+		}
+	}
+	share := &models.FileShare{
+		UserIdentity: userIdentity,
+		UserFileId:   uf.Id,
+		Code:         strings.ToLower(code),
+		MaxDownloads: maxDownloads,
+	}
+	if days > 0 {
+		share.ExpiredAt = time.Now().AddDate(0, 0, days)
+	}
+	// 短标识可能重复, 重复时重新生成
+	for {
+		if share.Identity, err = randomString(shareChars, shareIdentityLength); err != nil {
+			return nil, err
+		}
+		has, err := session.Unscoped().Where("identity = ?", share.Identity).Exist(new(models.FileShare))
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			break
+		}
+	}
+	if _, err := session.Insert(share); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// ShareItem 分享列表中的一项, 分享的文件已被删除时 UserFile 为 nil
+type ShareItem struct {
+	models.FileShare
+	UserFile *models.UserFile
+}
+
+// ListShares 分页列出用户的分享, 最近创建的在前
+func ListShares(userIdentity string, page, pageSize int) ([]ShareItem, int64, error) {
+	engine := server.GetEngine()
+	shares := make([]models.FileShare, 0, pageSize)
+	count, err := engine.Where("user_identity = ?", userIdentity).
+		Desc("id").
+		Limit(pageSize, (page-1)*pageSize).
+		FindAndCount(&shares)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int, 0, len(shares))
+	for _, share := range shares {
+		ids = append(ids, share.UserFileId)
+	}
+	var files []models.UserFile
+	if len(ids) > 0 {
+		if err := engine.Where("user_identity = ?", userIdentity).In("id", ids).Find(&files); err != nil {
+			return nil, 0, err
+		}
+	}
+	byId := make(map[int]*models.UserFile, len(files))
+	for i := range files {
+		byId[files[i].Id] = &files[i]
+	}
+	items := make([]ShareItem, 0, len(shares))
+	for _, share := range shares {
+		items = append(items, ShareItem{FileShare: share, UserFile: byId[share.UserFileId]})
+	}
+	return items, count, nil
+}
+
+// CancelShares 取消分享, 链接立即失效
+func CancelShares(userIdentity string, identities []string) error {
+	_, err := server.GetEngine().Where("user_identity = ?", userIdentity).In("identity", identities).
+		Delete(new(models.FileShare))
+	return err
+}
+
+// checkFails 按 IP 和按链接分别统计输错的次数, 任意一个达到上限时返回 ErrTooManyAttempts
+func checkFails(ctx context.Context, prefix, identity, ip string) error {
+	counts, err := server.GetRedisClient().MGet(ctx, prefix+identity+":"+ip, prefix+identity).Result()
+	if err != nil {
+		return err
+	}
+	limits := []int{maxShareFails, maxShareTotalFails}
+	for i, v := range counts {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if n, _ := strconv.Atoi(s); n >= limits[i] {
+			return ErrTooManyAttempts
+		}
+	}
+	return nil
+}
+
+// recordFail 记录一次输错, 两个计数都在 shareFailWindow 后过期
+func recordFail(ctx context.Context, prefix, identity, ip string) error {
+	pipe := server.GetRedisClient().TxPipeline()
+	for _, key := range []string{prefix + identity + ":" + ip, prefix + identity} {
+		pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, shareFailWindow)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ResolveShare 公开访问分享: 检查是否过期、下载次数和提取码. 同一 IP 或同一分享连续输错提取码过多时返回 ErrTooManyAttempts
+func ResolveShare(ctx context.Context, identity, code, ip string) (*models.FileShare, error) {
+	share := new(models.FileShare)
+	has, err := server.GetEngine().Where("identity = ?", identity).Get(share)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	if !share.ExpiredAt.IsZero() && time.Now().After(share.ExpiredAt) {
+		return nil, ErrShareExpired
+	}
+	if err := CheckShareDownload(ctx, share); err != nil {
+		return nil, err
+	}
+	if share.Code == "" {
+		return share, nil
+	}
+
+	if err := checkFails(ctx, "share:fail:", identity, ip); err != nil {
+		return nil, err
+	}
+	if strings.ToLower(code) != share.Code {
+		if err := recordFail(ctx, "share:fail:", identity, ip); err != nil {
+			return nil, err
+		}
+		return nil, ErrShareCode
+	}
+	return share, nil
+}
+
+// ShareFile 分享中的文件或目录, identity 为空时返回分享的根. 只能访问根本身及根目录下的内容
+func ShareFile(share *models.FileShare, identity string) (*models.UserFile, error) {
+	engine := server.GetEngine()
+	root := new(models.UserFile)
+	has, err := engine.Where("id = ? AND user_identity = ?", share.UserFileId, share.UserIdentity).Get(root)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	if identity == "" || identity == root.Identity {
+		return root, nil
+	}
+	if !IsFolder(root) {
+		return nil, ErrNotFound
+	}
+	uf, err := GetUserFile(share.UserIdentity, identity)
+	if err != nil {
+		return nil, err
+	}
+	path, err := FolderPath(uf)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range path {
+		if p.Id == root.Id {
+			return uf, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListShareFolder 分页列出分享中的目录, folderIdentity 为空时列出分享的根目录
+func ListShareFolder(share *models.FileShare, folderIdentity, sort string, desc bool, page, pageSize int) ([]UserFileItem, int64, error) {
+	folder, err := ShareFile(share, folderIdentity)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !IsFolder(folder) {
+		return nil, 0, ErrNotFound
+	}
+	return ListFolder(share.UserIdentity, folder.Id, 0, sort, desc, page, pageSize)
+}
+
+// ShareOwnerName 分享者的用户名
+func ShareOwnerName(share *models.FileShare) (string, error) {
+	return UserName(share.UserIdentity)
+}
+
+// UserName 用户名, 用户不存在时为空串
+func UserName(userIdentity string) (string, error) {
+	user := new(models.UserInfo)
+	if _, err := server.GetEngine().Where("identity = ?", userIdentity).Cols("name").Get(user); err != nil {
+		return "", err
+	}
+	return user.Name, nil
+}
+
+// SaveShare 把分享中的文件和目录保存到自己的 targetId 目录, identities 为空时保存整个分享.
+// 复用原来的 FileInfo, 不复制存储对象, 但占用自己的空间. 同名时按 policy 处理, 总数较多时返回后台任务
+func SaveShare(userIdentity string, share *models.FileShare, identities []string, targetId int, policy string) ([]string, *Job, error) {
+	if len(identities) == 0 {
+		identities = []string{""}
+	}
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+
+	sources := make([]*models.UserFile, 0, len(identities))
+	names := make(map[string]bool, len(identities))
+	var total, size int64
+	for _, identity := range identities {
+		uf, err := ShareFile(share, identity)
+		if err != nil {
+			return nil, nil, err
+		}
+		// 保存自己的分享和复制相同, 不能保存到分享的目录中
+		if share.UserIdentity == userIdentity {
+			if err := checkTarget(session, uf, targetId); err != nil {
+				return nil, nil, err
+			}
+		}
+		if policy == "" || policy == ConflictFail {
+			if names[uf.Name] {
+				return nil, nil, ErrNameExists
+			}
+			names[uf.Name] = true
+			if err := checkName(session, userIdentity, targetId, uf.Name, 0); err != nil {
+				return nil, nil, err
+			}
+		}
+		n, bytes, err := treeSize(session, uf)
+		if err != nil {
+			return nil, nil, err
+		}
+		total += n
+		size += bytes
+		sources = append(sources, uf)
+	}
+	// 同步保存时锁持有到事务提交; 后台任务只在开始前检查
+	unlock, err := LockQuota(context.Background(), userIdentity)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	if err := checkQuota(userIdentity, size); err != nil {
+		return nil, nil, err
+	}
+	return copyUserFiles(userIdentity, sources, targetId, policy, total)
+}
+
+// treeSize uf 及其子目录中的文件和目录总数, 以及文件的总大小
+func treeSize(session *xorm.Session, uf *models.UserFile) (int64, int64, error) {
+	if !IsFolder(uf) {
+		fi := new(models.FileInfo)
+		if _, err := session.Where("identity = ?", uf.RepositoryIdentity).Get(fi); err != nil {
+			return 0, 0, err
+		}
+		return 1, fi.Size, nil
+	}
+	items, err := listSubtree(session, uf)
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	for _, item := range items {
+		size += item.Size
+	}
+	return int64(len(items)) + 1, size, nil
+}
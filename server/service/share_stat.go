@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+// 分享统计:
+//   - 访问和下载时在 redis 中累加 share:stat:<shareId>:<day> 的 views/downloads/bytes, 并把 key 记入 shareStatDirtyKey
+//   - StartShareStatFlush 定期取出这些 key 写入 ShareDailyStat 和 FileShare 的合计
+//   - 下载次数限制使用单独的 share:downloads:<shareId> 计数, 不随写入数据库清零, 不存在时从 FileShare.Downloads 恢复
+//   - 分段下载按客户端在 share:range:<shareId>:<file>:<ip> 中累计字节数, 累计到文件大小时计一次下载
+
+const (
+	shareStatPrefix      = "share:stat:"
+	shareStatDirtyKey    = "share:stat_dirty"
+	shareDownloadsPrefix = "share:downloads:"
+	shareDownloadsExpire = 30 * 24 * time.Hour
+	shareRangePrefix     = "share:range:"
+	shareRangeExpire     = 24 * time.Hour
+	statDayLayout        = "2006-01-02"
+	// MaxStatDays 统计最多查询的天数
+	MaxStatDays = 90
+)
+
+func shareStatKey(shareId int, day string) string {
+	return fmt.Sprintf("%s%d:%s", shareStatPrefix, shareId, day)
+}
+
+func shareDownloadsKey(shareId int) string {
+	return shareDownloadsPrefix + strconv.Itoa(shareId)
+}
+
+// recordShareStat 累加当天的统计, 失败只记录日志, 不影响访问
+func recordShareStat(ctx context.Context, shareId int, views, downloads, bytes int64) {
+	key := shareStatKey(shareId, time.Now().Format(statDayLayout))
+	pipe := server.GetRedisClient().TxPipeline()
+	if views > 0 {
+		pipe.HIncrBy(ctx, key, "views", views)
+	}
+	if downloads > 0 {
+		pipe.HIncrBy(ctx, key, "downloads", downloads)
+	}
+	if bytes > 0 {
+		pipe.HIncrBy(ctx, key, "bytes", bytes)
+	}
+	pipe.SAdd(ctx, shareStatDirtyKey, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		tool.Logger.Errorf("record share %d stat error: %v", shareId, err)
+	}
+}
+
+// RecordShareView 记一次访问
+func RecordShareView(ctx context.Context, share *models.FileShare) {
+	recordShareStat(ctx, share.Id, 1, 0, 0)
+}
+
+// RecordShareBytes 记录下载的流量
+func RecordShareBytes(ctx context.Context, share *models.FileShare, n int64) {
+	if n > 0 {
+		recordShareStat(ctx, share.Id, 0, 0, n)
+	}
+}
+
+// shareDownloadCount 分享的下载总次数, 包括还没有写入数据库的
+func shareDownloadCount(ctx context.Context, share *models.FileShare) (int64, error) {
+	n, err := server.GetRedisClient().Get(ctx, shareDownloadsKey(share.Id)).Int64()
+	if err == redis.Nil {
+		return share.Downloads, nil
+	}
+	return n, err
+}
+
+// CheckShareDownload 检查下载次数, 达到 MaxDownloads 后返回 ErrShareExhausted. 不计数的续传请求也要检查
+func CheckShareDownload(ctx context.Context, share *models.FileShare) error {
+	if share.MaxDownloads <= 0 {
+		return nil
+	}
+	n, err := shareDownloadCount(ctx, share)
+	if err != nil {
+		return err
+	}
+	if n >= int64(share.MaxDownloads) {
+		return ErrShareExhausted
+	}
+	return nil
+}
+
+// AcquireShareDownload 记一次下载, 达到 MaxDownloads 后返回 ErrShareExhausted
+func AcquireShareDownload(ctx context.Context, share *models.FileShare) error {
+	client := server.GetRedisClient()
+	key := shareDownloadsKey(share.Id)
+	if err := client.SetNX(ctx, key, share.Downloads, shareDownloadsExpire).Err(); err != nil {
+		return err
+	}
+	n, err := client.Incr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	client.Expire(ctx, key, shareDownloadsExpire)
+	if share.MaxDownloads > 0 && n > int64(share.MaxDownloads) {
+		client.Decr(ctx, key)
+		return ErrShareExhausted
+	}
+	recordShareStat(ctx, share.Id, 0, 1, 0)
+	return nil
+}
+
+// AcquireShareRange 分段下载累计 n 字节, 同一客户端累计下载了整个文件时记一次下载, 超出的部分计入下一次.
+// 达到 MaxDownloads 后返回 ErrShareExhausted
+func AcquireShareRange(ctx context.Context, share *models.FileShare, fileIdentity, ip string, n, size int64) error {
+	client := server.GetRedisClient()
+	key := fmt.Sprintf("%s%d:%s:%s", shareRangePrefix, share.Id, fileIdentity, ip)
+	total, err := client.IncrBy(ctx, key, n).Result()
+	if err != nil {
+		return err
+	}
+	client.Expire(ctx, key, shareRangeExpire)
+	if total < size {
+		return nil
+	}
+	if err := AcquireShareDownload(ctx, share); err != nil {
+		client.DecrBy(ctx, key, n)
+		return err
+	}
+	client.DecrBy(ctx, key, size)
+	return nil
+}
+
+// FlushShareStats 把 redis 中累加的统计写入数据库, 返回写入的 key 数
+func FlushShareStats(ctx context.Context) (int, error) {
+	client := server.GetRedisClient()
+	for n := 0; ; n++ {
+		key, err := client.SPop(ctx, shareStatDirtyKey).Result()
+		if err == redis.Nil {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := flushShareStat(ctx, key); err != nil {
+			client.SAdd(context.Background(), shareStatDirtyKey, key)
+			return n, err
+		}
+	}
+}
+
+func flushShareStat(ctx context.Context, key string) error {
+	parts := strings.Split(strings.TrimPrefix(key, shareStatPrefix), ":")
+	if len(parts) != 2 {
+		return nil
+	}
+	shareId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil
+	}
+	day := parts[1]
+
+	// 取出并删除, 之后的累加写入新的 key
+	client := server.GetRedisClient()
+	pipe := client.TxPipeline()
+	get := pipe.HGetAll(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	stat := parseShareStat(get.Val())
+	if stat.Views == 0 && stat.Downloads == 0 && stat.Bytes == 0 {
+		return nil
+	}
+	if err := saveShareStat(shareId, day, stat); err != nil {
+		// 写入失败时加回 redis, 下次重试
+		pipe := client.TxPipeline()
+		pipe.HIncrBy(context.Background(), key, "views", stat.Views)
+		pipe.HIncrBy(context.Background(), key, "downloads", stat.Downloads)
+		pipe.HIncrBy(context.Background(), key, "bytes", stat.Bytes)
+		if _, e := pipe.Exec(context.Background()); e != nil {
+			tool.Logger.Errorf("restore share stat %s error: %v", key, e)
+		}
+		return err
+	}
+	return nil
+}
+
+func parseShareStat(values map[string]string) ShareStatDay {
+	var stat ShareStatDay
+	stat.Views, _ = strconv.ParseInt(values["views"], 10, 64)
+	stat.Downloads, _ = strconv.ParseInt(values["downloads"], 10, 64)
+	stat.Bytes, _ = strconv.ParseInt(values["bytes"], 10, 64)
+	return stat
+}
+
+func saveShareStat(shareId int, day string, stat ShareStatDay) error {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	row := new(models.ShareDailyStat)
+	has, err := session.Where("share_id = ? AND day = ?", shareId, day).Get(row)
+	if err != nil {
+		return err
+	}
+	if has {
+		_, err = session.ID(row.Id).Incr("views", stat.Views).Incr("downloads", stat.Downloads).Incr("bytes", stat.Bytes).
+			Update(new(models.ShareDailyStat))
+	} else {
+		_, err = session.Insert(&models.ShareDailyStat{
+			ShareId:   shareId,
+			Day:       day,
+			Views:     stat.Views,
+			Downloads: stat.Downloads,
+			Bytes:     stat.Bytes,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	// 取消的分享也要更新合计
+	_, err = session.Unscoped().ID(shareId).Incr("views", stat.Views).Incr("downloads", stat.Downloads).Incr("bytes", stat.Bytes).
+		Update(new(models.FileShare))
+	if err != nil {
+		return err
+	}
+	return session.Commit()
+}
+
+// StartShareStatFlush 定期把分享统计写入数据库
+func StartShareStatFlush(ctx context.Context) {
+	interval := time.Duration(server.GetConfig().Share.FlushInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := FlushShareStats(ctx); err != nil {
+				tool.Logger.Errorf("flush share stats error: %v", err)
+			}
+		}
+	}()
+}
+
+// ShareStatDay 一天的统计
+type ShareStatDay struct {
+	Day       string
+	Views     int64
+	Downloads int64
+	Bytes     int64
+}
+
+// ShareStats 分享的合计和最近每天的统计, 包括还没有写入数据库的部分
+type ShareStats struct {
+	Share     *models.FileShare
+	Views     int64
+	Downloads int64
+	Bytes     int64
+	Series    []ShareStatDay // 按日期升序, 没有访问的日期为 0
+}
+
+// GetShareStats 用户自己分享的统计, days 为最近的天数, 包括今天
+func GetShareStats(ctx context.Context, userIdentity, identity string, days int) (*ShareStats, error) {
+	engine := server.GetEngine()
+	share := new(models.FileShare)
+	has, err := engine.Where("identity = ? AND user_identity = ?", identity, userIdentity).Get(share)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+
+	today := time.Now()
+	from := today.AddDate(0, 0, 1-days).Format(statDayLayout)
+	var rows []models.ShareDailyStat
+	if err := engine.Where("share_id = ? AND day >= ?", share.Id, from).Find(&rows); err != nil {
+		return nil, err
+	}
+	saved := make(map[string]models.ShareDailyStat, len(rows))
+	for _, row := range rows {
+		saved[row.Day] = row
+	}
+
+	pipe := server.GetRedisClient().Pipeline()
+	pending := make([]*redis.StringStringMapCmd, days)
+	for i := 0; i < days; i++ {
+		day := today.AddDate(0, 0, i+1-days).Format(statDayLayout)
+		pending[i] = pipe.HGetAll(ctx, shareStatKey(share.Id, day))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	stats := &ShareStats{
+		Share:     share,
+		Views:     share.Views,
+		Downloads: share.Downloads,
+		Bytes:     share.Bytes,
+		Series:    make([]ShareStatDay, 0, days),
+	}
+	for i := 0; i < days; i++ {
+		day := today.AddDate(0, 0, i+1-days).Format(statDayLayout)
+		stat := parseShareStat(pending[i].Val())
+		stats.Views += stat.Views
+		stats.Downloads += stat.Downloads
+		stats.Bytes += stat.Bytes
+		row := saved[day]
+		stat.Day = day
+		stat.Views += row.Views
+		stat.Downloads += row.Downloads
+		stat.Bytes += row.Bytes
+		stats.Series = append(stats.Series, stat)
+	}
+	return stats, nil
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+const (
+	// MaxTagNameLength 标签名最大字符数
+	MaxTagNameLength = 32
+	// DefaultTagColor 没有指定颜色时使用
+	DefaultTagColor = "#8c8c8c"
+)
+
+var tagColorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// checkTag 校验标签名和颜色, 同一用户的标签不能重名. excludeId 为修改的标签本身
+func checkTag(session *xorm.Session, userIdentity, name, color string, excludeId int) error {
+	if name == "" || utf8.RuneCountInString(name) > MaxTagNameLength || !tagColorRegexp.MatchString(color) {
+		return ErrInvalidTag
+	}
+	has, err := session.Where("user_identity = ? AND name = ? AND id <> ?", userIdentity, name, excludeId).Exist(new(models.Tag))
+	if err != nil {
+		return err
+	}
+	if has {
+		return ErrTagExists
+	}
+	return nil
+}
+
+// CreateTag 新建标签
+func CreateTag(userIdentity, name, color string) (*models.Tag, error) {
+	name = strings.TrimSpace(name)
+	if color == "" {
+		color = DefaultTagColor
+	}
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := checkTag(session, userIdentity, name, color, 0); err != nil {
+		return nil, err
+	}
+	tag := &models.Tag{
+		Identity:     tool.GenerateUUID(),
+		UserIdentity: userIdentity,
+		Name:         name,
+		Color:        strings.ToLower(color),
+	}
+	if _, err := session.Insert(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// UpdateTag 修改标签名和颜色, 空串表示不修改
+func UpdateTag(tag *models.Tag, name, color string) error {
+	if name = strings.TrimSpace(name); name != "" {
+		tag.Name = name
+	}
+	if color != "" {
+		tag.Color = strings.ToLower(color)
+	}
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := checkTag(session, tag.UserIdentity, tag.Name, tag.Color, tag.Id); err != nil {
+		return err
+	}
+	_, err := session.ID(tag.Id).Cols("name", "color").Update(tag)
+	return err
+}
+
+// DeleteTag 删除标签, 同时从所有文件上移除
+func DeleteTag(tag *models.Tag) error {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	if _, err := session.Where("tag_id = ?", tag.Id).Delete(new(models.UserFileTag)); err != nil {
+		return err
+	}
+	if _, err := session.ID(tag.Id).Delete(new(models.Tag)); err != nil {
+		return err
+	}
+	return session.Commit()
+}
+
+// GetTag 用户自己的标签
+func GetTag(userIdentity, identity string) (*models.Tag, error) {
+	tag := new(models.Tag)
+	has, err := server.GetEngine().Where("identity = ? AND user_identity = ?", identity, userIdentity).Get(tag)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	return tag, nil
+}
+
+// ListTags 用户的所有标签, 按名字排序
+func ListTags(userIdentity string) ([]models.Tag, error) {
+	tags := make([]models.Tag, 0)
+	err := server.GetEngine().Where("user_identity = ?", userIdentity).Asc("name").Find(&tags)
+	return tags, err
+}
+
+// TagUserFiles 给文件和目录打上标签, 已有该标签的跳过
+func TagUserFiles(tag *models.Tag, identities []string) error {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		uf, err := getUserFile(session, tag.UserIdentity, identity)
+		if err != nil {
+			return err
+		}
+		has, err := session.Where("tag_id = ? AND user_file_id = ?", tag.Id, uf.Id).Exist(new(models.UserFileTag))
+		if err != nil {
+			return err
+		}
+		if has {
+			continue
+		}
+		if _, err := session.Insert(&models.UserFileTag{TagId: tag.Id, UserFileId: uf.Id}); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+// UntagUserFiles 从文件和目录上移除标签
+func UntagUserFiles(tag *models.Tag, identities []string) error {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		uf, err := getUserFile(session, tag.UserIdentity, identity)
+		if err != nil {
+			return err
+		}
+		if _, err := session.Where("tag_id = ? AND user_file_id = ?", tag.Id, uf.Id).Delete(new(models.UserFileTag)); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+// ListTaggedFiles 分页列出带有标签的文件和目录, 最近打标签的在前
+func ListTaggedFiles(tag *models.Tag, page, pageSize int) ([]UserFileItem, int64, error) {
+	items := make([]UserFileItem, 0, pageSize)
+	count, err := server.GetEngine().Table("user_file").
+		Select("user_file.*, COALESCE(file_info.size, 0) AS size").
+		Join("INNER", "user_file_tag", "user_file_tag.user_file_id = user_file.id").
+		Join("LEFT", "file_info", "file_info.identity = user_file.repository_identity").
+		Where("user_file.user_identity = ? AND user_file_tag.tag_id = ?", tag.UserIdentity, tag.Id).
+		OrderBy("user_file_tag.id DESC").
+		Limit(pageSize, (page-1)*pageSize).
+		FindAndCount(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
+
+// GetUserFileTags 文件和目录上的标签, key 为 UserFile.Id
+func GetUserFileTags(userFileIds []int) (map[int][]models.Tag, error) {
+	result := make(map[int][]models.Tag)
+	if len(userFileIds) == 0 {
+		return result, nil
+	}
+	type fileTag struct {
+		models.Tag `xorm:"extends"`
+		UserFileId int
+	}
+	var rows []fileTag
+	err := server.GetEngine().Table("tag").
+		Select("tag.*, user_file_tag.user_file_id").
+		Join("INNER", "user_file_tag", "user_file_tag.tag_id = tag.id").
+		In("user_file_tag.user_file_id", userFileIds).
+		Asc("tag.name").
+		Find(&rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.UserFileId] = append(result[row.UserFileId], row.Tag)
+	}
+	return result, nil
+}
+
+// deleteFileTags 文件被彻底删除时移除它的标签
+func deleteFileTags(session *xorm.Session, userFileIds []int) error {
+	if len(userFileIds) == 0 {
+		return nil
+	}
+	_, err := session.In("user_file_id", userFileIds).Delete(new(models.UserFileTag))
+	return err
+}
+
+// SetFavorite 收藏或取消收藏文件和目录
+func SetFavorite(userIdentity string, identities []string, favorite bool) error {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		uf, err := getUserFile(session, userIdentity, identity)
+		if err != nil {
+			return err
+		}
+		if uf.Favorite == favorite {
+			continue
+		}
+		uf.Favorite = favorite
+		uf.FavoritedAt = time.Now()
+		if _, err := session.ID(uf.Id).Cols("favorite", "favorited_at").Update(uf); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+// ListFavorites 分页列出收藏的文件和目录, 最近收藏的在前
+func ListFavorites(userIdentity string, page, pageSize int) ([]UserFileItem, int64, error) {
+	items := make([]UserFileItem, 0, pageSize)
+	count, err := server.GetEngine().Table("user_file").
+		Select("user_file.*, COALESCE(file_info.size, 0) AS size").
+		Join("LEFT", "file_info", "file_info.identity = user_file.repository_identity").
+		Where("user_file.user_identity = ? AND user_file.favorite = ?", userIdentity, true).
+		OrderBy("user_file.favorited_at DESC, user_file.id DESC").
+		Limit(pageSize, (page-1)*pageSize).
+		FindAndCount(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
+
+// mergeFileTags src 被合并到 dst 时, 把 src 的标签转给 dst
+func mergeFileTags(session *xorm.Session, srcId, dstId int) error {
+	var tags []models.UserFileTag
+	if err := session.Where("user_file_id = ?", srcId).Find(&tags); err != nil {
+		return err
+	}
+	for _, t := range tags {
+		has, err := session.Where("tag_id = ? AND user_file_id = ?", t.TagId, dstId).Exist(new(models.UserFileTag))
+		if err != nil {
+			return err
+		}
+		if has {
+			_, err = session.ID(t.Id).Delete(new(models.UserFileTag))
+		} else {
+			_, err = session.ID(t.Id).Cols("user_file_id").Update(&models.UserFileTag{UserFileId: dstId})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hash"
+	"io"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+
+	"net_disk/server"
+	"net_disk/server/models"
+)
+
+// MaxUploadSize 单个文件的最大长度
+const MaxUploadSize = MaxPartSize * MaxPartCount
+
+// Checksum 客户端提供的校验值, 对应 tus 的 Upload-Checksum 头
+type Checksum struct {
+	Hash   hash.Hash
+	Expect []byte
+}
+
+// InitTusUpload 创建 tus 上传, 底层使用分片上传. 客户端每次 PATCH 的长度不固定,
+// 不足 MinPartSize 的数据先暂存在 redis 中, 和后面的数据凑满 MinPartSize 或到达文件结尾时再作为一个分片上传
+func InitTusUpload(ctx context.Context, userIdentity string, target FileTarget, hash string, size int64) (*UploadSession, error) {
+	if size < 0 || size > MaxUploadSize {
+		return nil, ErrInvalidPart
+	}
+	if err := CheckUploadQuota(userIdentity, target, size); err != nil {
+		return nil, err
+	}
+	if err := checkUploadConflict(userIdentity, target); err != nil {
+		return nil, err
+	}
+	session := newUploadSession(userIdentity, target, hash, size)
+	session.Tus = true
+	if err := startUploadSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func tusBufferKey(identity string) string {
+	return "upload:session:" + identity + ":buffer"
+}
+
+// UploadOffset 已接收的字节数, 包括暂存还没有上传的数据
+func UploadOffset(ctx context.Context, session *UploadSession) (int64, error) {
+	parts, err := ListUploadedParts(ctx, session)
+	if err != nil {
+		return 0, err
+	}
+	buffered, err := server.GetRedisClient().StrLen(ctx, tusBufferKey(session.Identity)).Result()
+	if err != nil {
+		return 0, err
+	}
+	offset := buffered
+	for _, p := range parts {
+		offset += p.Size
+	}
+	return offset, nil
+}
+
+// AppendTusUpload 从 offset 处追加数据, size 未知时传 -1. 暂存的数据加上本次的数据不足 MinPartSize 且没有到达文件结尾时继续暂存,
+// 否则一起作为一个分片上传. 数据写满后合并分片并创建 FileInfo/UserFile, 此时返回的 UserFile 不为 nil
+func AppendTusUpload(ctx context.Context, session *UploadSession, offset int64, r io.Reader, size int64, checksum *Checksum) (int64, *models.UserFile, error) {
+	unlock, err := lockUploadSession(ctx, session)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer unlock()
+
+	parts, err := ListUploadedParts(ctx, session)
+	if err != nil {
+		return 0, nil, err
+	}
+	client := server.GetRedisClient()
+	bufferKey := tusBufferKey(session.Identity)
+	buffered, err := client.Get(ctx, bufferKey).Bytes()
+	if err != nil && err != redis.Nil {
+		return 0, nil, err
+	}
+	var current int64
+	for _, p := range parts {
+		current += p.Size
+	}
+	current += int64(len(buffered))
+	if offset != current {
+		return current, nil, ErrOffsetMismatch
+	}
+	if size >= 0 && offset+size > session.Size {
+		return current, nil, ErrInvalidPart
+	}
+
+	counter := &countWriter{}
+	var w io.Writer = counter
+	if checksum != nil {
+		w = io.MultiWriter(counter, checksum.Hash)
+	}
+	body := io.TeeReader(io.LimitReader(r, session.Size-offset), w)
+	// 先读入凑满 MinPartSize 需要的部分, 读不满说明本次的数据已经读完
+	head := make([]byte, MinPartSize-int64(len(buffered)))
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return current, nil, err
+	}
+	head = head[:n]
+	full := int64(n) == MinPartSize-int64(len(buffered))
+	if !full {
+		if checksum != nil && !bytes.Equal(checksum.Hash.Sum(nil), checksum.Expect) {
+			return current, nil, ErrChecksumMismatch
+		}
+		if offset+int64(n) < session.Size {
+			pipe := client.TxPipeline()
+			pipe.Append(ctx, bufferKey, string(head))
+			pipe.ExpireAt(ctx, bufferKey, session.ExpiredAt)
+			if _, err := pipe.Exec(ctx); err != nil {
+				return current, nil, err
+			}
+			return current + int64(n), nil, nil
+		}
+	}
+
+	bc, err := sessionCipher(session)
+	if err != nil {
+		return current, nil, err
+	}
+	// 暂存的数据和已读入的部分放在分片开头, 其余部分边读边转发
+	partSize := int64(-1)
+	switch {
+	case !full:
+		partSize = int64(len(buffered) + n)
+	case size >= 0:
+		partSize = int64(len(buffered)) + size
+	}
+	reader := io.MultiReader(bytes.NewReader(buffered), bytes.NewReader(head), body)
+	// 上一次 PATCH 失败的分片没有记录, 这里会用同一个分片号覆盖它
+	partNumber := len(parts) + 1
+	sealed, sealedSize, err := sealObject(reader, partSize, bc, partNumber)
+	if err != nil {
+		return current, nil, err
+	}
+	etag, err := server.GetStorage().UploadPart(ctx, session.Key, session.UploadID, partNumber, sealed, sealedSize)
+	if err != nil {
+		return current, nil, err
+	}
+	if checksum != nil && !bytes.Equal(checksum.Hash.Sum(nil), checksum.Expect) {
+		return current, nil, ErrChecksumMismatch
+	}
+
+	part := UploadedPart{PartNumber: partNumber, ETag: etag, Size: int64(len(buffered)) + counter.n}
+	if err := saveTusPart(ctx, session, part); err != nil {
+		return current, nil, err
+	}
+	current += counter.n
+	if current < session.Size {
+		return current, nil, nil
+	}
+
+	uf, err := completeUploadSession(ctx, session)
+	return current, uf, err
+}
+
+// saveTusPart 记录分片并清空暂存的数据, 两者在同一个事务中完成, 已接收的偏移不会重复计算
+func saveTusPart(ctx context.Context, session *UploadSession, part UploadedPart) error {
+	data, err := json.Marshal(part)
+	if err != nil {
+		return err
+	}
+	key := sessionPartsKey(session.Identity)
+	pipe := server.GetRedisClient().TxPipeline()
+	pipe.HSet(ctx, key, strconv.Itoa(part.PartNumber), data)
+	pipe.ExpireAt(ctx, key, session.ExpiredAt)
+	pipe.Del(ctx, tusBufferKey(session.Identity))
+	_, err = pipe.Exec(ctx)
+	return err
+}
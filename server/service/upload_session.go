@@ -0,0 +1,456 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"net_disk/server"
+	"net_disk/server/crypt"
+	"net_disk/server/models"
+	"net_disk/server/storage"
+	"net_disk/tool"
+)
+
+const (
+	// MinPartSize 除最后一片外每片的最小长度, 和 S3/COS 的限制一致
+	MinPartSize int64 = 5 << 20
+	// MaxPartSize 单片最大长度
+	MaxPartSize int64 = 5 << 30
+	// MaxPartCount 最多分片数
+	MaxPartCount = 10000
+)
+
+// UploadSession 分片上传会话, 保存在 redis 中, 客户端中断后可以继续上传
+type UploadSession struct {
+	Identity     string
+	UserIdentity string
+	Key          string // 存储对象 key
+	UploadID     string // 存储后端的 uploadID
+	Owner        string // 上传到别人分享的目录时为目录的所有者
+	ParentId     int
+	Name         string
+	Overwrite    string // 覆盖的 UserFile
+	Conflict     string // 同名冲突的处理方式, 在完成上传时生效
+	Size         int64  // 文件总大小
+	Hash         string
+	PartSize     int64 // tus 上传的分片长度不固定, 为 0
+	Tus          bool
+	DataKey      []byte // 加密上传时的数据密钥, 用上传者的用户密钥加密
+	ExpiredAt    time.Time
+	// 合并分片后的进度, 之后的步骤失败时客户端可以再次调用 complete, 从这里继续
+	Merged       bool   // 存储后端已合并分片, uploadID 已失效
+	FileIdentity string // 已校验内容并创建 FileInfo
+}
+
+// UploadedPart 已上传的分片
+type UploadedPart struct {
+	PartNumber int
+	ETag       string
+	Size       int64
+}
+
+// PartCount 分片数量
+func (s *UploadSession) PartCount() int {
+	if s.Size == 0 {
+		return 1
+	}
+	return int((s.Size + s.PartSize - 1) / s.PartSize)
+}
+
+// ExpectPartSize 第 n 片应有的长度
+func (s *UploadSession) ExpectPartSize(n int) int64 {
+	if n == s.PartCount() {
+		return s.Size - int64(n-1)*s.PartSize
+	}
+	return s.PartSize
+}
+
+func sessionKey(identity string) string {
+	return "upload:session:" + identity
+}
+
+func sessionPartsKey(identity string) string {
+	return "upload:session:" + identity + ":parts"
+}
+
+func sessionExpire() time.Duration {
+	if expire := server.GetConfig().Upload.SessionExpire; expire > 0 {
+		return time.Duration(expire) * time.Second
+	}
+	return 24 * time.Hour
+}
+
+// InitUploadSession 创建分片上传会话, partSize 为 0 时使用最小分片长度
+func InitUploadSession(ctx context.Context, userIdentity string, target FileTarget, hash string, size, partSize int64) (*UploadSession, error) {
+	if partSize == 0 {
+		partSize = MinPartSize
+	}
+	if size < 0 || partSize < MinPartSize || partSize > MaxPartSize || (size+partSize-1)/partSize > MaxPartCount {
+		return nil, ErrInvalidPart
+	}
+	if err := CheckUploadQuota(userIdentity, target, size); err != nil {
+		return nil, err
+	}
+	if err := checkUploadConflict(userIdentity, target); err != nil {
+		return nil, err
+	}
+
+	session := newUploadSession(userIdentity, target, hash, size)
+	session.PartSize = partSize
+	if err := startUploadSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// checkUploadConflict 同名冲突按 fail 处理时在创建会话前检查, 避免传完才发现重名. 完成上传时还会再检查一次
+func checkUploadConflict(userIdentity string, target FileTarget) error {
+	if target.Identity != "" || (target.Conflict != "" && target.Conflict != ConflictFail) {
+		return nil
+	}
+	owner := target.Owner
+	if owner == "" {
+		owner = userIdentity
+	}
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+	return checkName(session, owner, target.ParentId, target.Name, 0)
+}
+
+func newUploadSession(userIdentity string, target FileTarget, hash string, size int64) *UploadSession {
+	return &UploadSession{
+		Identity:     tool.GenerateUUID(),
+		UserIdentity: userIdentity,
+		Key:          storage.NewKey(hash, path.Ext(target.Name)),
+		Owner:        target.Owner,
+		ParentId:     target.ParentId,
+		Name:         target.Name,
+		Overwrite:    target.Identity,
+		Conflict:     target.Conflict,
+		Size:         size,
+		Hash:         strings.ToLower(hash),
+		ExpiredAt:    time.Now().Add(sessionExpire()),
+	}
+}
+
+// startUploadSession 在存储后端初始化分片上传并保存会话
+func startUploadSession(ctx context.Context, session *UploadSession) error {
+	bc, err := newBlobCipher()
+	if err != nil {
+		return err
+	}
+	if bc != nil {
+		session.DataKey, err = wrapDataKey(session.UserIdentity, bc.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	uploadID, err := server.GetStorage().InitMultipart(ctx, session.Key)
+	if err != nil {
+		return err
+	}
+	session.UploadID = uploadID
+
+	if err := saveUploadSession(ctx, session); err != nil {
+		_ = server.GetStorage().AbortMultipart(ctx, session.Key, session.UploadID)
+		return err
+	}
+	return nil
+}
+
+// sessionCipher 会话的数据密钥, 未加密时返回 nil
+func sessionCipher(session *UploadSession) (*blobCipher, error) {
+	if len(session.DataKey) == 0 {
+		return nil, nil
+	}
+	uk, err := userKey(session.UserIdentity)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypt.Unwrap(uk, session.DataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &blobCipher{Key: key}, nil
+}
+
+func saveUploadSession(ctx context.Context, session *UploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return server.GetRedisClient().Set(ctx, sessionKey(session.Identity), data, time.Until(session.ExpiredAt)).Err()
+}
+
+// GetUploadSession 获取当前用户的上传会话, 过期或不存在时返回 ErrNotFound
+func GetUploadSession(ctx context.Context, userIdentity, identity string) (*UploadSession, error) {
+	val, err := server.GetRedisClient().Get(ctx, sessionKey(identity)).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session UploadSession
+	if err := json.Unmarshal([]byte(val), &session); err != nil {
+		return nil, err
+	}
+	if session.UserIdentity != userIdentity {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+// ListUploadedParts 已上传的分片, 按分片号排序
+func ListUploadedParts(ctx context.Context, session *UploadSession) ([]UploadedPart, error) {
+	values, err := server.GetRedisClient().HGetAll(ctx, sessionPartsKey(session.Identity)).Result()
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]UploadedPart, 0, len(values))
+	for _, v := range values {
+		var part UploadedPart
+		if err := json.Unmarshal([]byte(v), &part); err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+	return parts, nil
+}
+
+// savePart 记录已上传的分片, 同一分片重复上传时覆盖
+func savePart(ctx context.Context, session *UploadSession, part UploadedPart) error {
+	data, err := json.Marshal(part)
+	if err != nil {
+		return err
+	}
+	client := server.GetRedisClient()
+	key := sessionPartsKey(session.Identity)
+	if err := client.HSet(ctx, key, strconv.Itoa(part.PartNumber), data).Err(); err != nil {
+		return err
+	}
+	return client.ExpireAt(ctx, key, session.ExpiredAt).Err()
+}
+
+// checkPart 校验分片号和长度
+func checkPart(session *UploadSession, partNumber int, size int64) error {
+	if session.Tus {
+		return ErrInvalidPart
+	}
+	if partNumber < 1 || partNumber > session.PartCount() {
+		return ErrInvalidPart
+	}
+	if size >= 0 && size != session.ExpectPartSize(partNumber) {
+		return ErrInvalidPart
+	}
+	return nil
+}
+
+// PartDigest 客户端提供的分片摘要, 为空的不校验
+type PartDigest struct {
+	MD5    []byte
+	SHA256 []byte
+}
+
+// UploadSessionPart 把 r 直接转发到存储后端, 同时计算 md5/sha256 和客户端提供的摘要比较.
+// 校验失败的分片不会被记录, 客户端用同一个分片号重传即可覆盖
+func UploadSessionPart(ctx context.Context, session *UploadSession, partNumber int, r io.Reader, size int64, digest PartDigest) (*UploadedPart, error) {
+	if err := checkPart(session, partNumber, size); err != nil {
+		return nil, err
+	}
+	bc, err := sessionCipher(session)
+	if err != nil {
+		return nil, err
+	}
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	counter := &countWriter{}
+	reader, sealedSize, err := sealObject(io.TeeReader(r, io.MultiWriter(md5Hash, sha256Hash, counter)), size, bc, partNumber)
+	if err != nil {
+		return nil, err
+	}
+	etag, err := server.GetStorage().UploadPart(ctx, session.Key, session.UploadID, partNumber, reader, sealedSize)
+	if err != nil {
+		return nil, err
+	}
+	if counter.n != session.ExpectPartSize(partNumber) {
+		return nil, ErrInvalidPart
+	}
+	if len(digest.MD5) > 0 && !bytes.Equal(digest.MD5, md5Hash.Sum(nil)) {
+		return nil, ErrChecksumMismatch
+	}
+	if len(digest.SHA256) > 0 && !bytes.Equal(digest.SHA256, sha256Hash.Sum(nil)) {
+		return nil, ErrChecksumMismatch
+	}
+
+	part := &UploadedPart{PartNumber: partNumber, ETag: etag, Size: counter.n}
+	if err := savePart(ctx, session, *part); err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+// lockUploadSession 防止同一会话被并发 complete/abort
+func lockUploadSession(ctx context.Context, session *UploadSession) (func(), error) {
+	key := sessionKey(session.Identity) + ":lock"
+	ok, err := server.GetRedisClient().SetNX(ctx, key, 1, time.Minute*10).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUploadInProgress
+	}
+	return func() {
+		server.GetRedisClient().Del(context.Background(), key)
+	}, nil
+}
+
+// CompleteUploadSession 用 redis 中记录的分片合并文件, 创建 FileInfo 和 UserFile
+func CompleteUploadSession(ctx context.Context, session *UploadSession) (*models.UserFile, error) {
+	unlock, err := lockUploadSession(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return completeUploadSession(ctx, session)
+}
+
+// completeUploadSession 调用方需要持有会话锁. 分片必须从 1 开始连续且总长度等于文件大小.
+// 合并分片和创建 FileInfo 后分别记录进度, 后面的步骤失败时再次调用不会重复合并
+func completeUploadSession(ctx context.Context, session *UploadSession) (*models.UserFile, error) {
+	uploaded, err := ListUploadedParts(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	if len(uploaded) == 0 {
+		return nil, ErrUploadIncomplete
+	}
+	bc, err := sessionCipher(session)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]storage.Part, 0, len(uploaded))
+	layout := make(crypt.Layout, 0, len(uploaded))
+	for i, p := range uploaded {
+		if p.PartNumber != i+1 {
+			return nil, ErrUploadIncomplete
+		}
+		parts = append(parts, storage.Part{PartNumber: p.PartNumber, ETag: p.ETag})
+		layout = append(layout, p.Size)
+	}
+	if layout.Size() != session.Size {
+		return nil, ErrUploadIncomplete
+	}
+	if bc != nil {
+		bc.Layout = layout
+	}
+
+	if !session.Merged {
+		if err := server.GetStorage().CompleteMultipart(ctx, session.Key, session.UploadID, parts); err != nil {
+			return nil, err
+		}
+		session.Merged = true
+		if err := saveUploadSession(ctx, session); err != nil {
+			return nil, err
+		}
+	}
+
+	var fi *models.FileInfo
+	if session.FileIdentity == "" {
+		fi, err = commitUploadedObject(ctx, session, bc)
+		if err != nil {
+			return nil, err
+		}
+		session.FileIdentity = fi.Identity
+		if err := saveUploadSession(ctx, session); err != nil {
+			return nil, err
+		}
+	} else if fi, err = GetFileInfo(session.FileIdentity); err != nil {
+		return nil, err
+	}
+
+	target := FileTarget{Owner: session.Owner, ParentId: session.ParentId, Name: session.Name, Identity: session.Overwrite, Conflict: session.Conflict}
+	unlock, err := LockQuota(ctx, target.owner(session.UserIdentity))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	db := server.GetEngine().NewSession()
+	defer db.Close()
+	if err := db.Begin(); err != nil {
+		return nil, err
+	}
+	uf, err := saveUserFile(db, session.UserIdentity, target, fi)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Commit(); err != nil {
+		return nil, err
+	}
+	if uf.RepositoryIdentity == fi.Identity {
+		enqueueIndex(fi, uf.Ext)
+	}
+
+	deleteUploadSession(ctx, session)
+	return uf, nil
+}
+
+// commitUploadedObject 分片是流式转发的, 合并后重新读一遍计算整个文件的 md5, 和客户端声明的 hash 比较, 一致时创建 FileInfo
+func commitUploadedObject(ctx context.Context, session *UploadSession, bc *blobCipher) (*models.FileInfo, error) {
+	sum, n, err := hashObject(ctx, session.Key, bc)
+	if err != nil {
+		return nil, err
+	}
+	if n != session.Size || (session.Hash != "" && sum != session.Hash) {
+		if err := server.GetStorage().Delete(ctx, session.Key); err != nil {
+			tool.Logger.Errorf("delete object %s error: %v", session.Key, err)
+		}
+		deleteUploadSession(ctx, session)
+		return nil, ErrHashMismatch
+	}
+	return commitBlob(ctx, session.UserIdentity, session.Key, session.Name, sum, n, bc)
+}
+
+// AbortUploadSession 取消上传并清理已上传的分片
+func AbortUploadSession(ctx context.Context, session *UploadSession) error {
+	unlock, err := lockUploadSession(ctx, session)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if !session.Merged {
+		if err := server.GetStorage().AbortMultipart(ctx, session.Key, session.UploadID); err != nil {
+			return err
+		}
+	} else if session.FileIdentity == "" {
+		// 已合并但还没有创建 FileInfo, 合并出的对象没有其它引用; 已创建的 FileInfo 没有引用时由 GC 回收
+		if err := server.GetStorage().Delete(ctx, session.Key); err != nil {
+			return err
+		}
+	}
+	deleteUploadSession(ctx, session)
+	return nil
+}
+
+func deleteUploadSession(ctx context.Context, session *UploadSession) {
+	err := server.GetRedisClient().Del(ctx, sessionKey(session.Identity), sessionPartsKey(session.Identity), tusBufferKey(session.Identity)).Err()
+	if err != nil {
+		tool.Logger.Errorf("delete upload session %s error: %v", session.Identity, err)
+	}
+}
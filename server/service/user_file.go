@@ -0,0 +1,181 @@
+package service
+
+import (
+	"path"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"net_disk/server"
+	"net_disk/server/models"
+	"net_disk/tool"
+)
+
+// GetParentId 把父目录的 identity 转成 UserFile.ParentId, 空串表示根目录
+func GetParentId(userIdentity, parentIdentity string) (int, error) {
+	if parentIdentity == "" {
+		return 0, nil
+	}
+	folder := new(models.UserFile)
+	has, err := server.GetEngine().
+		Where("identity = ? AND user_identity = ? AND repository_identity = ''", parentIdentity, userIdentity).
+		Get(folder)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		return 0, ErrNotFound
+	}
+	return folder.Id, nil
+}
+
+// CreateUserFile 在用户的 parentId 目录下新建一条指向 fi 的文件记录, 同时增加 fi 的引用计数, 加密文件为用户保存数据密钥.
+// 同一目录下已有同名文件时返回 ErrNameExists. 调用方需要在事务中调用
+func CreateUserFile(session *xorm.Session, userIdentity string, parentId int, name string, fi *models.FileInfo) (*models.UserFile, error) {
+	if err := checkName(session, userIdentity, parentId, name, 0); err != nil {
+		return nil, err
+	}
+	uf := &models.UserFile{
+		Identity:           tool.GenerateUUID(),
+		UserIdentity:       userIdentity,
+		ParentId:           parentId,
+		RepositoryIdentity: fi.Identity,
+		Name:               name,
+		Ext:                path.Ext(name),
+		ModifiedBy:         userIdentity,
+		ModifiedAt:         time.Now(),
+		UpdatedAt:          time.Now(),
+	}
+	if err := acquireBlob(session, fi.Identity); err != nil {
+		return nil, err
+	}
+	if err := grantFileKey(session, userIdentity, fi); err != nil {
+		return nil, err
+	}
+	if _, err := session.Insert(uf); err != nil {
+		return nil, nameError(err)
+	}
+	return uf, nil
+}
+
+// FileTarget 上传的文件保存的位置. Identity 不为空时覆盖该文件的内容, 原内容保存为历史版本;
+// 否则目录中已有同名文件时按 Conflict 处理. Owner 为目录或文件所属的用户, 空串表示上传者自己
+type FileTarget struct {
+	Owner    string
+	ParentId int
+	Name     string
+	Identity string
+	Conflict string
+}
+
+// owner 文件的所有者, 没有指定时为上传者自己
+func (t FileTarget) owner(userIdentity string) string {
+	if t.Owner != "" {
+		return t.Owner
+	}
+	return userIdentity
+}
+
+// ResolveFileTarget 把客户端传入的父目录和要覆盖的文件转换成 FileTarget, 覆盖时沿用原文件的目录和文件名.
+// 上传到别人分享的目录或覆盖别人分享的文件需要编辑权限
+func ResolveFileTarget(userIdentity, parentIdentity, name, fileIdentity, conflict string) (FileTarget, error) {
+	if fileIdentity != "" {
+		uf, err := GetAccessibleFile(userIdentity, fileIdentity, PermissionEdit)
+		if err != nil {
+			return FileTarget{}, err
+		}
+		if IsFolder(uf) {
+			return FileTarget{}, ErrNotFound
+		}
+		return FileTarget{Owner: uf.UserIdentity, ParentId: uf.ParentId, Name: uf.Name, Identity: uf.Identity}, nil
+	}
+	owner, parentId, err := ResolveFolder(userIdentity, parentIdentity, PermissionEdit)
+	if err != nil {
+		return FileTarget{}, err
+	}
+	return FileTarget{Owner: owner, ParentId: parentId, Name: name, Conflict: conflict}, nil
+}
+
+// SaveUserFile 把上传的内容保存到 target: 新建文件, 或者覆盖已有文件. 同名冲突按 target.Conflict 处理, 跳过时返回已有的文件.
+// 保存后在后台建立全文索引. 调用方需要持有所有者的 LockQuota 并在事务中调用
+func SaveUserFile(session *xorm.Session, userIdentity string, target FileTarget, fi *models.FileInfo) (*models.UserFile, error) {
+	uf, err := saveUserFile(session, userIdentity, target, fi)
+	if err != nil {
+		return nil, err
+	}
+	if uf.RepositoryIdentity == fi.Identity {
+		enqueueIndex(fi, uf.Ext)
+	}
+	return uf, nil
+}
+
+func saveUserFile(session *xorm.Session, userIdentity string, target FileTarget, fi *models.FileInfo) (*models.UserFile, error) {
+	owner := target.owner(userIdentity)
+	if target.Identity == "" {
+		name, exist, err := resolveConflict(session, owner, target.ParentId, target.Name, false, target.Conflict)
+		if err != nil {
+			return nil, err
+		}
+		if exist != nil {
+			if target.Conflict == ConflictSkip {
+				return exist, nil
+			}
+			return overwriteWithQuota(session, userIdentity, exist, fi)
+		}
+		if err := checkQuota(owner, fi.Size); err != nil {
+			return nil, err
+		}
+		uf, err := CreateUserFile(session, owner, target.ParentId, name, fi)
+		if err != nil || owner == userIdentity {
+			return uf, err
+		}
+		// 上传到别人分享的目录, 文件属于目录的所有者
+		uf.ModifiedBy = userIdentity
+		_, err = session.ID(uf.Id).Cols("modified_by").Update(uf)
+		return uf, err
+	}
+	uf, err := getUserFile(session, owner, target.Identity)
+	if err != nil {
+		return nil, err
+	}
+	return overwriteWithQuota(session, userIdentity, uf, fi)
+}
+
+// overwriteWithQuota 覆盖前检查所有者的空间, 原内容保存为历史版本仍然占用空间, 所以按新内容的大小计算
+func overwriteWithQuota(session *xorm.Session, userIdentity string, uf *models.UserFile, fi *models.FileInfo) (*models.UserFile, error) {
+	if uf.RepositoryIdentity != fi.Identity {
+		if err := checkQuota(uf.UserIdentity, fi.Size); err != nil {
+			return nil, err
+		}
+	}
+	return overwriteUserFile(session, userIdentity, uf, fi)
+}
+
+// ModTime 内容的修改时间, 早期数据没有 ModifiedAt 时用 UpdatedAt
+func ModTime(uf *models.UserFile) time.Time {
+	if !uf.ModifiedAt.IsZero() {
+		return uf.ModifiedAt
+	}
+	if !uf.UpdatedAt.IsZero() {
+		return uf.UpdatedAt
+	}
+	return uf.CreatedAt
+}
+
+// GetUserFile 用户自己的, 或者别人直接分享给用户的文件或目录, 只需要查看权限. 修改时使用 GetAccessibleFile 检查编辑权限
+func GetUserFile(userIdentity, identity string) (*models.UserFile, error) {
+	return GetAccessibleFile(userIdentity, identity, PermissionView)
+}
+
+// getUserFile 只返回用户自己的文件或目录
+func getUserFile(session *xorm.Session, userIdentity, identity string) (*models.UserFile, error) {
+	uf := new(models.UserFile)
+	has, err := session.Where("identity = ? AND user_identity = ?", identity, userIdentity).Get(uf)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, ErrNotFound
+	}
+	return uf, nil
+}
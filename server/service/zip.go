@@ -0,0 +1,149 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"net_disk/server"
+	"net_disk/server/models"
+)
+
+// MaxZipEntries 打包下载最多包含的文件和目录数
+const MaxZipEntries = 100000
+
+// 已经压缩过的格式, 打包时直接存储, 不再压缩
+var storedExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp4": true, ".mkv": true, ".avi": true, ".mov": true, ".wmv": true, ".flv": true, ".webm": true, ".m4v": true,
+	".mp3": true, ".aac": true, ".m4a": true, ".ogg": true, ".opus": true, ".flac": true, ".ape": true, ".wma": true,
+	".zip": true, ".rar": true, ".7z": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".pdf": true, ".jar": true, ".apk": true,
+}
+
+// ZipEntry 压缩包中的一项, 目录的 Path 以 "/" 结尾
+type ZipEntry struct {
+	Path     string
+	UserFile *models.UserFile
+	FileInfo *models.FileInfo // 目录为 nil
+}
+
+// CollectZipEntries 把选中的文件和目录 (包括子目录) 展开成压缩包中的路径, 选中的项目都放在压缩包的根目录下, 重名时自动改名.
+// 可以选择别人直接分享给用户的文件和目录
+func CollectZipEntries(userIdentity string, identities []string) ([]ZipEntry, error) {
+	session := server.GetEngine().NewSession()
+	defer session.Close()
+
+	var entries []ZipEntry
+	roots := make(map[string]bool)
+	for _, identity := range identities {
+		uf, err := getAccessibleFile(session, userIdentity, identity, PermissionView)
+		if err != nil {
+			return nil, err
+		}
+		name := uf.Name
+		for i := 1; roots[strings.ToLower(name)]; i++ {
+			name = numberedName(uf.Name, i, IsFolder(uf))
+		}
+		roots[strings.ToLower(name)] = true
+
+		if !IsFolder(uf) {
+			entries = append(entries, ZipEntry{Path: name, UserFile: uf})
+			continue
+		}
+		entries = append(entries, ZipEntry{Path: name + "/", UserFile: uf})
+		subtree, err := listSubtree(session, uf)
+		if err != nil {
+			return nil, err
+		}
+		// listSubtree 按层返回, 父目录总在子项之前
+		paths := map[int]string{uf.Id: name + "/"}
+		for i := range subtree {
+			item := &subtree[i].UserFile
+			p := paths[item.ParentId] + item.Name
+			if IsFolder(item) {
+				p += "/"
+				paths[item.Id] = p
+			}
+			entries = append(entries, ZipEntry{Path: p, UserFile: item})
+		}
+		if len(entries) > MaxZipEntries {
+			return nil, ErrTooManyEntries
+		}
+	}
+	if len(entries) > MaxZipEntries {
+		return nil, ErrTooManyEntries
+	}
+
+	// 一次查出所有文件的 FileInfo
+	var files []string
+	for _, e := range entries {
+		if !IsFolder(e.UserFile) {
+			files = append(files, e.UserFile.RepositoryIdentity)
+		}
+	}
+	infos := make(map[string]*models.FileInfo, len(files))
+	for start := 0; start < len(files); start += 500 {
+		end := start + 500
+		if end > len(files) {
+			end = len(files)
+		}
+		var batch []models.FileInfo
+		if err := session.In("identity", files[start:end]).Find(&batch); err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			infos[batch[i].Identity] = &batch[i]
+		}
+	}
+	for i := range entries {
+		if IsFolder(entries[i].UserFile) {
+			continue
+		}
+		fi, ok := infos[entries[i].UserFile.RepositoryIdentity]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		entries[i].FileInfo = fi
+	}
+	return entries, nil
+}
+
+// WriteZip 边从存储读取边写出压缩包, 不在本地暂存, 每个文件用它所有者的密钥读取.
+// 文件名使用 UTF-8 并设置对应标志位, 超过 4GB 时自动使用 ZIP64
+func WriteZip(ctx context.Context, w io.Writer, entries []ZipEntry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		header := &zip.FileHeader{
+			Name:     e.Path,
+			Modified: ModTime(e.UserFile),
+			Method:   zip.Deflate,
+		}
+		if e.FileInfo == nil || storedExts[strings.ToLower(path.Ext(e.Path))] {
+			header.Method = zip.Store
+		}
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if e.FileInfo == nil {
+			continue
+		}
+		if err := copyBlob(ctx, fw, e.FileInfo, e.UserFile.UserIdentity); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func copyBlob(ctx context.Context, w io.Writer, fi *models.FileInfo, userIdentity string) error {
+	r, err := OpenBlob(ctx, fi, userIdentity, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
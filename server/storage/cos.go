@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	cos "github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// CosConfig 腾讯云 COS 配置
+type CosConfig struct {
+	BucketURL string `yaml:"bucket_url"`
+	SecretID  string `yaml:"secret_id"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+// CosBackend 腾讯云 COS 存储
+type CosBackend struct {
+	client *cos.Client
+}
+
+func NewCosBackend(config CosConfig) (*CosBackend, error) {
+	u, err := url.Parse(config.BucketURL)
+	if err != nil {
+		return nil, err
+	}
+	client := cos.NewClient(&cos.BaseURL{BucketURL: u}, &http.Client{
+		Transport: &cos.AuthorizationTransport{
+			SecretID:  config.SecretID,
+			SecretKey: config.SecretKey,
+		},
+	})
+	return &CosBackend{client: client}, nil
+}
+
+func (b *CosBackend) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	opt := &cos.ObjectPutOptions{}
+	if size >= 0 {
+		opt.ObjectPutHeaderOptions = &cos.ObjectPutHeaderOptions{ContentLength: size}
+	}
+	_, err := b.client.Object.Put(ctx, key, r, opt)
+	return err
+}
+
+func (b *CosBackend) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	resp, err := b.client.Object.Get(ctx, key, &cos.ObjectGetOptions{Range: rangeHeader(offset, length)})
+	if err != nil {
+		if cos.IsNotFoundError(err) {
+			return nil, ErrNotExist
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *CosBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := b.client.Object.Head(ctx, key, nil)
+	if err != nil {
+		if cos.IsNotFoundError(err) {
+			return nil, ErrNotExist
+		}
+		return nil, err
+	}
+	info := &ObjectInfo{
+		Key:  key,
+		Size: resp.ContentLength,
+		ETag: strings.Trim(resp.Header.Get("ETag"), "\""),
+	}
+	info.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+func (b *CosBackend) Delete(ctx context.Context, key string) error {
+	_, err := b.client.Object.Delete(ctx, key)
+	if err != nil && cos.IsNotFoundError(err) {
+		return nil
+	}
+	return err
+}
+
+func (b *CosBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var list []ObjectInfo
+	opt := &cos.BucketGetOptions{Prefix: prefix, MaxKeys: 1000}
+	for {
+		res, _, err := b.client.Bucket.Get(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range res.Contents {
+			modified, _ := time.Parse(time.RFC3339, o.LastModified)
+			list = append(list, ObjectInfo{
+				Key:          o.Key,
+				Size:         o.Size,
+				ETag:         strings.Trim(o.ETag, "\""),
+				LastModified: modified,
+			})
+		}
+		if !res.IsTruncated {
+			return list, nil
+		}
+		opt.Marker = res.NextMarker
+	}
+}
+
+func (b *CosBackend) InitMultipart(ctx context.Context, key string) (string, error) {
+	v, _, err := b.client.Object.InitiateMultipartUpload(ctx, key, nil)
+	if err != nil {
+		return "", err
+	}
+	return v.UploadID, nil
+}
+
+func (b *CosBackend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, r io.Reader, size int64) (string, error) {
+	opt := &cos.ObjectUploadPartOptions{}
+	if size >= 0 {
+		opt.ContentLength = size
+	}
+	resp, err := b.client.Object.UploadPart(ctx, key, uploadID, partNumber, r, opt)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(resp.Header.Get("ETag"), "\""), nil
+}
+
+func (b *CosBackend) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	opt := &cos.CompleteMultipartUploadOptions{}
+	for _, p := range parts {
+		opt.Parts = append(opt.Parts, cos.Object{PartNumber: p.PartNumber, ETag: p.ETag})
+	}
+	_, _, err := b.client.Object.CompleteMultipartUpload(ctx, key, uploadID, opt)
+	return err
+}
+
+func (b *CosBackend) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	_, err := b.client.Object.AbortMultipartUpload(ctx, key, uploadID)
+	if err != nil && cos.IsNotFoundError(err) {
+		return nil
+	}
+	return err
+}
+
+func (b *CosBackend) ListMultipart(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	var list []MultipartUpload
+	opt := &cos.ListMultipartUploadsOptions{Prefix: prefix, MaxUploads: 1000}
+	for {
+		res, _, err := b.client.Bucket.ListMultipartUploads(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range res.Uploads {
+			initiated, _ := time.Parse(time.RFC3339, u.Initiated)
+			list = append(list, MultipartUpload{Key: u.Key, UploadID: u.UploadID, Initiated: initiated})
+		}
+		if !res.IsTruncated {
+			return list, nil
+		}
+		opt.KeyMarker = res.NextKeyMarker
+		opt.UploadIDMarker = res.NextUploadIDMarker
+	}
+}
@@ -0,0 +1,128 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"net_disk/server/storage"
+)
+
+// cosServer 只实现 Put/Get/Head/Delete 的内存 COS
+type cosServer struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *cosServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = data
+		w.Header().Set("ETag", "\"etag\"")
+		// SDK 用这个头校验上传的内容
+		w.Header().Set("x-cos-hash-crc64ecma", strconv.FormatUint(crc64.Checksum(data, crc64.MakeTable(crc64.ECMA)), 10))
+	case http.MethodGet, http.MethodHead:
+		data, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", "\"etag\"")
+		http.ServeContent(w, r, key, time.Unix(0, 0), bytes.NewReader(data))
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newCos(t *testing.T) (*storage.CosBackend, *cosServer) {
+	t.Helper()
+	fake := &cosServer{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	b, err := storage.NewCosBackend(storage.CosConfig{BucketURL: srv.URL, SecretID: "id", SecretKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, fake
+}
+
+func TestCosPutGet(t *testing.T) {
+	b, fake := newCos(t)
+	ctx := context.Background()
+	data := []byte("0123456789")
+	if err := b.Put(ctx, "a/b.txt", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fake.objects["a/b.txt"], data) {
+		t.Fatalf("stored object = %q", fake.objects["a/b.txt"])
+	}
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{0, 3, "012"},
+		{4, 2, "45"},
+		{7, -1, "789"},
+	}
+	for _, tt := range tests {
+		r, err := b.Get(ctx, "a/b.txt", tt.offset, tt.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Get(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestCosStatDelete(t *testing.T) {
+	b, _ := newCos(t)
+	ctx := context.Background()
+	if err := b.Put(ctx, "k", strings.NewReader("hello"), 5); err != nil {
+		t.Fatal(err)
+	}
+	info, err := b.Stat(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != "k" || info.Size != 5 || info.ETag != "etag" {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	if err := b.Delete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Stat(ctx, "k"); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Stat after Delete error = %v, want ErrNotExist", err)
+	}
+	if _, err := b.Get(ctx, "k", 0, -1); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Get after Delete error = %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// NewKey 生成对象 key, 按 FileInfo.Hash 的前缀分片: ab/cd/<hash>-<random><ext>
+// hash 未知时 (例如分片上传开始时) 用随机串代替
+func NewKey(hash, ext string) string {
+	hash = strings.ToLower(hash)
+	if len(hash) < 4 || strings.ContainsAny(hash, `/\.`) {
+		hash = randomHex(16)
+	}
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return hash[0:2] + "/" + hash[2:4] + "/" + hash + "-" + randomHex(4) + ext
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalConfig 本地磁盘存储配置
+type LocalConfig struct {
+	Root string `yaml:"root"`
+}
+
+// LocalBackend 本地磁盘存储, 目录结构:
+//
+//	<root>/objects/<key>                 对象, key 由 NewKey 按 hash 前缀分片
+//	<root>/uploads/<uploadID>/key        分片上传对应的对象 key
+//	<root>/uploads/<uploadID>/<n>.part   已上传的分片
+//	<root>/tmp/                          写入中的临时文件, 写完后 rename 到目标位置
+type LocalBackend struct {
+	root string
+}
+
+func NewLocalBackend(config LocalConfig) (*LocalBackend, error) {
+	if config.Root == "" {
+		return nil, errors.New("storage: local root is empty")
+	}
+	root, err := filepath.Abs(config.Root)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range []string{"objects", "uploads", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &LocalBackend{root: root}, nil
+}
+
+// objectPath key 对应的文件路径, 拒绝跳出 root 的 key
+func (b *LocalBackend) objectPath(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || clean[1:] != strings.TrimPrefix(key, "/") {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return filepath.Join(b.root, "objects", filepath.FromSlash(clean[1:])), nil
+}
+
+func (b *LocalBackend) uploadDir(uploadID string) (string, error) {
+	if uploadID == "" || strings.ContainsAny(uploadID, `/\.`) {
+		return "", fmt.Errorf("storage: invalid upload id %q", uploadID)
+	}
+	return filepath.Join(b.root, "uploads", uploadID), nil
+}
+
+// writeAtomic 先写临时文件再 rename 到 dst, 返回内容的 md5
+func (b *LocalBackend) writeAtomic(dst string, r io.Reader, size int64) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Join(b.root, "tmp"), "put-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("storage: size mismatch, expect %d got %d", size, n)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (b *LocalBackend) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	p, err := b.objectPath(key)
+	if err != nil {
+		return err
+	}
+	_, err = b.writeAtomic(p, r, size)
+	return err
+}
+
+type fileReader struct {
+	io.Reader
+	io.Closer
+}
+
+func (b *LocalBackend) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	p, err := b.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotExist
+		}
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return fileReader{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
+func (b *LocalBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	p, err := b.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotExist
+		}
+		return nil, err
+	}
+	return &ObjectInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()}, nil
+}
+
+func (b *LocalBackend) Delete(ctx context.Context, key string) error {
+	p, err := b.objectPath(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (b *LocalBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := filepath.Join(b.root, "objects")
+	start := objects
+	if dir := path.Dir(prefix); dir != "." && dir != "/" {
+		start = filepath.Join(objects, filepath.FromSlash(path.Clean("/" + dir)[1:]))
+	}
+
+	var list []ObjectInfo
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(objects, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		list = append(list, ObjectInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (b *LocalBackend) InitMultipart(ctx context.Context, key string) (string, error) {
+	if _, err := b.objectPath(key); err != nil {
+		return "", err
+	}
+	uploadID := randomHex(16)
+	dir, err := b.uploadDir(uploadID)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "key"), []byte(key), 0644); err != nil {
+		return "", err
+	}
+	return uploadID, nil
+}
+
+// checkUpload 校验 uploadID 存在且属于 key
+func (b *LocalBackend) checkUpload(key, uploadID string) (string, error) {
+	dir, err := b.uploadDir(uploadID)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "key"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", ErrNotExist
+		}
+		return "", err
+	}
+	if string(data) != key {
+		return "", fmt.Errorf("storage: upload %s does not belong to %s", uploadID, key)
+	}
+	return dir, nil
+}
+
+func partName(partNumber int) string {
+	return fmt.Sprintf("%05d.part", partNumber)
+}
+
+func (b *LocalBackend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, r io.Reader, size int64) (string, error) {
+	if partNumber < 1 {
+		return "", fmt.Errorf("storage: invalid part number %d", partNumber)
+	}
+	dir, err := b.checkUpload(key, uploadID)
+	if err != nil {
+		return "", err
+	}
+	return b.writeAtomic(filepath.Join(dir, partName(partNumber)), r, size)
+}
+
+func (b *LocalBackend) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	dir, err := b.checkUpload(key, uploadID)
+	if err != nil {
+		return err
+	}
+	dst, err := b.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	files := make([]*os.File, 0, len(parts))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	readers := make([]io.Reader, 0, len(parts))
+	for i, p := range parts {
+		if i > 0 && p.PartNumber <= parts[i-1].PartNumber {
+			return fmt.Errorf("storage: parts must be in ascending order")
+		}
+		f, err := os.Open(filepath.Join(dir, partName(p.PartNumber)))
+		if err != nil {
+			return fmt.Errorf("storage: part %d not uploaded", p.PartNumber)
+		}
+		files = append(files, f)
+
+		h := md5.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		if hex.EncodeToString(h.Sum(nil)) != strings.Trim(p.ETag, "\"") {
+			return fmt.Errorf("storage: part %d etag mismatch", p.PartNumber)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		readers = append(readers, f)
+	}
+
+	if _, err := b.writeAtomic(dst, io.MultiReader(readers...), -1); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (b *LocalBackend) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	dir, err := b.checkUpload(key, uploadID)
+	if err != nil {
+		if err == ErrNotExist {
+			return nil
+		}
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (b *LocalBackend) ListMultipart(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	entries, err := os.ReadDir(filepath.Join(b.root, "uploads"))
+	if err != nil {
+		return nil, err
+	}
+	var list []MultipartUpload
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(b.root, "uploads", e.Name())
+		key, err := os.ReadFile(filepath.Join(dir, "key"))
+		if err != nil || !strings.HasPrefix(string(key), prefix) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, MultipartUpload{Key: string(key), UploadID: e.Name(), Initiated: fi.ModTime()})
+	}
+	return list, nil
+}
@@ -0,0 +1,192 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"net_disk/server/storage"
+)
+
+func newLocal(t *testing.T) (*storage.LocalBackend, string) {
+	t.Helper()
+	root := t.TempDir()
+	b, err := storage.NewLocalBackend(storage.LocalConfig{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, root
+}
+
+func TestNewKey(t *testing.T) {
+	key := storage.NewKey("ABCDEF0123", "pdf")
+	if ok, _ := regexp.MatchString(`^ab/cd/abcdef0123-[0-9a-f]{8}\.pdf$`, key); !ok {
+		t.Errorf("NewKey(hash) = %q", key)
+	}
+	if key == storage.NewKey("ABCDEF0123", "pdf") {
+		t.Error("NewKey returned the same key twice")
+	}
+	for _, hash := range []string{"", "abc", "../../etc", `ab\cd`} {
+		key := storage.NewKey(hash, ".txt")
+		if ok, _ := regexp.MatchString(`^([0-9a-f]{2})/([0-9a-f]{2})/[0-9a-f]{32}-[0-9a-f]{8}\.txt$`, key); !ok {
+			t.Errorf("NewKey(%q) = %q, want a random sharded key", hash, key)
+		}
+	}
+}
+
+func TestLocalPutGet(t *testing.T) {
+	b, root := newLocal(t)
+	ctx := context.Background()
+	key := storage.NewKey("abcdef", ".txt")
+	if err := b.Put(ctx, key, strings.NewReader("0123456789"), 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "objects", filepath.FromSlash(key))); err != nil {
+		t.Fatalf("object not written to its sharded path: %v", err)
+	}
+	// 写完后临时文件已经 rename 走
+	if entries, _ := os.ReadDir(filepath.Join(root, "tmp")); len(entries) != 0 {
+		t.Errorf("tmp has %d leftover files", len(entries))
+	}
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{0, 3, "012"},
+		{4, 2, "45"},
+		{7, -1, "789"},
+		{8, 10, "89"},
+	}
+	for _, tt := range tests {
+		r, err := b.Get(ctx, key, tt.offset, tt.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Get(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestLocalPutSizeMismatch(t *testing.T) {
+	b, root := newLocal(t)
+	ctx := context.Background()
+	if err := b.Put(ctx, "k", strings.NewReader("short"), 10); err == nil {
+		t.Fatal("Put with wrong size succeeded")
+	}
+	if _, err := b.Stat(ctx, "k"); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Stat after failed Put error = %v, want ErrNotExist", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "tmp")); len(entries) != 0 {
+		t.Errorf("tmp has %d leftover files", len(entries))
+	}
+}
+
+func TestLocalInvalidKey(t *testing.T) {
+	b, _ := newLocal(t)
+	ctx := context.Background()
+	for _, key := range []string{"", "/", "../x", "a/../../x", "a//b"} {
+		if err := b.Put(ctx, key, strings.NewReader("x"), 1); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+}
+
+func TestLocalStatDeleteList(t *testing.T) {
+	b, _ := newLocal(t)
+	ctx := context.Background()
+	for _, key := range []string{"p/1", "p/2", "p/sub/3", "q/4"} {
+		if err := b.Put(ctx, key, strings.NewReader(key), -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := b.Stat(ctx, "p/sub/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 7 || info.LastModified.IsZero() {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	infos, err := b.List(ctx, "p/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, info := range infos {
+		got = append(got, info.Key)
+	}
+	if strings.Join(got, ",") != "p/1,p/2,p/sub/3" {
+		t.Errorf("List(p/) = %v", got)
+	}
+
+	if err := b.Delete(ctx, "p/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get(ctx, "p/1", 0, -1); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Get after Delete error = %v, want ErrNotExist", err)
+	}
+	if err := b.Delete(ctx, "p/1"); err != nil {
+		t.Errorf("Delete missing object error = %v", err)
+	}
+}
+
+func TestLocalMultipart(t *testing.T) {
+	b, _ := newLocal(t)
+	ctx := context.Background()
+	parts := []string{strings.Repeat("a", 100), strings.Repeat("b", 100), "c"}
+
+	id, err := b.InitMultipart(ctx, "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.UploadPart(ctx, "other", id, 1, strings.NewReader("x"), 1); err == nil {
+		t.Error("UploadPart with another key succeeded")
+	}
+	var done []storage.Part
+	for i, p := range parts {
+		etag, err := b.UploadPart(ctx, "big", id, i+1, strings.NewReader(p), int64(len(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done = append(done, storage.Part{PartNumber: i + 1, ETag: etag})
+	}
+	if uploads, _ := b.ListMultipart(ctx, ""); len(uploads) != 1 || uploads[0].UploadID != id {
+		t.Fatalf("ListMultipart = %+v", uploads)
+	}
+
+	bad := []storage.Part{done[0], {PartNumber: 2, ETag: "wrong"}}
+	if err := b.CompleteMultipart(ctx, "big", id, bad); err == nil {
+		t.Error("CompleteMultipart with wrong etag succeeded")
+	}
+	if err := b.CompleteMultipart(ctx, "big", id, done); err != nil {
+		t.Fatal(err)
+	}
+	r, err := b.Get(ctx, "big", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	r.Close()
+	if string(got) != strings.Join(parts, "") {
+		t.Errorf("completed object has %d bytes", len(got))
+	}
+	if uploads, _ := b.ListMultipart(ctx, ""); len(uploads) != 0 {
+		t.Errorf("ListMultipart after Complete = %+v", uploads)
+	}
+	if err := b.AbortMultipart(ctx, "big", id); err != nil {
+		t.Errorf("AbortMultipart after Complete error = %v", err)
+	}
+}
@@ -0,0 +1,473 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config S3 兼容存储配置
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"` // 例如 https://s3.us-east-1.amazonaws.com
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	PathStyle bool   `yaml:"path_style"` // minio 等自建服务一般需要开启
+}
+
+// S3Backend S3 API 兼容存储, 请求使用 SigV4 签名
+type S3Backend struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3Backend(config S3Config) (*S3Backend, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("storage: s3 bucket is empty")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	u, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("storage: invalid s3 endpoint %q", config.Endpoint)
+	}
+	return &S3Backend{config: config, endpoint: u, client: http.DefaultClient}, nil
+}
+
+// S3Error S3 返回的错误
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("storage: s3 %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (b *S3Backend) objectURL(key string, query url.Values) *url.URL {
+	u := *b.endpoint
+	if b.config.PathStyle {
+		u.Path = "/" + b.config.Bucket
+	} else {
+		u.Host = b.config.Bucket + "." + u.Host
+		u.Path = ""
+	}
+	if key != "" {
+		u.Path += "/" + key
+	} else if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawPath = ""
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+// do 发送签名后的请求, 非 2xx 响应转换为 *S3Error
+func (b *S3Backend) do(ctx context.Context, method, key string, query url.Values, header http.Header, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	SignV4(req, b.config.AccessKey, b.config.SecretKey, b.config.Region, payloadHash, time.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	s3err := &S3Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	_ = xml.Unmarshal(data, s3err)
+	if resp.StatusCode == http.StatusNotFound && (s3err.Code == "" || s3err.Code == "NoSuchKey" || s3err.Code == "NoSuchUpload") {
+		return nil, ErrNotExist
+	}
+	return nil, s3err
+}
+
+// spool size 未知时先落临时文件, S3 的 PUT 必须带 Content-Length
+func spool(r io.Reader) (*os.File, int64, error) {
+	f, err := os.CreateTemp("", "s3-spool-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	os.Remove(f.Name())
+	n, err := io.Copy(f, r)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, n, nil
+}
+
+func (b *S3Backend) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if size < 0 {
+		f, n, err := spool(r)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r, size = f, n
+	}
+	resp, err := b.do(ctx, http.MethodPut, key, nil, nil, r, size, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (b *S3Backend) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if rh := rangeHeader(offset, length); rh != "" {
+		header.Set("Range", rh)
+	}
+	resp, err := b.do(ctx, http.MethodGet, key, nil, header, nil, 0, emptyPayload)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *S3Backend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := b.do(ctx, http.MethodHead, key, nil, nil, nil, 0, emptyPayload)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	info := &ObjectInfo{
+		Key:  key,
+		Size: resp.ContentLength,
+		ETag: strings.Trim(resp.Header.Get("ETag"), "\""),
+	}
+	info.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	resp, err := b.do(ctx, http.MethodDelete, key, nil, nil, nil, 0, emptyPayload)
+	if err != nil {
+		if err == ErrNotExist {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		ETag         string
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (b *S3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var list []ObjectInfo
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := b.do(ctx, http.MethodGet, "", query, nil, nil, 0, emptyPayload)
+		if err != nil {
+			return nil, err
+		}
+		var res listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range res.Contents {
+			list = append(list, ObjectInfo{
+				Key:          o.Key,
+				Size:         o.Size,
+				ETag:         strings.Trim(o.ETag, "\""),
+				LastModified: o.LastModified,
+			})
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return list, nil
+		}
+		query.Set("continuation-token", res.NextContinuationToken)
+	}
+}
+
+func (b *S3Backend) InitMultipart(ctx context.Context, key string) (string, error) {
+	resp, err := b.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil, 0, emptyPayload)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var res struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", err
+	}
+	return res.UploadID, nil
+}
+
+func (b *S3Backend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, r io.Reader, size int64) (string, error) {
+	if size < 0 {
+		f, n, err := spool(r)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r, size = f, n
+	}
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+	resp, err := b.do(ctx, http.MethodPut, key, query, nil, r, size, unsignedPayload)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return strings.Trim(resp.Header.Get("ETag"), "\""), nil
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+func (b *S3Backend) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	var body completeMultipartUpload
+	for _, p := range parts {
+		body.Parts = append(body.Parts, struct {
+			PartNumber int
+			ETag       string
+		}{p.PartNumber, "\"" + strings.Trim(p.ETag, "\"") + "\""})
+	}
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	md5sum := md5.Sum(data)
+	header := http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(md5sum[:])}}
+	resp, err := b.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, header,
+		bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// CompleteMultipartUpload 出错时也可能返回 200, 错误在 body 中
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(data, []byte("<Error>")) {
+		s3err := &S3Error{StatusCode: resp.StatusCode}
+		_ = xml.Unmarshal(data, s3err)
+		return s3err
+	}
+	return nil
+}
+
+func (b *S3Backend) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	resp, err := b.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil, 0, emptyPayload)
+	if err != nil {
+		if err == ErrNotExist {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type listMultipartUploadsResult struct {
+	Uploads []struct {
+		Key       string
+		UploadID  string `xml:"UploadId"`
+		Initiated time.Time
+	} `xml:"Upload"`
+	IsTruncated        bool
+	NextKeyMarker      string
+	NextUploadIDMarker string `xml:"NextUploadIdMarker"`
+}
+
+func (b *S3Backend) ListMultipart(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	var list []MultipartUpload
+	query := url.Values{"uploads": {""}, "prefix": {prefix}}
+	for {
+		resp, err := b.do(ctx, http.MethodGet, "", query, nil, nil, 0, emptyPayload)
+		if err != nil {
+			return nil, err
+		}
+		var res listMultipartUploadsResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range res.Uploads {
+			list = append(list, MultipartUpload{Key: u.Key, UploadID: u.UploadID, Initiated: u.Initiated})
+		}
+		if !res.IsTruncated {
+			return list, nil
+		}
+		query.Set("key-marker", res.NextKeyMarker)
+		query.Set("upload-id-marker", res.NextUploadIDMarker)
+	}
+}
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// emptyPayload 空 body 的 sha256
+	emptyPayload  = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	amzDateFormat = "20060102T150405Z"
+)
+
+// SignV4 用 AWS Signature Version 4 对请求签名, payloadHash 为 body 的 sha256 或 UNSIGNED-PAYLOAD
+func SignV4(req *http.Request, accessKey, secretKey, region, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("Authorization", authorizationV4(req, accessKey, secretKey, region, amzDate))
+}
+
+// authorizationV4 计算请求的 Authorization 头, fake 服务端校验签名时也用它
+func authorizationV4(req *http.Request, accessKey, secretKey, region, amzDate string) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	signed := []string{"host"}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "content-md5" || lk == "range" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+			signed = append(signed, lk)
+		}
+	}
+	sort.Strings(signed)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range signed {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.EscapedPath(), false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	date := amzDate[:8]
+	scope := date + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return "AWS4-HMAC-SHA256 Credential=" + accessKey + "/" + scope +
+		", SignedHeaders=" + signedHeaders + ", Signature=" + signature
+}
+
+// VerifyV4 校验请求的 SigV4 签名, 供 fake 服务端使用
+func VerifyV4(req *http.Request, accessKey, secretKey, region string) bool {
+	amzDate := req.Header.Get("X-Amz-Date")
+	if len(amzDate) != len(amzDateFormat) {
+		return false
+	}
+	expect := authorizationV4(req, accessKey, secretKey, region, amzDate)
+	return hmac.Equal([]byte(expect), []byte(req.Header.Get("Authorization")))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode 按 SigV4 规则编码, path 已经转义过的部分先还原再编码
+func uriEncode(s string, encodeSlash bool) string {
+	if !encodeSlash {
+		if u, err := url.PathUnescape(s); err == nil {
+			s = u
+		}
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
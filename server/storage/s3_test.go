@@ -0,0 +1,210 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"net_disk/server/storage"
+	"net_disk/server/storage/s3fake"
+)
+
+func newS3(t *testing.T) (*storage.S3Backend, *s3fake.Server) {
+	t.Helper()
+	fake := s3fake.New("ak", "sk", "us-east-1")
+	t.Cleanup(fake.Close)
+	b, err := storage.NewS3Backend(fake.Config("disk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, fake
+}
+
+func TestS3PutGet(t *testing.T) {
+	b, fake := newS3(t)
+	ctx := context.Background()
+	data := []byte("0123456789abcdefghij")
+	if err := b.Put(ctx, "a/b.txt", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := fake.Object("disk", "a/b.txt"); !ok || !bytes.Equal(got, data) {
+		t.Fatalf("stored object = %q, %v", got, ok)
+	}
+
+	tests := []struct {
+		name           string
+		offset, length int64
+		want           string
+	}{
+		{"whole", 0, -1, string(data)},
+		{"prefix", 0, 5, "01234"},
+		{"middle", 10, 4, "abcd"},
+		{"tail", 15, -1, "fghij"},
+		{"past end", 18, 10, "ij"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := b.Get(ctx, "a/b.txt", tt.offset, tt.length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Get(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3PutUnknownSize(t *testing.T) {
+	b, fake := newS3(t)
+	data := strings.Repeat("x", 1000)
+	if err := b.Put(context.Background(), "unknown", strings.NewReader(data), -1); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fake.Object("disk", "unknown"); string(got) != data {
+		t.Errorf("stored %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestS3StatDelete(t *testing.T) {
+	b, _ := newS3(t)
+	ctx := context.Background()
+	if err := b.Put(ctx, "k", strings.NewReader("hello"), 5); err != nil {
+		t.Fatal(err)
+	}
+	info, err := b.Stat(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 5 || info.ETag == "" || info.LastModified.IsZero() {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	if err := b.Delete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Stat(ctx, "k"); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Stat after Delete error = %v, want ErrNotExist", err)
+	}
+	if _, err := b.Get(ctx, "k", 0, -1); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("Get after Delete error = %v, want ErrNotExist", err)
+	}
+	if err := b.Delete(ctx, "k"); err != nil {
+		t.Errorf("Delete missing object error = %v", err)
+	}
+}
+
+func TestS3List(t *testing.T) {
+	b, _ := newS3(t)
+	ctx := context.Background()
+	for _, key := range []string{"p/1", "p/2", "p/sub/3", "q/4"} {
+		if err := b.Put(ctx, key, strings.NewReader(key), int64(len(key))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"p/", []string{"p/1", "p/2", "p/sub/3"}},
+		{"q/", []string{"q/4"}},
+		{"r/", nil},
+		{"", []string{"p/1", "p/2", "p/sub/3", "q/4"}},
+	}
+	for _, tt := range tests {
+		infos, err := b.List(ctx, tt.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, info := range infos {
+			got = append(got, info.Key)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("List(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+	b, fake := newS3(t)
+	ctx := context.Background()
+	parts := []string{strings.Repeat("a", 100), strings.Repeat("b", 100), "c"}
+
+	id, err := b.InitMultipart(ctx, "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads, err := b.ListMultipart(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads) != 1 || uploads[0].Key != "big" || uploads[0].UploadID != id {
+		t.Fatalf("ListMultipart = %+v", uploads)
+	}
+
+	var done []storage.Part
+	for i, p := range parts {
+		etag, err := b.UploadPart(ctx, "big", id, i+1, strings.NewReader(p), int64(len(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done = append(done, storage.Part{PartNumber: i + 1, ETag: etag})
+	}
+	if err := b.CompleteMultipart(ctx, "big", id, done); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fake.Object("disk", "big"); string(got) != strings.Join(parts, "") {
+		t.Errorf("completed object has %d bytes", len(got))
+	}
+	if uploads, _ := b.ListMultipart(ctx, ""); len(uploads) != 0 {
+		t.Errorf("ListMultipart after Complete = %+v", uploads)
+	}
+}
+
+func TestS3AbortMultipart(t *testing.T) {
+	b, fake := newS3(t)
+	ctx := context.Background()
+	id, err := b.InitMultipart(ctx, "aborted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.UploadPart(ctx, "aborted", id, 1, strings.NewReader("x"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AbortMultipart(ctx, "aborted", id); err != nil {
+		t.Fatal(err)
+	}
+	if uploads, _ := b.ListMultipart(ctx, ""); len(uploads) != 0 {
+		t.Errorf("ListMultipart after Abort = %+v", uploads)
+	}
+	if _, ok := fake.Object("disk", "aborted"); ok {
+		t.Error("aborted upload created an object")
+	}
+	if err := b.CompleteMultipart(ctx, "aborted", id, []storage.Part{{PartNumber: 1, ETag: "x"}}); err == nil {
+		t.Error("CompleteMultipart after Abort succeeded")
+	}
+}
+
+func TestS3BadSignature(t *testing.T) {
+	fake := s3fake.New("ak", "sk", "us-east-1")
+	defer fake.Close()
+	config := fake.Config("disk")
+	config.SecretKey = "wrong"
+	b, err := storage.NewS3Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s3err *storage.S3Error
+	if err := b.Put(context.Background(), "k", strings.NewReader("v"), 1); !errors.As(err, &s3err) || s3err.StatusCode != 403 {
+		t.Errorf("Put with wrong secret error = %v, want 403", err)
+	}
+}
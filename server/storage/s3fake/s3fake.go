@@ -0,0 +1,362 @@
+// Package s3fake 内存版的 S3 服务, 实现 storage.S3Backend 用到的接口, 用于在测试中跑通上传下载流程
+package s3fake
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"net_disk/server/storage"
+)
+
+type object struct {
+	data     []byte
+	etag     string
+	modified time.Time
+}
+
+type upload struct {
+	bucket    string
+	key       string
+	parts     map[int]*object
+	initiated time.Time
+}
+
+// Server 内存版 S3 服务, 只支持 path style
+type Server struct {
+	*httptest.Server
+
+	AccessKey string
+	SecretKey string
+	Region    string
+
+	mu      sync.Mutex
+	seq     int
+	buckets map[string]map[string]*object
+	uploads map[string]*upload
+}
+
+// New 启动一个 fake 服务, 调用方负责 Close
+func New(accessKey, secretKey, region string) *Server {
+	s := &Server{
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Region:    region,
+		buckets:   make(map[string]map[string]*object),
+		uploads:   make(map[string]*upload),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config 创建 bucket 并返回指向本服务的 S3 配置
+func (s *Server) Config(bucket string) storage.S3Config {
+	s.CreateBucket(bucket)
+	return storage.S3Config{
+		Endpoint:  s.URL,
+		Region:    s.Region,
+		Bucket:    bucket,
+		AccessKey: s.AccessKey,
+		SecretKey: s.SecretKey,
+		PathStyle: true,
+	}
+}
+
+func (s *Server) CreateBucket(bucket string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = make(map[string]*object)
+	}
+}
+
+// Object 直接读取对象内容, 便于断言
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return o.data, true
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, msg)
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func newObject(data []byte) *object {
+	sum := md5.Sum(data)
+	return &object{data: data, etag: hex.EncodeToString(sum[:]), modified: time.Now().UTC()}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !storage.VerifyV4(r, s.AccessKey, s.SecretKey, s.Region) {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", "signature does not match")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key == "" && r.Method == http.MethodPut {
+		if _, ok := s.buckets[bucket]; !ok {
+			s.buckets[bucket] = make(map[string]*object)
+		}
+		return
+	}
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+
+	if key == "" {
+		if _, ok := query["uploads"]; ok && r.Method == http.MethodGet {
+			s.listUploads(w, bucket, query.Get("prefix"))
+			return
+		}
+		if r.Method == http.MethodGet {
+			s.listObjects(w, objects, query.Get("prefix"), query.Get("continuation-token"), query.Get("max-keys"))
+			return
+		}
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+		return
+	}
+
+	_, isInit := query["uploads"]
+	uploadID := query.Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && isInit:
+		s.seq++
+		id := fmt.Sprintf("upload-%d", s.seq)
+		s.uploads[id] = &upload{bucket: bucket, key: key, parts: make(map[int]*object), initiated: time.Now().UTC()}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: id})
+	case r.Method == http.MethodPut && uploadID != "":
+		s.uploadPart(w, r, bucket, key, uploadID)
+	case r.Method == http.MethodPost && uploadID != "":
+		s.completeUpload(w, r, objects, bucket, key, uploadID)
+	case r.Method == http.MethodDelete && uploadID != "":
+		u, ok := s.uploads[uploadID]
+		if !ok || u.bucket != bucket || u.key != key {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", uploadID)
+			return
+		}
+		delete(s.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		o := newObject(data)
+		objects[key] = o
+		w.Header().Set("ETag", "\""+o.etag+"\"")
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		o, ok := objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", key)
+			return
+		}
+		s.getObject(w, r, o)
+	case r.Method == http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, objects map[string]*object, prefix, token, maxKeys string) {
+	limit, _ := strconv.Atoi(maxKeys)
+	if limit <= 0 {
+		limit = 1000
+	}
+	var keys []string
+	for k := range objects {
+		if strings.HasPrefix(k, prefix) && k > token {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key          string
+		Size         int64
+		ETag         string
+		LastModified time.Time
+	}
+	res := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Prefix                string
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{Prefix: prefix}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		res.IsTruncated = true
+		res.NextContinuationToken = keys[limit-1]
+	}
+	for _, k := range keys {
+		o := objects[k]
+		res.Contents = append(res.Contents, content{Key: k, Size: int64(len(o.data)), ETag: "\"" + o.etag + "\"", LastModified: o.modified})
+	}
+	writeXML(w, res)
+}
+
+func (s *Server) listUploads(w http.ResponseWriter, bucket, prefix string) {
+	type item struct {
+		Key       string
+		UploadID  string `xml:"UploadId"`
+		Initiated time.Time
+	}
+	res := struct {
+		XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+		Bucket      string
+		Prefix      string
+		Uploads     []item `xml:"Upload"`
+		IsTruncated bool
+	}{Bucket: bucket, Prefix: prefix}
+	for id, u := range s.uploads {
+		if u.bucket == bucket && strings.HasPrefix(u.key, prefix) {
+			res.Uploads = append(res.Uploads, item{Key: u.key, UploadID: id, Initiated: u.initiated})
+		}
+	}
+	sort.Slice(res.Uploads, func(i, j int) bool {
+		return res.Uploads[i].Key < res.Uploads[j].Key
+	})
+	writeXML(w, res)
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, o *object) {
+	w.Header().Set("ETag", "\""+o.etag+"\"")
+	w.Header().Set("Last-Modified", o.modified.Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	size := int64(len(o.data))
+	start, end := int64(0), size-1
+	status := http.StatusOK
+	if rh := r.Header.Get("Range"); rh != "" {
+		spec := strings.TrimPrefix(rh, "bytes=")
+		from, to, _ := strings.Cut(spec, "-")
+		var err error
+		if start, err = strconv.ParseInt(from, 10, 64); err != nil || start >= size {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", rh)
+			return
+		}
+		if to != "" {
+			if end, err = strconv.ParseInt(to, 10, 64); err != nil || end < start {
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", rh)
+				return
+			}
+			if end >= size {
+				end = size - 1
+			}
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(o.data[start : end+1])
+	}
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) {
+	u, ok := s.uploads[uploadID]
+	if !ok || u.bucket != bucket || u.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", uploadID)
+		return
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || n < 1 || n > 10000 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "partNumber")
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	o := newObject(data)
+	u.parts[n] = o
+	w.Header().Set("ETag", "\""+o.etag+"\"")
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, objects map[string]*object, bucket, key, uploadID string) {
+	u, ok := s.uploads[uploadID]
+	if !ok || u.bucket != bucket || u.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", uploadID)
+		return
+	}
+	var req struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "invalid complete request")
+		return
+	}
+
+	var data bytes.Buffer
+	var etags []byte
+	for i, p := range req.Parts {
+		if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+			writeError(w, http.StatusBadRequest, "InvalidPartOrder", "parts must be ascending")
+			return
+		}
+		part, ok := u.parts[p.PartNumber]
+		if !ok || part.etag != strings.Trim(p.ETag, "\"") {
+			writeError(w, http.StatusBadRequest, "InvalidPart", strconv.Itoa(p.PartNumber))
+			return
+		}
+		data.Write(part.data)
+		sum, _ := hex.DecodeString(part.etag)
+		etags = append(etags, sum...)
+	}
+
+	sum := md5.Sum(etags)
+	o := &object{
+		data:     data.Bytes(),
+		etag:     fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(req.Parts)),
+		modified: time.Now().UTC(),
+	}
+	objects[key] = o
+	delete(s.uploads, uploadID)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: bucket, Key: key, ETag: "\"" + o.etag + "\""})
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrNotExist 对象不存在
+var ErrNotExist = errors.New("storage: object not exist")
+
+const (
+	TypeCos   = "cos"
+	TypeLocal = "local"
+	TypeS3    = "s3"
+)
+
+// Config storage config
+type Config struct {
+	Type  string      `yaml:"type"` // 存储类型: cos, local, s3, 默认 cos
+	Cos   CosConfig   `yaml:"cos"`
+	Local LocalConfig `yaml:"local"`
+	S3    S3Config    `yaml:"s3"`
+}
+
+// ObjectInfo 对象元数据
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// Part 分片上传的分片
+type Part struct {
+	PartNumber int
+	ETag       string
+}
+
+// MultipartUpload 未完成的分片上传
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// Backend 对象存储后端, 所有上传下载都通过它完成
+type Backend interface {
+	// Put 上传整个对象, size 未知时传 -1
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get 读取对象的 [offset, offset+length) 区间, length < 0 表示读到结尾
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Stat 获取对象元数据, 对象不存在时返回 ErrNotExist
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete 删除对象, 对象不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// List 列出 prefix 开头的所有对象
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+
+	// InitMultipart 初始化分片上传, 返回 uploadID
+	InitMultipart(ctx context.Context, key string) (string, error)
+	// UploadPart 上传一个分片, 返回分片的 ETag
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int, r io.Reader, size int64) (string, error)
+	// CompleteMultipart 按 parts 合并分片
+	CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error
+	// AbortMultipart 取消分片上传并清理已上传的分片
+	AbortMultipart(ctx context.Context, key, uploadID string) error
+	// ListMultipart 列出 prefix 开头的未完成分片上传
+	ListMultipart(ctx context.Context, prefix string) ([]MultipartUpload, error)
+}
+
+// New 根据配置创建存储后端
+func New(config Config) (Backend, error) {
+	switch config.Type {
+	case "", TypeCos:
+		return NewCosBackend(config.Cos)
+	case TypeLocal:
+		return NewLocalBackend(config.Local)
+	case TypeS3:
+		return NewS3Backend(config.S3)
+	}
+	return nil, fmt.Errorf("storage: unknown type %q", config.Type)
+}
+
+// rangeHeader 生成 http Range 头
+func rangeHeader(offset, length int64) string {
+	if offset <= 0 && length < 0 {
+		return ""
+	}
+	if length < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
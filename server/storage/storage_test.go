@@ -0,0 +1,42 @@
+package storage
+
+import "testing"
+
+func TestRangeHeader(t *testing.T) {
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, ""},
+		{0, 10, "bytes=0-9"},
+		{5, -1, "bytes=5-"},
+		{5, 1, "bytes=5-5"},
+	}
+	for _, tt := range tests {
+		if got := rangeHeader(tt.offset, tt.length); got != tt.want {
+			t.Errorf("rangeHeader(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	b, err := New(Config{Cos: CosConfig{BucketURL: "https://disk-1250000000.cos.ap-guangzhou.myqcloud.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.(*CosBackend); !ok {
+		t.Errorf("New with empty type = %T, want *CosBackend", b)
+	}
+
+	b, err = New(Config{Type: TypeLocal, Local: LocalConfig{Root: t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.(*LocalBackend); !ok {
+		t.Errorf("New(local) = %T, want *LocalBackend", b)
+	}
+
+	if _, err := New(Config{Type: "ftp"}); err == nil {
+		t.Error("New with unknown type succeeded")
+	}
+}
@@ -1,20 +1,11 @@
 package tool
 
 import (
-	"bytes"
-	"context"
 	"crypto/md5"
 	"errors"
 	"fmt"
 	uuid2 "github.com/hashicorp/go-uuid"
-	"io"
 	"math/rand"
-	"net/http"
-	"net/url"
-	"os"
-	"path"
-	"strconv"
-	"strings"
 	"suhc-gitlab-01.inovance.local/mnk/server/lcdp.git/server"
 	"time"
 )
@@ -77,89 +68,3 @@ func GenerateUUID() string {
 	}
 	return str[0:15]
 }
-
-// upload file to COS
-func UploadCos(req *http.Request) (string, error) {
-	u, _ := url.Parse(server.COSADDR)
-	b := &cos.BaseURL{BucketURL: u}
-	client := cos.NewClient(b, &http.Client{
-		Transport: &cos.AuthorizationTransport{
-			SecretID:  os.Getenv(server.CloudId),
-			SecretKey: os.Getenv(server.CloudKey),
-		},
-	})
-
-	file, fileHeader, err := req.FormFile("file")
-	key := "mystorage/" + GenerateUUID() + path.Ext(fileHeader.Filename)
-
-	_, err = client.Object.Put(
-		context.Background(), key, file, nil,
-	)
-	if err != nil {
-		panic(err)
-	}
-	return define.COSADDR + "/" + key, nil
-}
-
-func CosInitPart(ext string) (string, string, error) {
-	u, _ := url.Parse(define.COSADDR)
-	b := &cos.BaseURL{BucketURL: u}
-	client := cos.NewClient(b, &http.Client{
-		Transport: &cos.AuthorizationTransport{
-			SecretID:  os.Getenv(define.CloudId),
-			SecretKey: os.Getenv(define.CloudKey),
-		},
-	})
-	key := "mystorage/" + GenerateUUID() + "." + ext
-	v, _, err := client.Object.InitiateMultipartUpload(context.Background(), key, nil)
-	if err != nil {
-		return "", "", err
-	}
-	return key, v.UploadID, nil
-}
-
-func CosPartUpload(r *http.Request) (string, error) {
-	u, _ := url.Parse(define.COSADDR)
-	b := &cos.BaseURL{BucketURL: u}
-	client := cos.NewClient(b, &http.Client{
-		Transport: &cos.AuthorizationTransport{
-			SecretID:  os.Getenv(define.CloudId),
-			SecretKey: os.Getenv(define.CloudKey),
-		},
-	})
-	key := r.PostForm.Get("key")
-	UploadID := r.PostForm.Get("uploadId")
-	partNumber, err := strconv.Atoi(r.PostForm.Get("partNumber"))
-	f, _, err := r.FormFile("file")
-	if err != nil {
-		return "", err
-	}
-	buf := bytes.NewBuffer(nil)
-	io.Copy(buf, f)
-	resp, err := client.Object.UploadPart(
-		context.Background(), key, UploadID, partNumber, bytes.NewReader(buf.Bytes()), nil,
-	)
-	if err != nil {
-		return "", nil
-	}
-	return strings.Trim(resp.Header.Get("ETag"), "\""), nil
-}
-
-// 分片上传的结束
-func CosChunkUploadFinish(key, uploadId string, co []cos.Object) error {
-	u, _ := url.Parse(define.COSADDR)
-	b := &cos.BaseURL{BucketURL: u}
-	client := cos.NewClient(b, &http.Client{
-		Transport: &cos.AuthorizationTransport{
-			SecretID:  os.Getenv(define.CloudId),
-			SecretKey: os.Getenv(define.CloudKey),
-		},
-	})
-
-	opt := &cos.CompleteMultipartUploadOptions{}
-	opt.Parts = append(opt.Parts, co...)
-	_, _, err := client.Object.CompleteMultipartUpload(
-		context.Background(), key, uploadId, opt,
-	)
-	return err
-}